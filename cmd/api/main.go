@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/Shambou/golang-challenge/internal/server"
 )
@@ -19,6 +20,13 @@ func Run() error {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := Migrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := Run(); err != nil {
 		log.Fatal("Error starting up REST API")
 	}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	postgres "github.com/Shambou/golang-challenge/internal/database/postgres"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const migrateUsage = "usage: app migrate up [N] | down N | down --all | version | force VERSION"
+
+// Migrate - runs the migrate subcommand against the database picked by DB_DRIVER
+func Migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		err = steps(m, args[1:], 1)
+	case "down":
+		err = steps(m, args[1:], -1)
+	case "version":
+		var version uint
+		var dirty bool
+		version, dirty, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			log.Println("no migrations applied")
+			return nil
+		}
+		if err == nil {
+			log.Printf("version %d, dirty %t", version, dirty)
+		}
+	case "force":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		var version int
+		version, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %s", args[1])
+		}
+		err = m.Force(version)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Println("no change")
+		return nil
+	}
+
+	return err
+}
+
+// steps - migrates N steps in direction, or all the way up when no count is given. Rolling back everything drops
+// every rate, so it takes --all instead of a missing count
+func steps(m *migrate.Migrate, args []string, direction int) error {
+	if len(args) == 0 {
+		if direction > 0 {
+			return m.Up()
+		}
+		return errors.New(migrateUsage)
+	}
+	if direction < 0 && args[0] == "--all" {
+		return m.Down()
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid step count %s", args[0])
+	}
+
+	return m.Steps(n * direction)
+}
+
+// newMigrator - opens the database picked by DB_DRIVER and returns its migrate instance
+func newMigrator() (*migrate.Migrate, error) {
+	if os.Getenv("DB_DRIVER") == "sqlite" {
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = sqlite.DefaultPath
+		}
+
+		return sqlite.NewDatabase(path).Migrator()
+	}
+
+	db := postgres.NewDatabase()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.Connect(ctx, postgres.DefaultRetryConfig); err != nil {
+		return nil, err
+	}
+
+	return db.Migrator()
+}
@@ -0,0 +1,258 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultInterval - how often every rule is evaluated, used when ALERTS_INTERVAL is not set
+const DefaultInterval = 15 * time.Minute
+
+// MoveLookback - how far before the latest rate a move rule looks for the rate to compare it with
+const MoveLookback = 14 * 24 * time.Hour
+
+// Evaluator - checks alert rules whenever a rate of their currency changes and all of them on a schedule,
+// staleness can only be noticed by the schedule. A rule notifies when its condition starts to hold
+type Evaluator struct {
+	Store     database.AlertStore
+	DB        database.DatabaseRepo
+	Events    *events.Broker
+	Notifiers map[string]Notifier
+	Interval  time.Duration
+	// Now - the current time, business days of stale rules are counted up to it
+	Now func() time.Time
+
+	// mu - one evaluation at a time in this process, so scheduled and event driven runs don't overlap.
+	// Other processes are kept from notifying the same rule by ClaimAlertRule
+	mu sync.Mutex
+}
+
+// NewEvaluator - returns an evaluator of the rules in store over the rates of db, broker may be nil
+func NewEvaluator(store database.AlertStore, db database.DatabaseRepo, broker *events.Broker, notifiers map[string]Notifier, interval time.Duration) *Evaluator {
+	return &Evaluator{
+		Store:     store,
+		DB:        db,
+		Events:    broker,
+		Notifiers: notifiers,
+		Interval:  interval,
+		Now:       time.Now,
+	}
+}
+
+// Run - evaluates the rules of changed currencies as their events come in and every rule each Interval,
+// until ctx is done
+func (e *Evaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	sub := e.subscribe()
+	e.evaluate(ctx, nil)
+	for {
+		var changes <-chan models.RateEvent
+		if sub != nil {
+			changes = sub.Events()
+		}
+
+		select {
+		case <-ctx.Done():
+			if sub != nil {
+				sub.Close()
+			}
+			return
+		case <-ticker.C:
+			e.evaluate(ctx, nil)
+		case event, ok := <-changes:
+			if !ok {
+				// missed events are caught up by the next scheduled run
+				sub = e.subscribe()
+				continue
+			}
+			currencies := []string{event.QuoteCurrency}
+			for drained := false; !drained; {
+				select {
+				case event, ok := <-changes:
+					if !ok {
+						drained = true
+						break
+					}
+					currencies = append(currencies, event.QuoteCurrency)
+				default:
+					drained = true
+				}
+			}
+			e.evaluate(ctx, currencies)
+		}
+	}
+}
+
+func (e *Evaluator) subscribe() *events.Subscription {
+	if e.Events == nil {
+		return nil
+	}
+
+	return e.Events.Subscribe(nil)
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, quoteCurrencies []string) {
+	if err := e.Evaluate(ctx, quoteCurrencies); err != nil && ctx.Err() == nil {
+		log.Println("could not evaluate alert rules: ", err)
+	}
+}
+
+// Evaluate - checks the rules of the quote currencies, all of them when none are given, and notifies the ones
+// whose condition started to hold. A rule that can't be checked is logged and skipped, a rule whose
+// notification fails stays inactive, so both are tried again
+func (e *Evaluator) Evaluate(ctx context.Context, quoteCurrencies []string) error {
+	notifications, err := e.claim(ctx, quoteCurrencies)
+	if err != nil {
+		return err
+	}
+
+	// notifiers call out over the network, they are not held up by the lock of the next evaluation
+	for _, n := range notifications {
+		if err := n.notifier.Notify(ctx, n.alert); err != nil {
+			log.Printf("could not send alert of rule %d: %s", n.rule.ID, err)
+			if err := e.Store.SetAlertRuleState(ctx, n.rule.ID, false, n.rule.TriggeredAt); err != nil && !errors.Is(err, database.ErrAlertRuleNotFound) {
+				log.Printf("could not reset alert rule %d: %s", n.rule.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// notification - an alert of a claimed rule waiting to be sent
+type notification struct {
+	rule     models.AlertRule
+	alert    models.Alert
+	notifier Notifier
+}
+
+// claim - checks the rules under the lock, activates the ones whose condition started to hold and returns
+// their notifications, deactivates the ones whose condition no longer holds
+func (e *Evaluator) claim(ctx context.Context, quoteCurrencies []string) ([]notification, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules, err := e.Store.AlertRules(ctx, quoteCurrencies)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []notification
+	now := e.Now()
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			return notifications, nil
+		}
+
+		alert, matched, err := e.Match(ctx, rule, now)
+		if err != nil {
+			log.Printf("could not check alert rule %d: %s", rule.ID, err)
+			continue
+		}
+
+		switch {
+		case matched && !rule.Active:
+			notifier, ok := e.Notifiers[rule.Notifier]
+			if !ok {
+				log.Printf("alert rule %d uses notifier %s which isn't set up", rule.ID, rule.Notifier)
+				continue
+			}
+			// another replica may have seen the rule inactive too, only the one that activates it notifies
+			claimed, err := e.Store.ClaimAlertRule(ctx, rule.ID, alert.TriggeredAt)
+			if err != nil {
+				log.Printf("could not claim alert rule %d: %s", rule.ID, err)
+				continue
+			}
+			if claimed {
+				notifications = append(notifications, notification{rule: rule, alert: alert, notifier: notifier})
+			}
+		case !matched && rule.Active:
+			if err := e.Store.SetAlertRuleState(ctx, rule.ID, false, rule.TriggeredAt); err != nil && !errors.Is(err, database.ErrAlertRuleNotFound) {
+				log.Printf("could not reset alert rule %d: %s", rule.ID, err)
+			}
+		}
+	}
+
+	return notifications, nil
+}
+
+// Match - whether the condition of rule holds at now, with the alert to send when it does
+func (e *Evaluator) Match(ctx context.Context, rule models.AlertRule, now time.Time) (models.Alert, bool, error) {
+	alert := models.Alert{Rule: rule, TriggeredAt: now.UTC()}
+	pair := rule.QuoteCurrency + database.BaseCurrency
+
+	latest, err := e.DB.GetLastRate(ctx, rule.QuoteCurrency)
+	if errors.Is(err, database.ErrTimeout) {
+		return alert, false, err
+	}
+	if err != nil {
+		// no rates yet, no rule can hold
+		return alert, false, nil
+	}
+	alert.Rate = latest
+
+	switch rule.Type {
+	case models.AlertThreshold:
+		matched := latest.Rate.GreaterThan(rule.Value)
+		if rule.Condition == models.AlertBelow {
+			matched = latest.Rate.LessThan(rule.Value)
+		}
+		alert.Message = fmt.Sprintf("%s is %s on %s, %s %s", pair, latest.Rate.String(), latest.Date.Format("2006-01-02"), rule.Condition, rule.Value.String())
+		return alert, matched, nil
+
+	case models.AlertMove:
+		history, err := e.DB.GetRatesInRange(ctx, rule.QuoteCurrency, latest.Date.Add(-MoveLookback), latest.Date.AddDate(0, 0, -1))
+		if err != nil || len(history) == 0 {
+			return alert, false, err
+		}
+		previous := history[len(history)-1]
+		if previous.Rate.IsZero() {
+			return alert, false, nil
+		}
+		move := latest.Rate.Sub(previous.Rate).Div(previous.Rate).Mul(decimal.NewFromInt(100))
+		alert.Message = fmt.Sprintf(
+			"%s moved %s%% from %s on %s to %s on %s, more than %s%%",
+			pair,
+			move.StringFixed(2),
+			previous.Rate.String(),
+			previous.Date.Format("2006-01-02"),
+			latest.Rate.String(),
+			latest.Date.Format("2006-01-02"),
+			rule.Value.String(),
+		)
+		return alert, move.Abs().GreaterThan(rule.Value), nil
+
+	case models.AlertStale:
+		missed := BusinessDaysSince(latest.Date, now)
+		alert.Message = fmt.Sprintf("no new %s rate for %d business days, the latest is from %s", pair, missed, latest.Date.Format("2006-01-02"))
+		return alert, missed >= rule.Value.IntPart(), nil
+	}
+
+	return alert, false, fmt.Errorf("unknown alert rule type %s", rule.Type)
+}
+
+// BusinessDaysSince - weekdays after date up to and including the day of now, holidays are not known
+func BusinessDaysSince(date time.Time, now time.Time) int64 {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var days int64
+	for day = day.AddDate(0, 0, 1); !day.After(today); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			days++
+		}
+	}
+
+	return days
+}
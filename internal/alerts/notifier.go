@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// Names of the notifiers a rule can pick
+const (
+	NotifierLog     = "log"
+	NotifierFile    = "file"
+	NotifierWebhook = "webhook"
+)
+
+// Notifier - sends alerts somewhere, the rule's Target says where for notifiers that need it
+type Notifier interface {
+	Notify(ctx context.Context, alert models.Alert) error
+}
+
+// LogNotifier - writes alerts to the standard logger
+type LogNotifier struct{}
+
+// Notify - logs the alert message
+func (LogNotifier) Notify(ctx context.Context, alert models.Alert) error {
+	log.Printf("alert rule %d: %s", alert.Rule.ID, alert.Message)
+
+	return nil
+}
+
+// FileNotifier - appends alerts as json lines to a file set up by the operator, rule targets are ignored so
+// API clients can't write anywhere else
+type FileNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Notify - appends the alert to the file
+func (f *FileNotifier) Notify(ctx context.Context, alert models.Alert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WebhookNotifier - posts alerts as json to the rule's target url
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+// NewWebhookNotifier - returns a webhook notifier whose requests give up after timeout
+func NewWebhookNotifier(timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{Client: &http.Client{Timeout: timeout}}
+}
+
+// Notify - posts the alert, anything but a 2xx answer is an error
+func (n *WebhookNotifier) Notify(ctx context.Context, alert models.Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.Rule.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+)
+
+// Config - cache size and how long entries are served before they are read again
+type Config struct {
+	// Size - maximum number of cached results, least recently used are evicted first
+	Size int
+	// LatestTTL - lifetime of GetLastRate results
+	LatestTTL time.Duration
+	// HistoryTTL - lifetime of GetRatesInRange and GetAllRatesOnDate results, past fixings rarely change
+	HistoryTTL time.Duration
+}
+
+// DefaultConfig - used when the CACHE_* env vars are not set
+var DefaultConfig = Config{
+	Size:       1024,
+	LatestTTL:  time.Minute,
+	HistoryTTL: time.Hour,
+}
+
+// Stats - cache counters since start
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// Cache - read-through cache wrapping any DatabaseRepo, calls it doesn't cache go straight to the wrapped repo
+type Cache struct {
+	repository.DatabaseRepo
+	config Config
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+	hits    uint64
+	misses  uint64
+	// generation - counts invalidations, so a result read before one isn't stored after it
+	generation uint64
+}
+
+// entry - one cached result, the currency and dates are kept to find entries a new rate affects
+type entry struct {
+	key       string
+	currency  string // empty for GetAllRatesOnDate
+	from      time.Time
+	to        time.Time
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewCache - returns a pointer to a cache in front of repo
+func NewCache(repo repository.DatabaseRepo, config Config) *Cache {
+	return &Cache{
+		DatabaseRepo: repo,
+		config:       config,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// Stats - returns hit and miss counts
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.lru.Len(),
+	}
+}
+
+// get - returns a cached value that has not expired
+func (c *Cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		c.remove(el)
+		c.misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	c.hits++
+
+	return e.value, true
+}
+
+// readGeneration - taken before reading the wrapped repo and handed to set
+func (c *Cache) readGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// set - stores a value read at generation, evicting the least recently used entries past the size limit. Values
+// read before an invalidation are dropped, they may be older than the write that caused it
+func (c *Cache) set(e *entry, ttl time.Duration, generation uint64) {
+	if c.config.Size <= 0 {
+		return
+	}
+	e.expiresAt = time.Now().Add(ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.config.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Invalidate - drops every entry that could contain a rate for currency on date, used when another process
+// changed it
+func (c *Cache) Invalidate(currency string, date time.Time) {
+	c.invalidate(strings.ToTitle(currency), truncateDate(date), truncateDate(date))
+}
+
+// InvalidateRange - drops every entry that could contain a rate for currency between from and to, inclusive
+func (c *Cache) InvalidateRange(currency string, from time.Time, to time.Time) {
+	c.invalidate(strings.ToTitle(currency), truncateDate(from), truncateDate(to))
+}
+
+// Purge - drops every entry
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// invalidate - drops every entry that could contain a rate for currency between from and to
+func (c *Cache) invalidate(currency string, from time.Time, to time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, el := range c.entries {
+		e := el.Value.(*entry)
+		if e.currency != "" && e.currency != currency {
+			continue
+		}
+		if !e.from.IsZero() && (to.Before(e.from) || from.After(e.to)) {
+			continue
+		}
+		c.remove(el)
+	}
+}
+
+// remove - removes entry, callers must hold the lock
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// CreateRate - creates new rate and drops the cached results it changes
+func (c *Cache) CreateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	if err := c.DatabaseRepo.CreateRate(ctx, rate); err != nil {
+		return err
+	}
+
+	c.Invalidate(rate.QuoteCurrency, rate.Date)
+
+	return nil
+}
+
+// UpdateRate - updates a rate and drops the cached results it changes
+func (c *Cache) UpdateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	if err := repository.UpdateRate(ctx, c.DatabaseRepo, rate); err != nil {
+		return err
+	}
+
+	c.Invalidate(rate.QuoteCurrency, rate.Date)
+
+	return nil
+}
+
+// DeleteRate - deletes a rate and drops the cached results it changes
+func (c *Cache) DeleteRate(ctx context.Context, quoteCurrency string, date time.Time) error {
+	return c.DeleteRateOfType(ctx, quoteCurrency, date, models.RateMid)
+}
+
+// DeleteRateOfType - deletes a rate of rateType and drops the cached results it changes
+func (c *Cache) DeleteRateOfType(ctx context.Context, quoteCurrency string, date time.Time, rateType string) error {
+	if err := repository.DeleteRateOfType(ctx, c.DatabaseRepo, quoteCurrency, date, rateType); err != nil {
+		return err
+	}
+
+	c.Invalidate(quoteCurrency, date)
+
+	return nil
+}
+
+// GetLastRate - gets last rate available for quote currency
+func (c *Cache) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
+	return c.GetLastRateOfType(ctx, quoteCurrency, models.RateMid)
+}
+
+// GetLastRateOfType - gets last rate of rateType available for quote currency
+func (c *Cache) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+	key := "latest:" + rateType + ":" + quoteCurrency
+
+	if value, ok := c.get(key); ok {
+		return value.(models.CurrencyRate), nil
+	}
+	generation := c.readGeneration()
+
+	rate, err := repository.GetLastRateOfType(ctx, c.DatabaseRepo, quoteCurrency, rateType)
+	if err != nil {
+		return rate, err
+	}
+
+	// a new rate for any date may become the latest one, so the entry covers all dates
+	c.set(&entry{key: key, currency: quoteCurrency, value: rate}, c.config.LatestTTL, generation)
+
+	return rate, nil
+}
+
+// GetRatesInRange - gets rates for quote currency between two dates
+func (c *Cache) GetRatesInRange(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) ([]models.CurrencyRate, error) {
+	return c.GetRatesInRangeOfType(ctx, quoteCurrency, fromDate, toDate, models.RateMid)
+}
+
+// GetRatesInRangeOfType - gets rates of rateType for quote currency between two dates
+func (c *Cache) GetRatesInRangeOfType(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error) {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+	from := truncateDate(fromDate)
+	to := truncateDate(toDate)
+	key := "range:" + rateType + ":" + quoteCurrency + ":" + from.Format("2006-01-02") + ":" + to.Format("2006-01-02")
+
+	if value, ok := c.get(key); ok {
+		return copyRates(value.([]models.CurrencyRate)), nil
+	}
+	generation := c.readGeneration()
+
+	rates, err := repository.GetRatesInRangeOfType(ctx, c.DatabaseRepo, quoteCurrency, fromDate, toDate, rateType)
+	if err != nil {
+		return nil, err
+	}
+
+	c.set(&entry{key: key, currency: quoteCurrency, from: from, to: to, value: copyRates(rates)}, c.config.HistoryTTL, generation)
+
+	return rates, nil
+}
+
+// GetAllRatesOnDate - gets all available rates on date
+func (c *Cache) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.CurrencyRate, error) {
+	return c.GetAllRatesOnDateOfType(ctx, date, models.RateMid)
+}
+
+// GetAllRatesOnDateOfType - gets all available rates of rateType on date
+func (c *Cache) GetAllRatesOnDateOfType(ctx context.Context, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	date = truncateDate(date)
+	key := "date:" + rateType + ":" + date.Format("2006-01-02")
+
+	if value, ok := c.get(key); ok {
+		return copyRates(value.([]models.CurrencyRate)), nil
+	}
+	generation := c.readGeneration()
+
+	rates, err := repository.GetAllRatesOnDateOfType(ctx, c.DatabaseRepo, date, rateType)
+	if err != nil {
+		return nil, err
+	}
+
+	c.set(&entry{key: key, from: date, to: date, value: copyRates(rates)}, c.config.HistoryTTL, generation)
+
+	return rates, nil
+}
+
+// copyRates - callers get their own slice so they can't modify a cached one
+func copyRates(rates []models.CurrencyRate) []models.CurrencyRate {
+	if rates == nil {
+		return nil
+	}
+
+	result := make([]models.CurrencyRate, len(rates))
+	copy(result, rates)
+
+	return result
+}
+
+// truncateDate - drops the time of day so dates compare the same way as the db date column
+func truncateDate(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StreamRates - exports are too big to cache, they always go to the wrapped repo
+func (c *Cache) StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	return repository.StreamRates(ctx, c.DatabaseRepo, quoteCurrencies, fromDate, toDate, fn)
+}
+
+// StreamRatesOfType - exports of other rate types aren't cached either
+func (c *Cache) StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	return repository.StreamRatesOfType(ctx, c.DatabaseRepo, quoteCurrencies, fromDate, toDate, rateType, fn)
+}
+
+// GetRatesAsOf - batches go straight to the wrapped repo
+func (c *Cache) GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	return repository.GetRatesAsOf(ctx, c.DatabaseRepo, quoteCurrencies, date)
+}
+
+// Currencies - lists the currencies of the wrapped repo
+func (c *Cache) Currencies(ctx context.Context) ([]string, error) {
+	return repository.Currencies(ctx, c.DatabaseRepo)
+}
@@ -2,21 +2,19 @@ package database
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"sort"
 	"strings"
 	"time"
 
+	repository "github.com/Shambou/golang-challenge/internal/database"
 	"github.com/Shambou/golang-challenge/internal/models"
-	"github.com/shopspring/decimal"
 )
 
-type CSV [][]string
-
 // CreateRate - creates new rate in db
 func (f *File) CreateRate(ctx context.Context, rate *models.CurrencyRate) error {
 	return nil
@@ -24,62 +22,73 @@ func (f *File) CreateRate(ctx context.Context, rate *models.CurrencyRate) error
 
 // GetLastRate - gets last rate available for
 func (f *File) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
-	symbol := strings.ToTitle(quoteCurrency) + f.BaseCurrency
-	ratePath := f.FxPath + symbol + f.Ext
-
-	csvFile, err := os.Open(ratePath)
-	if err != nil {
-		log.Println(err)
-		return models.CurrencyRate{}, err
+	idx, err := f.index(quoteCurrency)
+	if errors.Is(err, fs.ErrNotExist) {
+		return models.CurrencyRate{}, fmt.Errorf("%w for %s", repository.ErrNoRates, strings.ToTitle(quoteCurrency))
 	}
-	defer csvFile.Close()
-
-	// read csv values using csv.Reader
-	csvReader := csv.NewReader(csvFile)
-	data, err := csvReader.ReadAll()
 	if err != nil {
 		log.Println(err)
 		return models.CurrencyRate{}, err
 	}
 
-	data = data[1:]
-
-	sort.Sort(CSV(data))
-
-	date, err := time.Parse("2006-01-02", data[0][0])
-	if err != nil {
-		return models.CurrencyRate{}, errors.New("invalid date")
-	}
-	rate, err := decimal.NewFromString(data[0][1])
-	if err != nil {
-		return models.CurrencyRate{}, errors.New("invalid rate")
-	}
-
-	currencyRate := models.CurrencyRate{
-		BaseCurrency:  f.BaseCurrency,
-		QuoteCurrency: strings.ToTitle(quoteCurrency),
-		Date:          date,
-		Rate:          rate,
+	rate, ok := idx.last()
+	if !ok {
+		return models.CurrencyRate{}, fmt.Errorf("%w for %s", repository.ErrNoRates, strings.ToTitle(quoteCurrency))
 	}
 
-	fmt.Println("rate object ", currencyRate)
-
-	return currencyRate, nil
+	return rate, nil
 }
 
 func (f *File) GetRatesInRange(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) ([]models.CurrencyRate, error) {
-	var rates []models.CurrencyRate
-	return rates, nil
+	idx, err := f.index(quoteCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.between(fromDate, toDate), nil
 }
 
 // CheckRateQuoteOnDateExists - Checks if rate exists in db
 func (f *File) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency string, date time.Time) bool {
-	return false
+	idx, err := f.index(quoteCurrency)
+	if err != nil {
+		return false
+	}
+
+	_, ok := idx.on(date)
+
+	return ok
 }
 
 // GetAllRatesOnDate - gets all available rates on date
 func (f *File) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.CurrencyRate, error) {
 	var rates []models.CurrencyRate
+
+	entries, err := os.ReadDir(f.FxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := f.BaseCurrency + f.Ext
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		idx, err := f.index(strings.TrimSuffix(name, suffix))
+		if err != nil {
+			return nil, err
+		}
+		if rate, ok := idx.on(date); ok {
+			rates = append(rates, rate)
+		}
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].QuoteCurrency < rates[j].QuoteCurrency
+	})
+
 	return rates, nil
 }
 
@@ -87,21 +96,3 @@ func (f *File) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.
 func (f *File) TableSeeded(ctx context.Context) bool {
 	return true
 }
-
-// Other functions required for sort.Sort.
-func (data CSV) Len() int {
-	return len(data)
-}
-func (data CSV) Swap(i, j int) {
-	data[i], data[j] = data[j], data[i]
-}
-
-func (data CSV) Less(i, j int) bool {
-	dateColumnIndex := 0
-	date1 := data[i][dateColumnIndex]
-	date2 := data[j][dateColumnIndex]
-	timeT1, _ := time.Parse("2006-01-02", date1)
-	timeT2, _ := time.Parse("2006-01-02", date2)
-
-	return timeT1.After(timeT2)
-}
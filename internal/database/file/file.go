@@ -2,12 +2,22 @@ package database
 
 import (
 	"context"
+	"sync"
+	"time"
 )
 
+// DefaultPollInterval - how often a file is checked for changes when it is looked up
+const DefaultPollInterval = time.Second
+
 type File struct {
 	BaseCurrency string
 	FxPath       string
 	Ext          string
+	// PollInterval - minimum time between mtime checks of an indexed file, zero checks on every lookup
+	PollInterval time.Duration
+
+	mu      sync.RWMutex
+	indexes map[string]*index
 }
 
 // NewFile - returns a pointer to a file struct
@@ -16,6 +26,8 @@ func NewFile(baseCurrency string, fxPath string, ext string) *File {
 		BaseCurrency: baseCurrency,
 		FxPath:       fxPath,
 		Ext:          ext,
+		PollInterval: DefaultPollInterval,
+		indexes:      make(map[string]*index),
 	}
 }
 
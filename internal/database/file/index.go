@@ -0,0 +1,159 @@
+package database
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// index - parsed content of one fxdata file, rates are never modified once built
+type index struct {
+	modTime time.Time
+	size    int64
+	// checkedAt - when the file was last stat'ed, only written while File.mu is write locked
+	checkedAt time.Time
+	rates     []models.CurrencyRate // sorted by date ascending
+}
+
+// last - returns the most recent rate
+func (idx *index) last() (models.CurrencyRate, bool) {
+	if len(idx.rates) == 0 {
+		return models.CurrencyRate{}, false
+	}
+
+	return idx.rates[len(idx.rates)-1], true
+}
+
+// search - returns index of the first rate on or after date
+func (idx *index) search(date time.Time) int {
+	return sort.Search(len(idx.rates), func(i int) bool {
+		return !idx.rates[i].Date.Before(date)
+	})
+}
+
+// on - returns the rate on date
+func (idx *index) on(date time.Time) (models.CurrencyRate, bool) {
+	i := idx.search(date)
+	if i < len(idx.rates) && idx.rates[i].Date.Equal(date) {
+		return idx.rates[i], true
+	}
+
+	return models.CurrencyRate{}, false
+}
+
+// between - returns the rates between two dates, inclusive
+func (idx *index) between(from time.Time, to time.Time) []models.CurrencyRate {
+	start := idx.search(from)
+	end := sort.Search(len(idx.rates), func(i int) bool {
+		return idx.rates[i].Date.After(to)
+	})
+	if start >= end {
+		return nil
+	}
+
+	rates := make([]models.CurrencyRate, end-start)
+	copy(rates, idx.rates[start:end])
+
+	return rates
+}
+
+// index - returns the index for quote currency, the file is parsed on first use and again whenever its mtime or size changes
+func (f *File) index(quoteCurrency string) (*index, error) {
+	symbol := strings.ToTitle(quoteCurrency) + f.BaseCurrency
+
+	f.mu.RLock()
+	idx, ok := f.indexes[symbol]
+	fresh := ok && time.Since(idx.checkedAt) < f.PollInterval
+	f.mu.RUnlock()
+	if fresh {
+		return idx, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// another request may have refreshed it while we were waiting for the lock
+	idx, ok = f.indexes[symbol]
+	if ok && time.Since(idx.checkedAt) < f.PollInterval {
+		return idx, nil
+	}
+
+	ratePath := f.FxPath + symbol + f.Ext
+	info, err := os.Stat(ratePath)
+	if err != nil {
+		delete(f.indexes, symbol)
+		return nil, err
+	}
+
+	if ok && info.ModTime().Equal(idx.modTime) && info.Size() == idx.size {
+		idx.checkedAt = time.Now()
+		return idx, nil
+	}
+
+	idx, err = f.load(ratePath, strings.ToTitle(quoteCurrency))
+	if err != nil {
+		return nil, err
+	}
+	idx.modTime = info.ModTime()
+	idx.size = info.Size()
+	idx.checkedAt = time.Now()
+	f.indexes[symbol] = idx
+
+	return idx, nil
+}
+
+// load - parses a fxdata csv file into an index, rows without a valid date or rate are skipped
+func (f *File) load(ratePath string, quoteCurrency string) (*index, error) {
+	csvFile, err := os.Open(ratePath)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	csvReader := csv.NewReader(csvFile)
+	// skip header
+	if _, err := csvReader.Read(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read header of %s: %w", ratePath, err)
+	}
+
+	idx := &index{}
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", ratePath, err)
+		}
+
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		rate, err := decimal.NewFromString(row[1])
+		if err != nil {
+			continue
+		}
+
+		idx.rates = append(idx.rates, models.CurrencyRate{
+			BaseCurrency:  f.BaseCurrency,
+			QuoteCurrency: quoteCurrency,
+			Date:          date,
+			Rate:          rate,
+		})
+	}
+
+	// files are usually in date order already, sorting only costs something when they are not
+	sort.SliceStable(idx.rates, func(i, j int) bool {
+		return idx.rates[i].Date.Before(idx.rates[j].Date)
+	})
+
+	return idx, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// CreateAlertRule - stores a new rule
+func (m *Memory) CreateAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextAlertRuleID++
+	rule.ID = m.nextAlertRuleID
+	rule.QuoteCurrency = strings.ToTitle(rule.QuoteCurrency)
+	rule.Active = false
+	rule.TriggeredAt = nil
+	rule.CreatedAt = time.Now().UTC()
+	m.alertRules = append(m.alertRules, *rule)
+
+	return nil
+}
+
+// AlertRules - rules of the quote currencies in id order
+func (m *Memory) AlertRules(ctx context.Context, quoteCurrencies []string) ([]models.AlertRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(quoteCurrencies))
+	for _, currency := range quoteCurrencies {
+		wanted[strings.ToTitle(currency)] = true
+	}
+
+	var rules []models.AlertRule
+	for _, rule := range m.alertRules {
+		if len(wanted) == 0 || wanted[rule.QuoteCurrency] {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// GetAlertRule - returns ErrAlertRuleNotFound if there is no rule with id
+func (m *Memory) GetAlertRule(ctx context.Context, id int64) (models.AlertRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if i := m.alertRuleIndex(id); i >= 0 {
+		return m.alertRules[i], nil
+	}
+
+	return models.AlertRule{}, repository.ErrAlertRuleNotFound
+}
+
+// DeleteAlertRule - removes the rule
+func (m *Memory) DeleteAlertRule(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.alertRuleIndex(id)
+	if i < 0 {
+		return repository.ErrAlertRuleNotFound
+	}
+	m.alertRules = append(m.alertRules[:i], m.alertRules[i+1:]...)
+
+	return nil
+}
+
+// SetAlertRuleState - stores whether the condition of the rule holds
+func (m *Memory) SetAlertRuleState(ctx context.Context, id int64, active bool, triggeredAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.alertRuleIndex(id)
+	if i < 0 {
+		return repository.ErrAlertRuleNotFound
+	}
+	m.alertRules[i].Active = active
+	m.alertRules[i].TriggeredAt = triggeredAt
+
+	return nil
+}
+
+// ClaimAlertRule - makes the rule active unless it is already
+func (m *Memory) ClaimAlertRule(ctx context.Context, id int64, triggeredAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.alertRuleIndex(id)
+	if i < 0 || m.alertRules[i].Active {
+		return false, nil
+	}
+	m.alertRules[i].Active = true
+	m.alertRules[i].TriggeredAt = &triggeredAt
+
+	return true, nil
+}
+
+// alertRuleIndex - position of the rule with id, -1 when there is none. The caller holds the lock
+func (m *Memory) alertRuleIndex(id int64) int {
+	for i, rule := range m.alertRules {
+		if rule.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
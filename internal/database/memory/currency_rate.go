@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// CreateRate - creates new rate in memory, returns ErrRateExists if the currency already has a rate of that type
+// on that date
+func (m *Memory) CreateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	rate.BaseCurrency = m.BaseCurrency
+	rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+	rate.Type = models.RateType(rate.Type)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.insert(*rate); err != nil {
+		return err
+	}
+	rate.ID = m.nextID
+
+	return nil
+}
+
+// GetLastRate - gets last rate available for quote currency
+func (m *Memory) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
+	return m.GetLastRateOfType(ctx, quoteCurrency, models.RateMid)
+}
+
+// GetLastRateOfType - gets last rate of rateType available for quote currency
+func (m *Memory) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := m.ratesOf(rateType)[quoteCurrency]
+	if len(rates) == 0 {
+		return models.CurrencyRate{}, fmt.Errorf("%w for %s", repository.ErrNoRates, quoteCurrency)
+	}
+
+	return rates[len(rates)-1], nil
+}
+
+// GetRatesInRange - gets rates for quote currency between two dates, inclusive
+func (m *Memory) GetRatesInRange(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) ([]models.CurrencyRate, error) {
+	return m.GetRatesInRangeOfType(ctx, quoteCurrency, fromDate, toDate, models.RateMid)
+}
+
+// GetRatesInRangeOfType - gets rates of rateType for quote currency between two dates, inclusive
+func (m *Memory) GetRatesInRangeOfType(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error) {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+	from := truncateDate(fromDate)
+	to := truncateDate(toDate)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := m.ratesOf(rateType)[quoteCurrency]
+	start := searchDate(rates, from)
+	end := sort.Search(len(rates), func(i int) bool {
+		return rates[i].Date.After(to)
+	})
+	if start >= end {
+		return nil, nil
+	}
+
+	result := make([]models.CurrencyRate, end-start)
+	copy(result, rates[start:end])
+
+	return result, nil
+}
+
+// GetAllRatesOnDate - gets all available rates on date
+func (m *Memory) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.CurrencyRate, error) {
+	return m.GetAllRatesOnDateOfType(ctx, date, models.RateMid)
+}
+
+// GetAllRatesOnDateOfType - gets all available rates of rateType on date
+func (m *Memory) GetAllRatesOnDateOfType(ctx context.Context, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	date = truncateDate(date)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []models.CurrencyRate
+	for _, rates := range m.ratesOf(rateType) {
+		i := searchDate(rates, date)
+		if i < len(rates) && rates[i].Date.Equal(date) {
+			result = append(result, rates[i])
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].QuoteCurrency < result[j].QuoteCurrency
+	})
+
+	return result, nil
+}
+
+// CheckRateQuoteOnDateExists - Checks if rate exists in memory
+func (m *Memory) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency string, date time.Time) bool {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+	date = truncateDate(date)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := m.rates[quoteCurrency]
+	i := searchDate(rates, date)
+
+	return i < len(rates) && rates[i].Date.Equal(date)
+}
+
+// TableSeeded - checks if any rate is stored
+func (m *Memory) TableSeeded(ctx context.Context) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.rates) > 0
+}
+
+// UpdateRate - changes the rate of the currency on the date and of the type of rate, returns ErrRateNotFound if
+// there is none
+func (m *Memory) UpdateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	rate.BaseCurrency = m.BaseCurrency
+	rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+	rate.Type = models.RateType(rate.Type)
+	date := truncateDate(rate.Date)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rates := m.ratesOf(rate.Type)[rate.QuoteCurrency]
+	i := searchDate(rates, date)
+	if i == len(rates) || !rates[i].Date.Equal(date) {
+		return repository.ErrRateNotFound
+	}
+	rates[i].Rate = rate.Rate
+	rate.ID = rates[i].ID
+	m.record(models.RateEventUpdated, rates[i])
+
+	return nil
+}
+
+// DeleteRate - removes the mid rate of the currency on date, returns ErrRateNotFound if there is none
+func (m *Memory) DeleteRate(ctx context.Context, quoteCurrency string, date time.Time) error {
+	return m.DeleteRateOfType(ctx, quoteCurrency, date, models.RateMid)
+}
+
+// DeleteRateOfType - removes the rate of rateType of the currency on date, returns ErrRateNotFound if there is none
+func (m *Memory) DeleteRateOfType(ctx context.Context, quoteCurrency string, date time.Time, rateType string) error {
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+	date = truncateDate(date)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := m.ratesOf(rateType)
+	rates := index[quoteCurrency]
+	i := searchDate(rates, date)
+	if i == len(rates) || !rates[i].Date.Equal(date) {
+		return repository.ErrRateNotFound
+	}
+	deleted := rates[i]
+	rates = append(rates[:i], rates[i+1:]...)
+	if len(rates) == 0 {
+		delete(index, quoteCurrency)
+	} else {
+		index[quoteCurrency] = rates
+	}
+	m.record(models.RateEventDeleted, deleted)
+
+	return nil
+}
+
+// ratesOf - index of the rates of rateType, nil for an unknown type. Callers must hold the lock, and the write lock
+// to change it
+func (m *Memory) ratesOf(rateType string) map[string][]models.CurrencyRate {
+	if rateType = models.RateType(rateType); rateType == models.RateMid {
+		return m.rates
+	}
+
+	return m.typed[rateType]
+}
+
+// record - records the event and outbox message of a change, only mid rates are published
+func (m *Memory) record(eventType string, rate models.CurrencyRate) {
+	if rate.Type != models.RateMid {
+		return
+	}
+	m.recordEvent(eventType, rate)
+	m.recordOutbox(eventType, rate)
+}
+
+// insert - adds rate to its currency index keeping it sorted by date, callers must hold the write lock
+func (m *Memory) insert(rate models.CurrencyRate) error {
+	rate.Date = truncateDate(rate.Date)
+	rate.Type = models.RateType(rate.Type)
+	index := m.ratesOf(rate.Type)
+	if index == nil {
+		return fmt.Errorf("unknown rate type %q", rate.Type)
+	}
+	rates := index[rate.QuoteCurrency]
+
+	i := searchDate(rates, rate.Date)
+	if i < len(rates) && rates[i].Date.Equal(rate.Date) {
+		return repository.ErrRateExists
+	}
+
+	m.nextID++
+	rate.ID = m.nextID
+
+	rates = append(rates, models.CurrencyRate{})
+	copy(rates[i+1:], rates[i:])
+	rates[i] = rate
+	index[rate.QuoteCurrency] = rates
+	m.record(models.RateEventCreated, rate)
+
+	return nil
+}
+
+// searchDate - returns index of the first rate on or after date
+func searchDate(rates []models.CurrencyRate, date time.Time) int {
+	return sort.Search(len(rates), func(i int) bool {
+		return !rates[i].Date.Before(date)
+	})
+}
+
+// truncateDate - drops the time of day so dates compare the same way as the db date column
+func truncateDate(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StreamRates - passes on rates between two dates ordered by quote currency and date, no quote currencies means
+// all of them. The store is read locked until fn has seen every rate
+func (m *Memory) StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	return m.StreamRatesOfType(ctx, quoteCurrencies, fromDate, toDate, models.RateMid, fn)
+}
+
+// StreamRatesOfType - passes on rates of rateType like StreamRates
+func (m *Memory) StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	from := truncateDate(fromDate)
+	to := truncateDate(toDate)
+
+	currencies := make([]string, 0, len(quoteCurrencies))
+	for _, currency := range quoteCurrencies {
+		currencies = append(currencies, strings.ToTitle(currency))
+	}
+	if len(currencies) == 0 {
+		m.mu.RLock()
+		for currency := range m.ratesOf(rateType) {
+			currencies = append(currencies, currency)
+		}
+		m.mu.RUnlock()
+	}
+	sort.Strings(currencies)
+
+	// the rates of a currency are copied so fn runs without the lock, a slow consumer must not block writers
+	for _, currency := range currencies {
+		m.mu.RLock()
+		rates := m.ratesOf(rateType)[currency]
+		i := searchDate(rates, from)
+		j := i
+		for j < len(rates) && !rates[j].Date.After(to) {
+			j++
+		}
+		rates = append([]models.CurrencyRate(nil), rates[i:j]...)
+		m.mu.RUnlock()
+
+		for _, rate := range rates {
+			if err := ctx.Err(); err != nil {
+				return repository.WrapTimeout(ctx, err)
+			}
+			if err := fn(rate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetRatesAsOf - newest rate on or before date of every quote currency
+func (m *Memory) GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	next := truncateDate(date).AddDate(0, 0, 1)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rates []models.CurrencyRate
+	for _, currency := range quoteCurrencies {
+		history := m.rates[strings.ToTitle(currency)]
+		if i := searchDate(history, next); i > 0 {
+			rates = append(rates, history[i-1])
+		}
+	}
+
+	return rates, nil
+}
+
+// Currencies - quote currencies that have rates
+func (m *Memory) Currencies(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	currencies := make([]string, 0, len(m.rates))
+	for currency := range m.rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	return currencies, nil
+}
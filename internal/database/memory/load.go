@@ -0,0 +1,83 @@
+package database
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// LoadDir - loads every file with the given extension in dir, e.g. LoadDir("fxdata", ".csv")
+func (m *Memory) LoadDir(dir string, ext string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, e error) error {
+		if e != nil {
+			return e
+		}
+		if d.IsDir() || filepath.Ext(d.Name()) != ext {
+			return nil
+		}
+
+		return m.LoadCSV(path)
+	})
+}
+
+// LoadCSV - loads a fxdata csv file, the quote currency is taken from the file name (CHFUSD.csv)
+func (m *Memory) LoadCSV(path string) error {
+	name := filepath.Base(path)
+	if len(name) < 6 {
+		return fmt.Errorf("invalid fxdata file name %s", name)
+	}
+	quoteCurrency := strings.ToTitle(name[0:3])
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	// skip header
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("could not read header of %s: %w", path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", path, err)
+		}
+
+		var rate models.CurrencyRate
+		rate.BaseCurrency = m.BaseCurrency
+		rate.QuoteCurrency = quoteCurrency
+
+		// rows with missing values are skipped, same as the seeder does
+		rate.Date, err = time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		rate.Rate, err = decimal.NewFromString(row[1])
+		if err != nil {
+			continue
+		}
+
+		if err := m.insert(rate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// Memory - in-memory rates store, safe for concurrent use
+type Memory struct {
+	BaseCurrency string
+
+	mu     sync.RWMutex
+	rates  map[string][]models.CurrencyRate            // mid rates per quote currency, sorted by date ascending
+	typed  map[string]map[string][]models.CurrencyRate // bid, ask and fixing rates per type, kept like rates
+	nextID int
+	events []models.RateEvent
+	// prunedEvents - events deleted from the front of events, the id of an event is its position plus this plus one
+	prunedEvents int64
+
+	webhooks       []models.Webhook
+	deliveries     []models.WebhookDelivery // in id order
+	nextWebhookID  int64
+	nextDeliveryID int64
+	cursor         *int64
+
+	alertRules      []models.AlertRule
+	nextAlertRuleID int64
+
+	outbox        []models.OutboxMessage
+	outboxOffsets map[string]*outboxOffset
+	// prunedOutbox - messages deleted from the front of outbox, ids are kept like those of events
+	prunedOutbox int64
+
+	sources map[string][]models.SourceRate // per quote currency, sorted by date and source
+
+	providerRuns map[string]*providerRun
+}
+
+// NewMemory - returns a pointer to an empty in-memory store
+func NewMemory(baseCurrency string) *Memory {
+	m := &Memory{
+		BaseCurrency: baseCurrency,
+		rates:        make(map[string][]models.CurrencyRate),
+		typed:        make(map[string]map[string][]models.CurrencyRate),
+	}
+	for _, rateType := range models.RateTypes {
+		if rateType != models.RateMid {
+			m.typed[rateType] = make(map[string][]models.CurrencyRate)
+		}
+	}
+
+	return m
+}
+
+// Ping - pings the db
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
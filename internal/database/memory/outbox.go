@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// outboxOffset - how far a sink got and who publishes to it
+type outboxOffset struct {
+	lastID      int64
+	owner       string
+	lockedUntil time.Time
+}
+
+// recordOutbox - keeps the outbox message of a changed rate, the caller holds the write lock
+func (m *Memory) recordOutbox(eventType string, rate models.CurrencyRate) {
+	payload, _ := json.Marshal(map[string]string{
+		"date":           rate.Date.Format("2006-01-02"),
+		"base_currency":  rate.BaseCurrency,
+		"quote_currency": rate.QuoteCurrency,
+		"rate":           rate.Rate.String(),
+	})
+	m.outbox = append(m.outbox, models.OutboxMessage{
+		ID:        m.prunedOutbox + int64(len(m.outbox)) + 1,
+		Topic:     "rates." + rate.QuoteCurrency,
+		Type:      eventType,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// OutboxSince - messages after afterID, the id of a message is its position in the list plus the pruned ones plus one
+func (m *Memory) OutboxSince(ctx context.Context, afterID int64, limit int) ([]models.OutboxMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := afterID - m.prunedOutbox
+	if start < 0 {
+		start = 0
+	}
+
+	var messages []models.OutboxMessage
+	for i := start; i < int64(len(m.outbox)) && len(messages) < limit; i++ {
+		messages = append(messages, m.outbox[i])
+	}
+
+	return messages, nil
+}
+
+// ClaimOutboxSink - makes owner the only publisher to sink until lease runs out, a new sink starts after the newest
+// message
+func (m *Memory) ClaimOutboxSink(ctx context.Context, sink string, owner string, lease time.Duration) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.outboxOffsets == nil {
+		m.outboxOffsets = make(map[string]*outboxOffset)
+	}
+	offset, ok := m.outboxOffsets[sink]
+	if !ok {
+		offset = &outboxOffset{lastID: m.prunedOutbox + int64(len(m.outbox))}
+		m.outboxOffsets[sink] = offset
+	}
+	if offset.owner != owner && offset.lockedUntil.After(now) {
+		return 0, false, nil
+	}
+	offset.owner = owner
+	offset.lockedUntil = now.Add(lease)
+
+	return offset.lastID, true, nil
+}
+
+// SetOutboxOffset - stores the id of the last message published to sink while owner holds it
+func (m *Memory) SetOutboxOffset(ctx context.Context, sink string, owner string, lastID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offset, ok := m.outboxOffsets[sink]
+	if !ok || offset.owner != owner {
+		return false, nil
+	}
+	offset.lastID = lastID
+
+	return true, nil
+}
+
+// DeleteOutboxSink - drops the offset of sink while owner holds it
+func (m *Memory) DeleteOutboxSink(ctx context.Context, sink string, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if offset, ok := m.outboxOffsets[sink]; ok && offset.owner == owner {
+		delete(m.outboxOffsets, sink)
+	}
+
+	return nil
+}
+
+// PruneOutbox - drops the offsets of sinks not claimed since before, then the messages created before before that
+// every sink left published
+func (m *Memory) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upTo := m.prunedOutbox + int64(len(m.outbox))
+	for sink, offset := range m.outboxOffsets {
+		switch {
+		case offset.lockedUntil.Before(before):
+			delete(m.outboxOffsets, sink)
+		case offset.lastID < upTo:
+			upTo = offset.lastID
+		}
+	}
+
+	var pruned int64
+	for pruned < int64(len(m.outbox)) && m.outbox[pruned].ID <= upTo && m.outbox[pruned].CreatedAt.Before(before) {
+		pruned++
+	}
+	m.outbox = append([]models.OutboxMessage{}, m.outbox[pruned:]...)
+	m.prunedOutbox += pruned
+
+	return pruned, nil
+}
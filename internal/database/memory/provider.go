@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// providerRun - the latest daily fetch of a provider and who fetches it
+type providerRun struct {
+	day         time.Time
+	owner       string
+	lockedUntil time.Time
+	done        bool
+}
+
+// ClaimProviderRun - makes owner the only process fetching the rates of provider on day until lease runs out, a
+// later day replaces the run of the day before
+func (m *Memory) ClaimProviderRun(ctx context.Context, provider string, day time.Time, owner string, lease time.Duration) (bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	day = truncateDate(day.UTC())
+	if m.providerRuns == nil {
+		m.providerRuns = make(map[string]*providerRun)
+	}
+	run, ok := m.providerRuns[provider]
+	switch {
+	case !ok || run.day.Before(day):
+		run = &providerRun{day: day}
+		m.providerRuns[provider] = run
+	case run.day.After(day) || run.done:
+		return false, true, nil
+	case run.owner != owner && run.lockedUntil.After(now):
+		return false, false, nil
+	}
+	run.owner = owner
+	run.lockedUntil = now.Add(lease)
+
+	return true, false, nil
+}
+
+// FinishProviderRun - marks the fetch of provider on day done while owner holds it
+func (m *Memory) FinishProviderRun(ctx context.Context, provider string, day time.Time, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if run, ok := m.providerRuns[provider]; ok && run.day.Equal(truncateDate(day.UTC())) && run.owner == owner {
+		run.done = true
+	}
+
+	return nil
+}
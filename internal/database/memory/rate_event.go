@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// recordEvent - keeps the event of a stored rate, the caller holds the write lock
+func (m *Memory) recordEvent(eventType string, rate models.CurrencyRate) {
+	m.events = append(m.events, models.RateEvent{
+		ID:            m.prunedEvents + int64(len(m.events)) + 1,
+		Type:          eventType,
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate,
+		Date:          rate.Date,
+		CreatedAt:     time.Now().UTC(),
+	})
+}
+
+// EventsSince - events after afterID, the id of an event is its position in the list plus the pruned ones plus one
+func (m *Memory) EventsSince(ctx context.Context, afterID int64, quoteCurrencies []string, limit int) ([]models.RateEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(quoteCurrencies))
+	for _, currency := range quoteCurrencies {
+		wanted[currency] = true
+	}
+
+	start := afterID - m.prunedEvents
+	if start < 0 {
+		start = 0
+	}
+
+	var events []models.RateEvent
+	for i := start; i < int64(len(m.events)) && len(events) < limit; i++ {
+		if event := m.events[i]; len(wanted) == 0 || wanted[event.QuoteCurrency] {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// LastEventID - id of the newest event
+func (m *Memory) LastEventID(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.prunedEvents + int64(len(m.events)), nil
+}
+
+// PruneEvents - deletes the events created before before that the webhook cursor is past, all of them when no
+// webhook is registered
+func (m *Memory) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upTo := m.prunedEvents + int64(len(m.events))
+	if m.cursor != nil {
+		upTo = *m.cursor
+	}
+
+	var pruned int64
+	for pruned < int64(len(m.events)) && m.events[pruned].ID <= upTo && m.events[pruned].CreatedAt.Before(before) {
+		pruned++
+	}
+	m.events = append([]models.RateEvent{}, m.events[pruned:]...)
+	m.prunedEvents += pruned
+
+	return pruned, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// SaveSourceRates - stores the values, a source giving a currency and date again replaces its value
+func (m *Memory) SaveSourceRates(ctx context.Context, rates []models.SourceRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sources == nil {
+		m.sources = make(map[string][]models.SourceRate)
+	}
+	now := time.Now().UTC()
+	for _, rate := range rates {
+		rate.BaseCurrency = m.BaseCurrency
+		rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+		rate.Date = truncateDate(rate.Date)
+		rate.UpdatedAt = now
+
+		values := m.sources[rate.QuoteCurrency]
+		i := sort.Search(len(values), func(i int) bool {
+			return !values[i].Date.Before(rate.Date) && (values[i].Date.After(rate.Date) || values[i].Source >= rate.Source)
+		})
+		if i < len(values) && values[i].Date.Equal(rate.Date) && values[i].Source == rate.Source {
+			values[i] = rate
+			continue
+		}
+		values = append(values, models.SourceRate{})
+		copy(values[i+1:], values[i:])
+		values[i] = rate
+		m.sources[rate.QuoteCurrency] = values
+	}
+
+	return nil
+}
+
+// SourceRates - values of the quote currencies between two dates ordered by currency, date and source
+func (m *Memory) SourceRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time) ([]models.SourceRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(quoteCurrencies) == 0 {
+		for currency := range m.sources {
+			quoteCurrencies = append(quoteCurrencies, currency)
+		}
+	}
+	currencies := make([]string, len(quoteCurrencies))
+	for i, currency := range quoteCurrencies {
+		currencies[i] = strings.ToTitle(currency)
+	}
+	sort.Strings(currencies)
+
+	from, to := truncateDate(fromDate), truncateDate(toDate)
+	var rates []models.SourceRate
+	for _, currency := range currencies {
+		values := m.sources[currency]
+		for i := searchSourceDate(values, from); i < len(values) && !values[i].Date.After(to); i++ {
+			rates = append(rates, values[i])
+		}
+	}
+
+	return rates, nil
+}
+
+// searchSourceDate - returns index of the first value on or after date
+func searchSourceDate(values []models.SourceRate, date time.Time) int {
+	return sort.Search(len(values), func(i int) bool {
+		return !values[i].Date.Before(date)
+	})
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// CreateWebhook - stores the webhook, the cursor starts at the newest event with the first webhook
+func (m *Memory) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextWebhookID++
+	webhook.ID = m.nextWebhookID
+	webhook.AfterEventID = m.prunedEvents + int64(len(m.events))
+	webhook.CreatedAt = time.Now().UTC()
+	webhook.Currencies = append([]string{}, webhook.Currencies...)
+	m.webhooks = append(m.webhooks, *webhook)
+	if m.cursor == nil {
+		last := webhook.AfterEventID
+		m.cursor = &last
+	}
+
+	return nil
+}
+
+// Webhooks - every webhook in id order
+func (m *Memory) Webhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]models.Webhook{}, m.webhooks...), nil
+}
+
+// GetWebhook - returns ErrWebhookNotFound if there is no webhook with id
+func (m *Memory) GetWebhook(ctx context.Context, id int64) (models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+
+	return models.Webhook{}, repository.ErrWebhookNotFound
+}
+
+// DeleteWebhook - removes the webhook and its deliveries
+func (m *Memory) DeleteWebhook(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, webhook := range m.webhooks {
+		if webhook.ID != id {
+			continue
+		}
+		m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+
+		deliveries := m.deliveries[:0]
+		for _, delivery := range m.deliveries {
+			if delivery.WebhookID != id {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		m.deliveries = deliveries
+
+		return nil
+	}
+
+	return repository.ErrWebhookNotFound
+}
+
+// WebhookCursor - id of the last event turned into deliveries
+func (m *Memory) WebhookCursor(ctx context.Context) (int64, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cursor == nil {
+		return 0, false, nil
+	}
+
+	return *m.cursor, true, nil
+}
+
+// EnqueueDeliveries - queues deliveries and moves the cursor if it is still at afterID
+func (m *Memory) EnqueueDeliveries(ctx context.Context, afterID int64, lastID int64, deliveries []models.WebhookDelivery) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cursor == nil || *m.cursor != afterID {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	for _, delivery := range deliveries {
+		m.nextDeliveryID++
+		delivery.ID = m.nextDeliveryID
+		delivery.Status = models.DeliveryPending
+		delivery.NextAttemptAt = now
+		delivery.CreatedAt = now
+		m.deliveries = append(m.deliveries, delivery)
+	}
+	*m.cursor = lastID
+
+	return true, nil
+}
+
+// ClaimDeliveries - pending deliveries due at now, their next attempt is pushed back by lease
+func (m *Memory) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var claimed []models.WebhookDelivery
+	for i := range m.deliveries {
+		delivery := &m.deliveries[i]
+		if len(claimed) == limit {
+			break
+		}
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *delivery)
+	}
+
+	return claimed, nil
+}
+
+// UpdateDelivery - stores the outcome of an attempt
+func (m *Memory) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.deliveryIndex(delivery.ID)
+	if i < 0 {
+		return repository.ErrDeliveryNotFound
+	}
+	stored := &m.deliveries[i]
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+
+	return nil
+}
+
+// RequeueDelivery - makes the delivery pending and due at now unless it is pending and not due yet
+func (m *Memory) RequeueDelivery(ctx context.Context, id int64, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.deliveryIndex(id)
+	if i < 0 {
+		return false, repository.ErrDeliveryNotFound
+	}
+	stored := &m.deliveries[i]
+	if stored.Status == models.DeliveryPending && stored.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	stored.Status = models.DeliveryPending
+	stored.Attempts = 0
+	stored.NextAttemptAt = now
+	stored.LastError = ""
+	stored.DeliveredAt = nil
+
+	return true, nil
+}
+
+// GetDelivery - returns ErrDeliveryNotFound if there is no delivery with id
+func (m *Memory) GetDelivery(ctx context.Context, id int64) (models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.deliveryIndex(id)
+	if i < 0 {
+		return models.WebhookDelivery{}, repository.ErrDeliveryNotFound
+	}
+
+	return m.deliveries[i], nil
+}
+
+// Deliveries - deliveries of a webhook newest first
+func (m *Memory) Deliveries(ctx context.Context, webhookID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		delivery := m.deliveries[i]
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// deliveryIndex - position of the delivery with id, -1 when there is none. The caller holds the lock
+func (m *Memory) deliveryIndex(id int64) int {
+	for i, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
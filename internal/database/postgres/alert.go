@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
+)
+
+const alertRuleColumns = "id, type, quote_currency, condition, value, notifier, target, active, triggered_at, created_at"
+
+// CreateAlertRule - stores a new rule
+func (d *Database) CreateAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	rule.QuoteCurrency = strings.ToTitle(rule.QuoteCurrency)
+	rule.Active = false
+	rule.TriggeredAt = nil
+
+	err := d.Client.QueryRowContext(
+		ctx,
+		`insert into alert_rules (type, quote_currency, condition, value, notifier, target)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at`,
+		rule.Type,
+		rule.QuoteCurrency,
+		rule.Condition,
+		rule.Value,
+		rule.Notifier,
+		rule.Target,
+	).Scan(&rule.ID, &rule.CreatedAt)
+
+	return repository.WrapTimeout(ctx, err)
+}
+
+// AlertRules - rules of the quote currencies in id order
+func (d *Database) AlertRules(ctx context.Context, quoteCurrencies []string) ([]models.AlertRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	currencies := make([]string, len(quoteCurrencies))
+	for i, currency := range quoteCurrencies {
+		currencies[i] = strings.ToTitle(currency)
+	}
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		"select "+alertRuleColumns+" from alert_rules where cardinality($1::text[]) = 0 or quote_currency = any($1::text[]) order by id",
+		pq.Array(currencies),
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var rules []models.AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// GetAlertRule - returns ErrAlertRuleNotFound if there is no rule with id
+func (d *Database) GetAlertRule(ctx context.Context, id int64) (models.AlertRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	rule, err := scanAlertRule(d.Client.QueryRowContext(ctx, "select "+alertRuleColumns+" from alert_rules where id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rule, repository.ErrAlertRuleNotFound
+	}
+
+	return rule, repository.WrapTimeout(ctx, err)
+}
+
+// DeleteAlertRule - removes the rule
+func (d *Database) DeleteAlertRule(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "delete from alert_rules where id = $1", id)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// SetAlertRuleState - stores whether the condition of the rule holds
+func (d *Database) SetAlertRuleState(ctx context.Context, id int64, active bool, triggeredAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "update alert_rules set active = $1, triggered_at = $2 where id = $3", active, triggeredAt, id)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// ClaimAlertRule - makes the rule active unless it is already, in a single update
+func (d *Database) ClaimAlertRule(ctx context.Context, id int64, triggeredAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "update alert_rules set active = true, triggered_at = $1 where id = $2 and active = false", triggeredAt, id)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	affected, err := result.RowsAffected()
+
+	return affected == 1, err
+}
+
+func scanAlertRule(row scanner) (models.AlertRule, error) {
+	var rule models.AlertRule
+	var triggeredAt sql.NullTime
+
+	err := row.Scan(&rule.ID, &rule.Type, &rule.QuoteCurrency, &rule.Condition, &rule.Value, &rule.Notifier, &rule.Target, &rule.Active, &triggeredAt, &rule.CreatedAt)
+	if triggeredAt.Valid {
+		rule.TriggeredAt = &triggeredAt.Time
+	}
+
+	return rule, err
+}
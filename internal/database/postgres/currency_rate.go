@@ -2,68 +2,145 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	repository "github.com/Shambou/golang-challenge/internal/database"
 	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
 )
 
 const BaseCurrency = "USD"
 
-// CreateRate - creates new rate in db
+// CreateRate - creates new rate in db, returns ErrRateExists if the currency already has a rate of that type on
+// that date
 func (d *Database) CreateRate(ctx context.Context, rate *models.CurrencyRate) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
 	defer cancel()
 
 	query := `insert into currency_rates
-		(base_currency, quote_currency, rate, date) VALUES
-		($1, $2, $3, $4) returning id`
+		(base_currency, quote_currency, rate, date, rate_type) VALUES
+		($1, $2, $3, $4, $5)
+		on conflict (base_currency, quote_currency, date, rate_type) do nothing
+		returning id`
 
 	rate.BaseCurrency = BaseCurrency
+	rate.Type = models.RateType(rate.Type)
 
-	result, err := d.Client.ExecContext(
+	err := d.Client.QueryRowContext(
 		ctx,
 		query,
 		rate.BaseCurrency,
 		rate.QuoteCurrency,
 		rate.Rate,
 		rate.Date,
-	)
+		rate.Type,
+	).Scan(&rate.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrRateExists
+	}
 	if err != nil {
 		log.Println(err)
-		return err
+		return repository.WrapTimeout(ctx, err)
+	}
+
+	return nil
+}
+
+// UpdateRate - changes the rate of the currency on the date and of the type of rate, returns ErrRateNotFound if
+// there is none
+func (d *Database) UpdateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	rate.BaseCurrency = BaseCurrency
+	rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+	rate.Type = models.RateType(rate.Type)
+
+	err := d.Client.QueryRowContext(
+		ctx,
+		"update currency_rates set rate = $1 where base_currency = $2 and quote_currency = $3 and date = $4 and rate_type = $5 returning id",
+		rate.Rate,
+		rate.BaseCurrency,
+		rate.QuoteCurrency,
+		rate.Date,
+		rate.Type,
+	).Scan(&rate.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrRateNotFound
+	}
+
+	return repository.WrapTimeout(ctx, err)
+}
+
+// DeleteRate - removes the mid rate of the currency on date, returns ErrRateNotFound if there is none
+func (d *Database) DeleteRate(ctx context.Context, quoteCurrency string, date time.Time) error {
+	return d.DeleteRateOfType(ctx, quoteCurrency, date, models.RateMid)
+}
+
+// DeleteRateOfType - removes the rate of rateType of the currency on date, returns ErrRateNotFound if there is none
+func (d *Database) DeleteRateOfType(ctx context.Context, quoteCurrency string, date time.Time, rateType string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		"delete from currency_rates where base_currency = $1 and quote_currency = $2 and date = $3 and rate_type = $4",
+		BaseCurrency,
+		strings.ToTitle(quoteCurrency),
+		date,
+		rateType,
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrRateNotFound
 	}
-	id, _ := result.LastInsertId()
-	rate.ID = int(id)
 
 	return nil
 }
 
 // GetLastRate - gets last rate available for
 func (d *Database) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	return d.GetLastRateOfType(ctx, quoteCurrency, models.RateMid)
+}
+
+// GetLastRateOfType - gets last rate of rateType available for
+func (d *Database) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
 	defer cancel()
 	var rate = models.CurrencyRate{}
 	quoteCurrency = strings.ToTitle(quoteCurrency)
 
 	row := d.Client.QueryRowContext(
 		ctx,
-		"select date, base_currency, quote_currency, rate from currency_rates where quote_currency = $1 order by date desc limit 1",
+		"select date, base_currency, quote_currency, rate, rate_type from currency_rates where quote_currency = $1 and rate_type = $2 order by date desc limit 1",
 		quoteCurrency,
+		rateType,
 	)
-	err := row.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate)
+	err := row.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.Type)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rate, fmt.Errorf("%w for %s", repository.ErrNoRates, quoteCurrency)
+	}
 	if err != nil {
-		return rate, errors.New(fmt.Sprintf("could not get rate for %s", quoteCurrency))
+		return rate, repository.WrapTimeout(ctx, err)
 	}
 
 	return rate, nil
 }
 
 func (d *Database) GetRatesInRange(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) ([]models.CurrencyRate, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	return d.GetRatesInRangeOfType(ctx, quoteCurrency, fromDate, toDate, models.RateMid)
+}
+
+// GetRatesInRangeOfType - rates of rateType of the currency between two dates
+func (d *Database) GetRatesInRangeOfType(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
 	defer cancel()
 
 	var rates []models.CurrencyRate
@@ -72,17 +149,18 @@ func (d *Database) GetRatesInRange(ctx context.Context, quoteCurrency string, fr
 	to := toDate.Format("2006-01-02")
 	quoteCurrency = strings.ToTitle(quoteCurrency)
 
-	query := `select date, base_currency, quote_currency, rate from currency_rates where quote_currency = $1 and date between $2 and $3 order by date asc`
+	query := `select date, base_currency, quote_currency, rate, rate_type from currency_rates where quote_currency = $1 and rate_type = $2 and date between $3 and $4 order by date asc`
 
 	rows, err := d.Client.QueryContext(
 		ctx,
 		query,
 		quoteCurrency,
+		rateType,
 		from,
 		to,
 	)
 	if err != nil {
-		return nil, err
+		return nil, repository.WrapTimeout(ctx, err)
 	}
 	defer rows.Close()
 
@@ -93,20 +171,21 @@ func (d *Database) GetRatesInRange(ctx context.Context, quoteCurrency string, fr
 			&rate.BaseCurrency,
 			&rate.QuoteCurrency,
 			&rate.Rate,
+			&rate.Type,
 		)
 		if err != nil {
-			return nil, err
+			return nil, repository.WrapTimeout(ctx, err)
 		}
 
 		rates = append(rates, rate)
 	}
 
-	return rates, nil
+	return rates, repository.WrapTimeout(ctx, rows.Err())
 }
 
 // CheckRateQuoteOnDateExists - Checks if rate exists in db
 func (d *Database) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency string, date time.Time) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
 	defer cancel()
 
 	searchDate := date.Format("2006-01-02")
@@ -114,7 +193,7 @@ func (d *Database) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency
 
 	row := d.Client.QueryRowContext(
 		ctx,
-		"select id from currency_rates where quote_currency = $1 and date = $2 limit 1",
+		"select id from currency_rates where quote_currency = $1 and date = $2 and rate_type = 'mid' limit 1",
 		quoteCurrency,
 		searchDate,
 	)
@@ -130,43 +209,49 @@ func (d *Database) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency
 
 // GetAllRatesOnDate - gets all available rates on date
 func (d *Database) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.CurrencyRate, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	return d.GetAllRatesOnDateOfType(ctx, date, models.RateMid)
+}
+
+// GetAllRatesOnDateOfType - gets all available rates of rateType on date
+func (d *Database) GetAllRatesOnDateOfType(ctx context.Context, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
 	defer cancel()
 
 	var rates []models.CurrencyRate
 
 	searchDate := date.Format("2006-01-02")
 
-	query := `select date, base_currency, quote_currency, rate 
-		from currency_rates  
-		where date = $1   
+	query := `select date, base_currency, quote_currency, rate, rate_type
+		from currency_rates
+		where date = $1 and rate_type = $2
 		order by quote_currency asc`
 
 	rows, err := d.Client.QueryContext(
 		ctx,
 		query,
 		searchDate,
+		rateType,
 	)
 	if err != nil {
-		return nil, err
+		return nil, repository.WrapTimeout(ctx, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var rate models.CurrencyRate
-		err := rows.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate)
+		err := rows.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.Type)
 		if err != nil {
-			return nil, err
+			return nil, repository.WrapTimeout(ctx, err)
 		}
 		rates = append(rates, rate)
 	}
 
-	return rates, nil
+	return rates, repository.WrapTimeout(ctx, rows.Err())
 }
 
 // TableSeeded - checks if db table is already seeded
 func (d *Database) TableSeeded(ctx context.Context) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
 	defer cancel()
 
 	row := d.Client.QueryRowContext(
@@ -182,18 +267,158 @@ func (d *Database) TableSeeded(ctx context.Context) bool {
 	return true
 }
 
-// BulkInsert - used only to bulk insert data from csv files
-// code taken from https://stackoverflow.com/questions/60026385/bulk-insert-with-sqlx
+// BulkInsertChunkSize - number of rows copied per transaction by BulkInsert
+const BulkInsertChunkSize = 10000
+
+// BulkInsert - used only to bulk insert data from csv files, rows are streamed with COPY in chunked transactions
 func (d *Database) BulkInsert(rates []models.CurrencyRate) error {
-	queryInsert := `INSERT INTO currency_rates (base_currency, quote_currency, rate, date) VALUES `
-	insertparams := []interface{}{}
-	for i, rate := range rates {
-		p1 := i * 4 // starting position for insert params
-		queryInsert += fmt.Sprintf("($%d,$%d,$%d,$%d),", p1+1, p1+2, p1+3, p1+4)
-		insertparams = append(insertparams, rate.BaseCurrency, rate.QuoteCurrency, rate.Rate, rate.Date)
+	for start := 0; start < len(rates); start += BulkInsertChunkSize {
+		end := start + BulkInsertChunkSize
+		if end > len(rates) {
+			end = len(rates)
+		}
+
+		if err := d.copyRates(rates[start:end]); err != nil {
+			return fmt.Errorf("could not insert rates %d to %d: %w", start, end, err)
+		}
 	}
-	queryInsert = queryInsert[:len(queryInsert)-1] // remove trailing ","
-	d.Client.MustExec(queryInsert, insertparams...)
 
 	return nil
 }
+
+// copyRates - copies rates into a staging table and moves them to currency_rates in one transaction,
+// COPY can't skip conflicting rows so rates already stored are dropped on the way over
+func (d *Database) copyRates(rates []models.CurrencyRate) error {
+	tx, err := d.Client.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`create temporary table currency_rates_staging
+		(base_currency char(3), quote_currency char(3), rate decimal(12, 6), date date, rate_type varchar(8))
+		on commit drop`)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("currency_rates_staging", "base_currency", "quote_currency", "rate", "date", "rate_type"))
+	if err != nil {
+		return err
+	}
+
+	for _, rate := range rates {
+		_, err = stmt.Exec(rate.BaseCurrency, rate.QuoteCurrency, rate.Rate.String(), rate.Date.Format("2006-01-02"), models.RateType(rate.Type))
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// flush the buffered rows
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`insert into currency_rates (base_currency, quote_currency, rate, date, rate_type)
+		select base_currency, quote_currency, rate, date, rate_type from currency_rates_staging
+		on conflict (base_currency, quote_currency, date, rate_type) do nothing`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StreamRates - streams rates between two dates from a db cursor ordered by quote currency and date,
+// no quote currencies means all of them
+func (d *Database) StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	return d.StreamRatesOfType(ctx, quoteCurrencies, fromDate, toDate, models.RateMid, fn)
+}
+
+// StreamRatesOfType - streams rates of rateType like StreamRates. The read timeout is not applied,
+// a stream lasts as long as its consumer keeps reading and ends with ctx.
+func (d *Database) StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	currencies := make([]string, len(quoteCurrencies))
+	for i, currency := range quoteCurrencies {
+		currencies[i] = strings.ToTitle(currency)
+	}
+
+	query := `select date, base_currency, quote_currency, rate, rate_type
+		from currency_rates
+		where (cardinality($1::text[]) = 0 or quote_currency = any($1::text[])) and rate_type = $2 and date between $3 and $4
+		order by quote_currency asc, date asc`
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		query,
+		pq.Array(currencies),
+		rateType,
+		fromDate.Format("2006-01-02"),
+		toDate.Format("2006-01-02"),
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rate models.CurrencyRate
+		if err := rows.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.Type); err != nil {
+			return repository.WrapTimeout(ctx, err)
+		}
+		if err := fn(rate); err != nil {
+			return err
+		}
+	}
+
+	return repository.WrapTimeout(ctx, rows.Err())
+}
+
+// GetRatesAsOf - newest rate on or before date of every quote currency in one query
+func (d *Database) GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	currencies := make([]string, len(quoteCurrencies))
+	for i, currency := range quoteCurrencies {
+		currencies[i] = strings.ToTitle(currency)
+	}
+
+	query := `select distinct on (quote_currency) date, base_currency, quote_currency, rate, rate_type
+		from currency_rates
+		where quote_currency = any($1::text[]) and rate_type = 'mid' and date <= $2
+		order by quote_currency asc, date desc`
+
+	rows, err := d.Client.QueryContext(ctx, query, pq.Array(currencies), date.Format("2006-01-02"))
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var rates []models.CurrencyRate
+	for rows.Next() {
+		var rate models.CurrencyRate
+		if err := rows.Scan(&rate.Date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.Type); err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// Currencies - quote currencies that have rates
+func (d *Database) Currencies(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var currencies []string
+	err := d.Client.SelectContext(ctx, &currencies, "select distinct quote_currency from currency_rates where rate_type = 'mid' order by quote_currency asc")
+
+	return currencies, repository.WrapTimeout(ctx, err)
+}
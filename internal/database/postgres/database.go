@@ -5,16 +5,42 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	repository "github.com/Shambou/golang-challenge/internal/database"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
 type Database struct {
-	Client *sqlx.DB
+	Client   *sqlx.DB
+	Timeouts repository.Timeouts
+
+	// connectionString - kept for connections outside the pool, like the one ListenForChanges holds
+	connectionString string
+}
+
+// PoolConfig - connection pool limits, zero values keep the database/sql defaults
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
 }
 
-// NewDatabase - returns a pointer to a database object
+// RetryConfig - backoff between connection attempts, the deadline comes from the context passed to Connect
+type RetryConfig struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryConfig - used when DB_RETRY_INITIAL_BACKOFF and DB_RETRY_MAX_BACKOFF are not set
+var DefaultRetryConfig = RetryConfig{
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+// NewDatabase - returns a pointer to a database object, the connection is not checked until Connect or the first query
 func NewDatabase() *Database {
 	log.Println("Setting up new database connection")
 
@@ -28,13 +54,62 @@ func NewDatabase() *Database {
 		os.Getenv("SSL_MODE"),
 	)
 
-	db, err := sqlx.Connect("postgres", connectionString)
+	db, err := sqlx.Open("postgres", connectionString)
 	if err != nil {
-		log.Fatal("Error connecting to database: ", err)
+		log.Fatal("Error setting up database: ", err)
 	}
 
 	return &Database{
-		Client: db,
+		Client:           db,
+		Timeouts:         repository.DefaultTimeouts,
+		connectionString: connectionString,
+	}
+}
+
+// ConfigurePool - applies pool limits to the connection pool
+func (d *Database) ConfigurePool(pool PoolConfig) {
+	if pool.MaxOpenConns > 0 {
+		d.Client.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		d.Client.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		d.Client.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		d.Client.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+}
+
+// Connect - pings the db until it answers, backing off exponentially between attempts, gives up when ctx is done.
+// A backoff that isn't positive is replaced by the default so a misconfiguration can't turn into a tight loop
+func (d *Database) Connect(ctx context.Context, retry RetryConfig) error {
+	if retry.InitialBackoff <= 0 {
+		retry.InitialBackoff = DefaultRetryConfig.InitialBackoff
+	}
+	if retry.MaxBackoff < retry.InitialBackoff {
+		retry.MaxBackoff = retry.InitialBackoff
+	}
+	backoff := retry.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := d.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Printf("database not reachable, attempt %d: %s", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not connect to database after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
 	}
 }
 
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
+)
+
+// ChangesChannel - channel the currency_rates trigger notifies
+const ChangesChannel = "rate_changes"
+
+// Reconnect backoff of the listening connection
+const (
+	ListenMinReconnect = time.Second
+	ListenMaxReconnect = time.Minute
+)
+
+// ListenForChanges - holds a connection outside the pool that listens on ChangesChannel, it reconnects on its
+// own and calls fn with nil once it is back, notifications sent in between are lost
+func (d *Database) ListenForChanges(ctx context.Context, fn func(change *models.RateChange)) error {
+	listener := pq.NewListener(d.connectionString, ListenMinReconnect, ListenMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("rate change listener: ", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(ChangesChannel); err != nil {
+		return err
+	}
+
+	// the connection is checked now and then, a dead one is only noticed when something is sent over it
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ping.C:
+			go func() {
+				_ = listener.Ping()
+			}()
+		case notification := <-listener.Notify:
+			// pq sends nil after it reconnected
+			if notification == nil {
+				fn(nil)
+				continue
+			}
+
+			var change struct {
+				Type          string `json:"type"`
+				QuoteCurrency string `json:"quote_currency"`
+				Date          string `json:"date"`
+				To            string `json:"to"`
+			}
+			if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+				log.Printf("invalid rate change notification %q: %s", notification.Extra, err)
+				fn(nil)
+				continue
+			}
+			date, err := time.Parse("2006-01-02", change.Date)
+			if err != nil {
+				log.Printf("invalid rate change notification %q: %s", notification.Extra, err)
+				fn(nil)
+				continue
+			}
+			// a statement that changed several rates of the currency sends the range of their dates
+			var to time.Time
+			if change.To != "" {
+				if to, err = time.Parse("2006-01-02", change.To); err != nil {
+					log.Printf("invalid rate change notification %q: %s", notification.Extra, err)
+					fn(nil)
+					continue
+				}
+			}
+			fn(&models.RateChange{Type: change.Type, QuoteCurrency: change.QuoteCurrency, Date: date, To: to})
+		}
+	}
+}
@@ -3,27 +3,32 @@ package database
 import (
 	"fmt"
 	"log"
-	"os"
 
+	"github.com/Shambou/golang-challenge/migrations"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/lib/pq"
 )
 
-// MigrateDB - runs all migrations in the migrations
-func (d *Database) MigrateDB() error {
-	log.Println("migrating our database")
+// Migrator - returns a migrate instance for the embedded migrations
+func (d *Database) Migrator() (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations.Postgres, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read the migrations: %w", err)
+	}
 	driver, err := postgres.WithInstance(d.Client.DB, &postgres.Config{})
 	if err != nil {
-		return fmt.Errorf("could not create the postgres driver: %w", err)
+		return nil, fmt.Errorf("could not create the postgres driver: %w", err)
 	}
-	fmt.Println(os.Getwd())
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://./migrations",
-		"postgres",
-		driver,
-	)
+
+	return migrate.NewWithInstance("iofs", source, "postgres", driver)
+}
+
+// MigrateDB - runs all migrations in the migrations
+func (d *Database) MigrateDB() error {
+	log.Println("migrating our database")
+	m, err := d.Migrator()
 	if err != nil {
 		return err
 	}
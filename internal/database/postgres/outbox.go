@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// OutboxSince - messages recorded by the currency_rates trigger after afterID, ids are handed out in commit order
+// when they are published so none is skipped
+func (d *Database) OutboxSince(ctx context.Context, afterID int64, limit int) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	if err := d.publishRateChanges(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		"select id, topic, type, payload, created_at from outbox where id > $1 order by id limit $2",
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		var payload []byte
+		if err := rows.Scan(&message.ID, &message.Topic, &message.Type, &payload, &message.CreatedAt); err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		message.Payload = payload
+		messages = append(messages, message)
+	}
+
+	return messages, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// ClaimOutboxSink - makes owner the only publisher to sink until lease runs out, a new sink starts after the newest
+// message
+func (d *Database) ClaimOutboxSink(ctx context.Context, sink string, owner string, lease time.Duration) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	var offset int64
+	err := d.Client.QueryRowContext(
+		ctx,
+		`insert into outbox_offsets (sink, last_id, owner, locked_until)
+		select $1, coalesce(max(id), 0), $2, now() + $3 * interval '1 millisecond' from outbox
+		on conflict (sink) do update set owner = excluded.owner, locked_until = excluded.locked_until
+		where outbox_offsets.owner = excluded.owner or outbox_offsets.locked_until <= now()
+		returning last_id`,
+		sink,
+		owner,
+		lease.Milliseconds(),
+	).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+
+	return offset, true, nil
+}
+
+// SetOutboxOffset - stores the id of the last message published to sink while owner holds it
+func (d *Database) SetOutboxOffset(ctx context.Context, sink string, owner string, lastID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "update outbox_offsets set last_id = $1 where sink = $2 and owner = $3", lastID, sink, owner)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	affected, _ := result.RowsAffected()
+
+	return affected > 0, nil
+}
+
+// DeleteOutboxSink - drops the offset of sink while owner holds it
+func (d *Database) DeleteOutboxSink(ctx context.Context, sink string, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	_, err := d.Client.ExecContext(ctx, "delete from outbox_offsets where sink = $1 and owner = $2", sink, owner)
+
+	return repository.WrapTimeout(ctx, err)
+}
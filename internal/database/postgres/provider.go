@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+)
+
+// ClaimProviderRun - makes owner the only process fetching the rates of provider on day until lease runs out, a
+// later day replaces the run of the day before
+func (d *Database) ClaimProviderRun(ctx context.Context, provider string, day time.Time, owner string, lease time.Duration) (bool, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	date := day.UTC().Format("2006-01-02")
+	result, err := d.Client.ExecContext(
+		ctx,
+		`insert into provider_runs (provider, day, owner, locked_until) values ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		on conflict (provider) do update set day = excluded.day, owner = excluded.owner, locked_until = excluded.locked_until, done = false
+		where provider_runs.day < excluded.day
+		or (provider_runs.day = excluded.day and not provider_runs.done and (provider_runs.owner = excluded.owner or provider_runs.locked_until <= now()))`,
+		provider,
+		date,
+		owner,
+		lease.Milliseconds(),
+	)
+	if err != nil {
+		return false, false, repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return true, false, nil
+	}
+
+	var done bool
+	err = d.Client.GetContext(ctx, &done, "select day > $1 or done from provider_runs where provider = $2", date, provider)
+
+	return false, done, repository.WrapTimeout(ctx, err)
+}
+
+// FinishProviderRun - marks the fetch of provider on day done while owner holds it
+func (d *Database) FinishProviderRun(ctx context.Context, provider string, day time.Time, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	_, err := d.Client.ExecContext(
+		ctx,
+		"update provider_runs set done = true where provider = $1 and day = $2 and owner = $3",
+		provider,
+		day.UTC().Format("2006-01-02"),
+		owner,
+	)
+
+	return repository.WrapTimeout(ctx, err)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
+)
+
+// EventsSince - events recorded by the currency_rates trigger after afterID, the ones of transactions that
+// finished since the last read are published first
+func (d *Database) EventsSince(ctx context.Context, afterID int64, quoteCurrencies []string, limit int) ([]models.RateEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	if err := d.publishRateChanges(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `select id, type, base_currency, quote_currency, rate, date, created_at
+		from rate_events
+		where id > $1 and (cardinality($2::text[]) = 0 or quote_currency = any($2::text[]))
+		order by id asc
+		limit $3`
+
+	// a nil slice would be sent as null instead of an empty array
+	currencies := append([]string{}, quoteCurrencies...)
+	rows, err := d.Client.QueryContext(ctx, query, afterID, pq.Array(currencies), limit)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var events []models.RateEvent
+	for rows.Next() {
+		var event models.RateEvent
+		err := rows.Scan(&event.ID, &event.Type, &event.BaseCurrency, &event.QuoteCurrency, &event.Rate, &event.Date, &event.CreatedAt)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// LastEventID - id of the newest event
+func (d *Database) LastEventID(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	if err := d.publishRateChanges(ctx); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := d.Client.GetContext(ctx, &id, "select coalesce(max(id), 0) from rate_events")
+
+	return id, repository.WrapTimeout(ctx, err)
+}
+
+// publishRateChanges - moves the pending events and outbox messages of finished transactions to rate_events and
+// outbox, ids are handed out in commit order so a reader never skips one
+func (d *Database) publishRateChanges(ctx context.Context) error {
+	_, err := d.Client.ExecContext(ctx, "select publish_rate_changes()")
+
+	return repository.WrapTimeout(ctx, err)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+)
+
+// PruneEvents - deletes the events created before before that the webhook cursor is past, all of them when no
+// webhook is registered. Pending events are published first, so they don't pile up without readers
+func (d *Database) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	if err := d.publishRateChanges(ctx); err != nil {
+		return 0, err
+	}
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		`delete from rate_events
+		where created_at < $1 and id <= coalesce((select last_event_id from webhook_cursor where id = 1), id)`,
+		before,
+	)
+	if err != nil {
+		return 0, repository.WrapTimeout(ctx, err)
+	}
+	pruned, _ := result.RowsAffected()
+
+	return pruned, nil
+}
+
+// PruneOutbox - drops the offsets of sinks not claimed since before, then the messages created before before that
+// every sink left published
+func (d *Database) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "delete from outbox_offsets where locked_until < $1", before); err != nil {
+		return 0, repository.WrapTimeout(ctx, err)
+	}
+	result, err := tx.ExecContext(
+		ctx,
+		"delete from outbox where created_at < $1 and id <= coalesce((select min(last_id) from outbox_offsets), id)",
+		before,
+	)
+	if err != nil {
+		return 0, repository.WrapTimeout(ctx, err)
+	}
+	pruned, _ := result.RowsAffected()
+
+	return pruned, repository.WrapTimeout(ctx, tx.Commit())
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// GetSeedFile - gets the seed record of path, nil if the file was never seeded
+func (d *Database) GetSeedFile(ctx context.Context, path string) (*models.SeedFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var file models.SeedFile
+	row := d.Client.QueryRowContext(
+		ctx,
+		"select path, checksum, lines, updated_at from seed_files where path = $1",
+		path,
+	)
+	err := row.Scan(&file.Path, &file.Checksum, &file.Lines, &file.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// SaveSeedFile - creates or updates the seed record of a file
+func (d *Database) SaveSeedFile(ctx context.Context, file *models.SeedFile) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	query := `insert into seed_files (path, checksum, lines, updated_at) values ($1, $2, $3, now())
+		on conflict (path) do update set checksum = excluded.checksum, lines = excluded.lines, updated_at = excluded.updated_at
+		returning updated_at`
+
+	return d.Client.QueryRowContext(ctx, query, file.Path, file.Checksum, file.Lines).Scan(&file.UpdatedAt)
+}
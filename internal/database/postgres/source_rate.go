@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
+)
+
+// SaveSourceRates - stores the values, a source giving a currency and date again replaces its value. Values are
+// sent as arrays, BulkInsertChunkSize at a time
+func (d *Database) SaveSourceRates(ctx context.Context, rates []models.SourceRate) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	// one statement can't update the same row twice, the last value of a key wins
+	keys := make(map[string]int, len(rates))
+	var unique []models.SourceRate
+	for _, rate := range rates {
+		rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+		key := rate.QuoteCurrency + rate.Date.Format("2006-01-02") + rate.Source
+		if i, ok := keys[key]; ok {
+			unique[i] = rate
+			continue
+		}
+		keys[key] = len(unique)
+		unique = append(unique, rate)
+	}
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(unique); start += BulkInsertChunkSize {
+		end := start + BulkInsertChunkSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		chunk := unique[start:end]
+		currencies := make([]string, len(chunk))
+		dates := make([]string, len(chunk))
+		sources := make([]string, len(chunk))
+		values := make([]string, len(chunk))
+		for i, rate := range chunk {
+			currencies[i] = rate.QuoteCurrency
+			dates[i] = rate.Date.Format("2006-01-02")
+			sources[i] = rate.Source
+			values[i] = rate.Rate.String()
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`insert into source_rates (base_currency, quote_currency, date, source, rate)
+			select $1, quote_currency, date::date, source, rate::decimal
+			from unnest($2::text[], $3::text[], $4::text[], $5::text[]) as t(quote_currency, date, source, rate)
+			on conflict (quote_currency, date, base_currency, source) do update set rate = excluded.rate, updated_at = now()`,
+			BaseCurrency,
+			pq.Array(currencies),
+			pq.Array(dates),
+			pq.Array(sources),
+			pq.Array(values),
+		)
+		if err != nil {
+			return repository.WrapTimeout(ctx, err)
+		}
+	}
+
+	return repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// SourceRates - values of the quote currencies between two dates ordered by currency, date and source
+func (d *Database) SourceRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time) ([]models.SourceRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	currencies := make([]string, len(quoteCurrencies))
+	for i, currency := range quoteCurrencies {
+		currencies[i] = strings.ToTitle(currency)
+	}
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		`select source, base_currency, quote_currency, date, rate, updated_at
+		from source_rates
+		where (cardinality($1::text[]) = 0 or quote_currency = any($1::text[])) and date between $2 and $3
+		order by quote_currency, date, source`,
+		pq.Array(currencies),
+		fromDate.Format("2006-01-02"),
+		toDate.Format("2006-01-02"),
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var rates []models.SourceRate
+	for rows.Next() {
+		var rate models.SourceRate
+		err := rows.Scan(&rate.Source, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Date, &rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, repository.WrapTimeout(ctx, rows.Err())
+}
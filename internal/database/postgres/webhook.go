@@ -0,0 +1,317 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/lib/pq"
+)
+
+const deliveryColumns = `d.id, d.webhook_id, d.status, d.attempts, d.next_attempt_at, d.last_error, d.created_at, d.delivered_at,
+	e.id, e.type, e.base_currency, e.quote_currency, e.rate, e.date, e.created_at`
+
+// CreateWebhook - stores the webhook, the cursor starts at the newest event with the first webhook
+func (d *Database) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(
+		ctx,
+		`insert into webhooks (url, secret, currencies, after_event_id)
+		select $1, $2, $3, coalesce(max(id), 0) from rate_events
+		returning id, after_event_id, created_at`,
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(append([]string{}, webhook.Currencies...)),
+	).Scan(&webhook.ID, &webhook.AfterEventID, &webhook.CreatedAt)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	_, err = tx.ExecContext(ctx, "insert into webhook_cursor (id, last_event_id) values (1, $1) on conflict (id) do nothing", webhook.AfterEventID)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+
+	return repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// Webhooks - every webhook in id order
+func (d *Database) Webhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	rows, err := d.Client.QueryContext(ctx, "select id, url, secret, currencies, after_event_id, created_at from webhooks order by id")
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// GetWebhook - returns ErrWebhookNotFound if there is no webhook with id
+func (d *Database) GetWebhook(ctx context.Context, id int64) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	row := d.Client.QueryRowContext(ctx, "select id, url, secret, currencies, after_event_id, created_at from webhooks where id = $1", id)
+	webhook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook, repository.ErrWebhookNotFound
+	}
+
+	return webhook, repository.WrapTimeout(ctx, err)
+}
+
+// DeleteWebhook - removes the webhook, its deliveries are removed by the foreign key
+func (d *Database) DeleteWebhook(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "delete from webhooks where id = $1", id)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// WebhookCursor - id of the last event turned into deliveries
+func (d *Database) WebhookCursor(ctx context.Context) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var id int64
+	err := d.Client.GetContext(ctx, &id, "select last_event_id from webhook_cursor where id = 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+
+	return id, true, nil
+}
+
+// EnqueueDeliveries - queues deliveries and moves the cursor if it is still at afterID
+func (d *Database) EnqueueDeliveries(ctx context.Context, afterID int64, lastID int64, deliveries []models.WebhookDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	// the row lock makes a second process wait and then see the moved cursor
+	result, err := tx.ExecContext(ctx, "update webhook_cursor set last_event_id = $1 where id = 1 and last_event_id = $2", lastID, afterID)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	if len(deliveries) > 0 {
+		webhookIDs := make([]int64, len(deliveries))
+		eventIDs := make([]int64, len(deliveries))
+		for i, delivery := range deliveries {
+			webhookIDs[i] = delivery.WebhookID
+			eventIDs[i] = delivery.Event.ID
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`insert into webhook_deliveries (webhook_id, event_id)
+			select * from unnest($1::bigint[], $2::bigint[])
+			on conflict (webhook_id, event_id) do nothing`,
+			pq.Array(webhookIDs),
+			pq.Array(eventIDs),
+		)
+		if err != nil {
+			return false, repository.WrapTimeout(ctx, err)
+		}
+	}
+
+	return true, repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// ClaimDeliveries - pending deliveries due at now, rows claimed by another process are skipped
+func (d *Database) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	return queryDeliveries(
+		ctx,
+		d.Client,
+		`with claimed as (
+			update webhook_deliveries set next_attempt_at = $2
+			where id in (
+				select id from webhook_deliveries
+				where status = 'pending' and next_attempt_at <= $1
+				order by id
+				limit $3
+				for update skip locked
+			)
+			returning *
+		)
+		select `+deliveryColumns+`
+		from claimed d join rate_events e on e.id = d.event_id
+		order by d.id`,
+		now,
+		now.Add(lease),
+		limit,
+	)
+}
+
+// UpdateDelivery - stores the outcome of an attempt
+func (d *Database) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		`update webhook_deliveries
+		set status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5
+		where id = $6`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// RequeueDelivery - makes the delivery pending and due at now unless it is pending and not due yet
+func (d *Database) RequeueDelivery(ctx context.Context, id int64, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		`update webhook_deliveries
+		set status = $1, attempts = 0, next_attempt_at = $2, last_error = '', delivered_at = null
+		where id = $3 and (status <> $1 or next_attempt_at <= $2)`,
+		models.DeliveryPending,
+		now,
+		id,
+	)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	affected, err := result.RowsAffected()
+
+	return affected == 1, err
+}
+
+// GetDelivery - returns ErrDeliveryNotFound if there is no delivery with id
+func (d *Database) GetDelivery(ctx context.Context, id int64) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	deliveries, err := queryDeliveries(
+		ctx,
+		d.Client,
+		`select `+deliveryColumns+` from webhook_deliveries d join rate_events e on e.id = d.event_id where d.id = $1`,
+		id,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return models.WebhookDelivery{}, repository.ErrDeliveryNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+// Deliveries - deliveries of a webhook newest first
+func (d *Database) Deliveries(ctx context.Context, webhookID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	return queryDeliveries(
+		ctx,
+		d.Client,
+		`select `+deliveryColumns+`
+		from webhook_deliveries d join rate_events e on e.id = d.event_id
+		where d.webhook_id = $1 and ($2 = '' or d.status = $2)
+		order by d.id desc
+		limit $3`,
+		webhookID,
+		status,
+		limit,
+	)
+}
+
+// scanner - common interface of sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, pq.Array(&webhook.Currencies), &webhook.AfterEventID, &webhook.CreatedAt)
+
+	return webhook, err
+}
+
+func queryDeliveries(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError, &delivery.CreatedAt, &deliveredAt,
+			&delivery.Event.ID, &delivery.Event.Type, &delivery.Event.BaseCurrency, &delivery.Event.QuoteCurrency, &delivery.Event.Rate, &delivery.Event.Date, &delivery.Event.CreatedAt,
+		)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, repository.WrapTimeout(ctx, rows.Err())
+}
@@ -2,11 +2,43 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Shambou/golang-challenge/internal/models"
 )
 
+// BaseCurrency - currency every stored rate is quoted against
+const BaseCurrency = "USD"
+
+// ErrRateExists - returned by CreateRate when the currency already has a rate on that date
+var ErrRateExists = errors.New("rate for this currency and date already exists")
+
+// ErrRateNotFound - returned by UpdateRate and DeleteRate when the currency has no rate on that date
+var ErrRateNotFound = errors.New("rate for this currency and date doesn't exist")
+
+// ErrNoRates - returned by GetLastRate when the currency has no rates at all
+var ErrNoRates = errors.New("could not get rate")
+
+// ErrNotSupported - returned by helpers when the repository doesn't implement an optional interface
+var ErrNotSupported = errors.New("not supported by this database")
+
+// ErrTimeout - returned when a query runs past its deadline
+var ErrTimeout = errors.New("database query timed out")
+
+// Timeouts - per operation query deadlines, derived from the request context so a shorter request deadline wins
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// DefaultTimeouts - used when DB_READ_TIMEOUT and DB_WRITE_TIMEOUT are not set
+var DefaultTimeouts = Timeouts{
+	Read:  15 * time.Second,
+	Write: 3 * time.Second,
+}
+
 // DatabaseRepo - contract for our DB calls
 type DatabaseRepo interface {
 	CreateRate(ctx context.Context, rate *models.CurrencyRate) error
@@ -17,3 +49,334 @@ type DatabaseRepo interface {
 	TableSeeded(ctx context.Context) bool
 	Ping(ctx context.Context) error
 }
+
+// WrapTimeout - turns errors caused by an expired ctx into ErrTimeout and errors caused by a cancelled one, like a
+// client that went away, into context.Canceled. Other errors are returned as they are
+func WrapTimeout(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	// drivers don't always return ctx.Err() for an interrupted query
+	if ctx.Err() != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+
+	return err
+}
+
+// RateStreamer - repositories that can pass rates on one by one instead of loading them all
+type RateStreamer interface {
+	// StreamRates - calls fn for every rate between two dates ordered by quote currency and date,
+	// no quote currencies means all of them
+	StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error
+}
+
+// StreamRates - streams rates from repo, repositories that aren't a RateStreamer are read one currency at a time
+func StreamRates(ctx context.Context, repo DatabaseRepo, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	if streamer, ok := repo.(RateStreamer); ok {
+		return streamer.StreamRates(ctx, quoteCurrencies, fromDate, toDate, fn)
+	}
+	if len(quoteCurrencies) == 0 {
+		return errors.New("exporting all currencies is not supported by this database")
+	}
+
+	for _, quoteCurrency := range quoteCurrencies {
+		rates, err := repo.GetRatesInRange(ctx, quoteCurrency, fromDate, toDate)
+		if err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			if err = fn(rate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RateBatcher - repositories that can look up the rates of several currencies in one query
+type RateBatcher interface {
+	// GetRatesAsOf - the newest rate on or before date of every quote currency that has one
+	GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error)
+	// Currencies - quote currencies that have rates in alphabetical order
+	Currencies(ctx context.Context) ([]string, error)
+}
+
+// GetRatesAsOf - batched as-of lookup, repositories that aren't a RateBatcher are asked one currency at a time
+func GetRatesAsOf(ctx context.Context, repo DatabaseRepo, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	if batcher, ok := repo.(RateBatcher); ok {
+		return batcher.GetRatesAsOf(ctx, quoteCurrencies, date)
+	}
+
+	var rates []models.CurrencyRate
+	for _, quoteCurrency := range quoteCurrencies {
+		history, err := repo.GetRatesInRange(ctx, quoteCurrency, time.Time{}, date)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) > 0 {
+			rates = append(rates, history[len(history)-1])
+		}
+	}
+
+	return rates, nil
+}
+
+// Currencies - quote currencies of repo, only a RateBatcher can list them
+func Currencies(ctx context.Context, repo DatabaseRepo) ([]string, error) {
+	if batcher, ok := repo.(RateBatcher); ok {
+		return batcher.Currencies(ctx)
+	}
+
+	return nil, errors.New("listing currencies is not supported by this database")
+}
+
+// EventStore - repositories that record an event for every stored rate
+type EventStore interface {
+	// EventsSince - events with an id above afterID in id order, only of the quote currencies when any are given
+	EventsSince(ctx context.Context, afterID int64, quoteCurrencies []string, limit int) ([]models.RateEvent, error)
+	// LastEventID - id of the newest event, 0 when there are none
+	LastEventID(ctx context.Context) (int64, error)
+}
+
+// RateEditor - repositories that can change and remove stored rates
+type RateEditor interface {
+	// UpdateRate - changes the rate of the currency on the date of rate, ErrRateNotFound when there is none
+	UpdateRate(ctx context.Context, rate *models.CurrencyRate) error
+	// DeleteRate - removes the rate of the currency on date, ErrRateNotFound when there is none
+	DeleteRate(ctx context.Context, quoteCurrency string, date time.Time) error
+}
+
+// UpdateRate - updates a rate of repo, ErrNotSupported when it isn't a RateEditor
+func UpdateRate(ctx context.Context, repo DatabaseRepo, rate *models.CurrencyRate) error {
+	if editor, ok := repo.(RateEditor); ok {
+		return editor.UpdateRate(ctx, rate)
+	}
+
+	return ErrNotSupported
+}
+
+// DeleteRate - deletes a rate of repo, ErrNotSupported when it isn't a RateEditor
+func DeleteRate(ctx context.Context, repo DatabaseRepo, quoteCurrency string, date time.Time) error {
+	if editor, ok := repo.(RateEditor); ok {
+		return editor.DeleteRate(ctx, quoteCurrency, date)
+	}
+
+	return ErrNotSupported
+}
+
+// RateTypeStore - repositories that keep bid, ask and fixing rates next to the mid rate. The methods of
+// DatabaseRepo, RateStreamer, RateBatcher and RateEditor read and remove mid rates, CreateRate and UpdateRate
+// write the type of the rate they are given
+type RateTypeStore interface {
+	GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error)
+	GetRatesInRangeOfType(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error)
+	GetAllRatesOnDateOfType(ctx context.Context, date time.Time, rateType string) ([]models.CurrencyRate, error)
+	StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error
+	DeleteRateOfType(ctx context.Context, quoteCurrency string, date time.Time, rateType string) error
+}
+
+// SupportsRateType - whether repo can store and read rates of rateType, every repository keeps mid rates
+func SupportsRateType(repo DatabaseRepo, rateType string) bool {
+	if models.RateType(rateType) == models.RateMid {
+		return true
+	}
+	_, ok := repo.(RateTypeStore)
+
+	return ok
+}
+
+// GetLastRateOfType - newest rate of rateType, ErrNotSupported when repo only keeps mid rates
+func GetLastRateOfType(ctx context.Context, repo DatabaseRepo, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	if store, ok := repo.(RateTypeStore); ok {
+		return store.GetLastRateOfType(ctx, quoteCurrency, models.RateType(rateType))
+	}
+	if !SupportsRateType(repo, rateType) {
+		return models.CurrencyRate{}, ErrNotSupported
+	}
+
+	return repo.GetLastRate(ctx, quoteCurrency)
+}
+
+// GetRatesInRangeOfType - rates of rateType between two dates, ErrNotSupported when repo only keeps mid rates
+func GetRatesInRangeOfType(ctx context.Context, repo DatabaseRepo, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error) {
+	if store, ok := repo.(RateTypeStore); ok {
+		return store.GetRatesInRangeOfType(ctx, quoteCurrency, fromDate, toDate, models.RateType(rateType))
+	}
+	if !SupportsRateType(repo, rateType) {
+		return nil, ErrNotSupported
+	}
+
+	return repo.GetRatesInRange(ctx, quoteCurrency, fromDate, toDate)
+}
+
+// GetAllRatesOnDateOfType - rates of rateType on date, ErrNotSupported when repo only keeps mid rates
+func GetAllRatesOnDateOfType(ctx context.Context, repo DatabaseRepo, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	if store, ok := repo.(RateTypeStore); ok {
+		return store.GetAllRatesOnDateOfType(ctx, date, models.RateType(rateType))
+	}
+	if !SupportsRateType(repo, rateType) {
+		return nil, ErrNotSupported
+	}
+
+	return repo.GetAllRatesOnDate(ctx, date)
+}
+
+// GetRatesAsOfOfType - as-of lookup of rateType like GetRatesAsOf, mid rates are batched and the other types are
+// asked one currency at a time. ErrNotSupported when repo only keeps mid rates
+func GetRatesAsOfOfType(ctx context.Context, repo DatabaseRepo, quoteCurrencies []string, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	if models.RateType(rateType) == models.RateMid {
+		return GetRatesAsOf(ctx, repo, quoteCurrencies, date)
+	}
+	if !SupportsRateType(repo, rateType) {
+		return nil, ErrNotSupported
+	}
+
+	var rates []models.CurrencyRate
+	for _, quoteCurrency := range quoteCurrencies {
+		history, err := GetRatesInRangeOfType(ctx, repo, quoteCurrency, time.Time{}, date, rateType)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) > 0 {
+			rates = append(rates, history[len(history)-1])
+		}
+	}
+
+	return rates, nil
+}
+
+// StreamRatesOfType - streams rates of rateType like StreamRates, ErrNotSupported when repo only keeps mid rates
+func StreamRatesOfType(ctx context.Context, repo DatabaseRepo, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	if store, ok := repo.(RateTypeStore); ok {
+		return store.StreamRatesOfType(ctx, quoteCurrencies, fromDate, toDate, models.RateType(rateType), fn)
+	}
+	if !SupportsRateType(repo, rateType) {
+		return ErrNotSupported
+	}
+
+	return StreamRates(ctx, repo, quoteCurrencies, fromDate, toDate, fn)
+}
+
+// DeleteRateOfType - deletes a rate of rateType, ErrNotSupported when repo can't remove rates of that type
+func DeleteRateOfType(ctx context.Context, repo DatabaseRepo, quoteCurrency string, date time.Time, rateType string) error {
+	if store, ok := repo.(RateTypeStore); ok {
+		return store.DeleteRateOfType(ctx, quoteCurrency, date, models.RateType(rateType))
+	}
+	if !SupportsRateType(repo, rateType) {
+		return ErrNotSupported
+	}
+
+	return DeleteRate(ctx, repo, quoteCurrency, date)
+}
+
+// ErrWebhookNotFound - returned when a webhook id doesn't exist
+var ErrWebhookNotFound = errors.New("webhook doesn't exist")
+
+// ErrDeliveryNotFound - returned when a delivery id doesn't exist
+var ErrDeliveryNotFound = errors.New("webhook delivery doesn't exist")
+
+// WebhookStore - repositories that keep webhook endpoints and the queue of their deliveries
+type WebhookStore interface {
+	EventStore
+
+	// CreateWebhook - stores the webhook, its AfterEventID is set to the newest event
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	// Webhooks - every webhook in id order
+	Webhooks(ctx context.Context) ([]models.Webhook, error)
+	// GetWebhook - ErrWebhookNotFound when there is none with id
+	GetWebhook(ctx context.Context, id int64) (models.Webhook, error)
+	// DeleteWebhook - removes the webhook and its deliveries, ErrWebhookNotFound when there is none with id
+	DeleteWebhook(ctx context.Context, id int64) error
+
+	// WebhookCursor - id of the last event turned into deliveries, ok is false until a webhook is registered
+	WebhookCursor(ctx context.Context) (id int64, ok bool, err error)
+	// EnqueueDeliveries - stores deliveries and moves the cursor from afterID to lastID in one transaction,
+	// returns false without storing anything when another process moved the cursor first
+	EnqueueDeliveries(ctx context.Context, afterID int64, lastID int64, deliveries []models.WebhookDelivery) (bool, error)
+	// ClaimDeliveries - pending deliveries due at now in id order, their next attempt is pushed back by lease
+	// so other processes skip them while they are being sent
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// UpdateDelivery - stores the status, attempts, next attempt, error and delivery time of a delivery
+	UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	// RequeueDelivery - makes a delivery pending again with fresh attempts, due at now, in one step. False when it
+	// is pending and not due yet, because a process has claimed it or it waits for its next attempt
+	RequeueDelivery(ctx context.Context, id int64, now time.Time) (bool, error)
+	// GetDelivery - ErrDeliveryNotFound when there is none with id
+	GetDelivery(ctx context.Context, id int64) (models.WebhookDelivery, error)
+	// Deliveries - deliveries of a webhook newest first, only those with status when it isn't empty
+	Deliveries(ctx context.Context, webhookID int64, status string, limit int) ([]models.WebhookDelivery, error)
+}
+
+// ErrAlertRuleNotFound - returned when an alert rule id doesn't exist
+var ErrAlertRuleNotFound = errors.New("alert rule doesn't exist")
+
+// AlertStore - repositories that keep alert rules
+type AlertStore interface {
+	// CreateAlertRule - stores a new rule, it starts inactive
+	CreateAlertRule(ctx context.Context, rule *models.AlertRule) error
+	// AlertRules - rules of the quote currencies in id order, all of them when none are given
+	AlertRules(ctx context.Context, quoteCurrencies []string) ([]models.AlertRule, error)
+	// GetAlertRule - ErrAlertRuleNotFound when there is none with id
+	GetAlertRule(ctx context.Context, id int64) (models.AlertRule, error)
+	// DeleteAlertRule - ErrAlertRuleNotFound when there is none with id
+	DeleteAlertRule(ctx context.Context, id int64) error
+	// SetAlertRuleState - stores whether the condition of the rule holds and when it last started to
+	SetAlertRuleState(ctx context.Context, id int64, active bool, triggeredAt *time.Time) error
+	// ClaimAlertRule - makes an inactive rule active in one step, false when it was active already or is gone,
+	// so of several processes evaluating the same rule only one sends its alert
+	ClaimAlertRule(ctx context.Context, id int64, triggeredAt time.Time) (bool, error)
+}
+
+// ChangeListener - repositories that tell about rate changes made by any process, as soon as they are committed
+type ChangeListener interface {
+	// ListenForChanges - calls fn for every change until ctx is done. fn is called with nil when changes may have
+	// been missed, e.g. after the connection was lost
+	ListenForChanges(ctx context.Context, fn func(change *models.RateChange)) error
+}
+
+// OutboxStore - repositories that record an outbox message in the transaction of every rate change and keep how
+// far each sink got
+type OutboxStore interface {
+	// OutboxSince - messages with an id above afterID in id order
+	OutboxSince(ctx context.Context, afterID int64, limit int) ([]models.OutboxMessage, error)
+	// ClaimOutboxSink - makes owner the only publisher to sink until lease runs out, ok is false while another
+	// owner holds it. A sink claimed for the first time starts after the newest message
+	ClaimOutboxSink(ctx context.Context, sink string, owner string, lease time.Duration) (offset int64, ok bool, err error)
+	// SetOutboxOffset - stores the id of the last message published to sink, ok is false when owner lost the claim
+	SetOutboxOffset(ctx context.Context, sink string, owner string, offset int64) (ok bool, err error)
+	// DeleteOutboxSink - drops the offset of sink while owner holds it, for sinks that end with their process
+	DeleteOutboxSink(ctx context.Context, sink string, owner string) error
+}
+
+// Pruner - repositories that delete the events and outbox messages their readers are done with
+type Pruner interface {
+	// PruneEvents - deletes the events created before before that the webhook cursor is past, all of them when
+	// no webhook is registered
+	PruneEvents(ctx context.Context, before time.Time) (int64, error)
+	// PruneOutbox - drops the offsets of sinks nobody claimed since before, then deletes the messages created
+	// before before that every sink left published
+	PruneOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ProviderRunStore - repositories that keep which process fetches the rates of a provider on a day
+type ProviderRunStore interface {
+	// ClaimProviderRun - makes owner the only process fetching the rates of provider on day until lease runs out.
+	// ok is false while another owner holds it, done is true once the day was fetched
+	ClaimProviderRun(ctx context.Context, provider string, day time.Time, owner string, lease time.Duration) (ok bool, done bool, err error)
+	// FinishProviderRun - marks the fetch of provider on day done while owner holds it, no process fetches it again
+	FinishProviderRun(ctx context.Context, provider string, day time.Time, owner string) error
+}
+
+// SourceStore - repositories that keep the value of every source next to the published rate
+type SourceStore interface {
+	// SaveSourceRates - stores the values, a source giving a currency and date again replaces its value
+	SaveSourceRates(ctx context.Context, rates []models.SourceRate) error
+	// SourceRates - values of the quote currencies between two dates ordered by currency, date and source, no quote
+	// currencies means all of them
+	SourceRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time) ([]models.SourceRate, error)
+}
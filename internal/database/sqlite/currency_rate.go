@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const BaseCurrency = "USD"
+
+// CreateRate - creates new rate in db, returns ErrRateExists if the currency already has a rate of that type on
+// that date
+func (d *Database) CreateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	query := `insert into currency_rates
+		(base_currency, quote_currency, rate, date, rate_type) VALUES
+		($1, $2, $3, $4, $5)
+		on conflict (base_currency, quote_currency, date, rate_type) do nothing`
+
+	rate.BaseCurrency = BaseCurrency
+	rate.Type = models.RateType(rate.Type)
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		query,
+		rate.BaseCurrency,
+		strings.ToTitle(rate.QuoteCurrency),
+		rate.Rate.String(),
+		rate.Date.Format("2006-01-02"),
+		rate.Type,
+	)
+	if err != nil {
+		log.Println(err)
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrRateExists
+	}
+	id, _ := result.LastInsertId()
+	rate.ID = int(id)
+
+	return nil
+}
+
+// UpdateRate - changes the rate of the currency on the date and of the type of rate, returns ErrRateNotFound if
+// there is none
+func (d *Database) UpdateRate(ctx context.Context, rate *models.CurrencyRate) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	rate.BaseCurrency = BaseCurrency
+	rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+	rate.Type = models.RateType(rate.Type)
+
+	err := d.Client.QueryRowContext(
+		ctx,
+		"update currency_rates set rate = $1 where base_currency = $2 and quote_currency = $3 and date = $4 and rate_type = $5 returning id",
+		rate.Rate.String(),
+		rate.BaseCurrency,
+		rate.QuoteCurrency,
+		rate.Date.Format("2006-01-02"),
+		rate.Type,
+	).Scan(&rate.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrRateNotFound
+	}
+
+	return repository.WrapTimeout(ctx, err)
+}
+
+// DeleteRate - removes the mid rate of the currency on date, returns ErrRateNotFound if there is none
+func (d *Database) DeleteRate(ctx context.Context, quoteCurrency string, date time.Time) error {
+	return d.DeleteRateOfType(ctx, quoteCurrency, date, models.RateMid)
+}
+
+// DeleteRateOfType - removes the rate of rateType of the currency on date, returns ErrRateNotFound if there is none
+func (d *Database) DeleteRateOfType(ctx context.Context, quoteCurrency string, date time.Time, rateType string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		"delete from currency_rates where base_currency = $1 and quote_currency = $2 and date = $3 and rate_type = $4",
+		BaseCurrency,
+		strings.ToTitle(quoteCurrency),
+		date.Format("2006-01-02"),
+		rateType,
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrRateNotFound
+	}
+
+	return nil
+}
+
+// GetLastRate - gets last rate available for
+func (d *Database) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
+	return d.GetLastRateOfType(ctx, quoteCurrency, models.RateMid)
+}
+
+// GetLastRateOfType - gets last rate of rateType available for
+func (d *Database) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+
+	row := d.Client.QueryRowxContext(
+		ctx,
+		"select date, base_currency, quote_currency, rate, rate_type from currency_rates where quote_currency = $1 and rate_type = $2 order by date desc limit 1",
+		quoteCurrency,
+		rateType,
+	)
+	rate, err := scanRate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rate, fmt.Errorf("%w for %s", repository.ErrNoRates, quoteCurrency)
+	}
+	if err != nil {
+		return rate, repository.WrapTimeout(ctx, err)
+	}
+
+	return rate, nil
+}
+
+func (d *Database) GetRatesInRange(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) ([]models.CurrencyRate, error) {
+	return d.GetRatesInRangeOfType(ctx, quoteCurrency, fromDate, toDate, models.RateMid)
+}
+
+// GetRatesInRangeOfType - rates of rateType of the currency between two dates
+func (d *Database) GetRatesInRangeOfType(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time, rateType string) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	from := fromDate.Format("2006-01-02")
+	to := toDate.Format("2006-01-02")
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+
+	query := `select date, base_currency, quote_currency, rate, rate_type from currency_rates where quote_currency = $1 and rate_type = $2 and date between $3 and $4 order by date asc`
+
+	rows, err := d.Client.QueryxContext(
+		ctx,
+		query,
+		quoteCurrency,
+		rateType,
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	rates, err := scanRates(rows)
+
+	return rates, repository.WrapTimeout(ctx, err)
+}
+
+// CheckRateQuoteOnDateExists - Checks if rate exists in db
+func (d *Database) CheckRateQuoteOnDateExists(ctx context.Context, quoteCurrency string, date time.Time) bool {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	searchDate := date.Format("2006-01-02")
+	quoteCurrency = strings.ToTitle(quoteCurrency)
+
+	row := d.Client.QueryRowContext(
+		ctx,
+		"select id from currency_rates where quote_currency = $1 and date = $2 and rate_type = 'mid' limit 1",
+		quoteCurrency,
+		searchDate,
+	)
+
+	var id interface{}
+
+	if err := row.Scan(&id); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// GetAllRatesOnDate - gets all available rates on date
+func (d *Database) GetAllRatesOnDate(ctx context.Context, date time.Time) ([]models.CurrencyRate, error) {
+	return d.GetAllRatesOnDateOfType(ctx, date, models.RateMid)
+}
+
+// GetAllRatesOnDateOfType - gets all available rates of rateType on date
+func (d *Database) GetAllRatesOnDateOfType(ctx context.Context, date time.Time, rateType string) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	searchDate := date.Format("2006-01-02")
+
+	query := `select date, base_currency, quote_currency, rate, rate_type
+		from currency_rates
+		where date = $1 and rate_type = $2
+		order by quote_currency asc`
+
+	rows, err := d.Client.QueryxContext(
+		ctx,
+		query,
+		searchDate,
+		rateType,
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	rates, err := scanRates(rows)
+
+	return rates, repository.WrapTimeout(ctx, err)
+}
+
+// TableSeeded - checks if db table is already seeded
+func (d *Database) TableSeeded(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	row := d.Client.QueryRowContext(
+		ctx,
+		"select 1 from currency_rates limit 1",
+	)
+	var result interface{}
+	if err := row.Scan(&result); err != nil {
+		return false
+	}
+	return true
+}
+
+// BulkInsert - used only to bulk insert data from csv files, all rows are written in one transaction
+func (d *Database) BulkInsert(rates []models.CurrencyRate) error {
+	tx, err := d.Client.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Preparex(`INSERT INTO currency_rates (base_currency, quote_currency, rate, date, rate_type) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (base_currency, quote_currency, date, rate_type) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		_, err := stmt.Exec(rate.BaseCurrency, rate.QuoteCurrency, rate.Rate.String(), rate.Date.Format("2006-01-02"), models.RateType(rate.Type))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// scanner - common interface of sqlx.Row and sqlx.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRate - scans a date, base_currency, quote_currency, rate, rate_type row, sqlite keeps dates as text
+func scanRate(row scanner) (models.CurrencyRate, error) {
+	var rate models.CurrencyRate
+	var date string
+
+	if err := row.Scan(&date, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.Type); err != nil {
+		return rate, err
+	}
+
+	var err error
+	rate.Date, err = time.Parse("2006-01-02", date)
+
+	return rate, err
+}
+
+func scanRates(rows *sqlx.Rows) ([]models.CurrencyRate, error) {
+	var rates []models.CurrencyRate
+
+	for rows.Next() {
+		rate, err := scanRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// StreamRates - streams rates between two dates from a db cursor ordered by quote currency and date,
+// no quote currencies means all of them
+func (d *Database) StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	return d.StreamRatesOfType(ctx, quoteCurrencies, fromDate, toDate, models.RateMid, fn)
+}
+
+// StreamRatesOfType - streams rates of rateType like StreamRates. The read timeout is not applied,
+// a stream lasts as long as its consumer keeps reading and ends with ctx.
+func (d *Database) StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	query := `select date, base_currency, quote_currency, rate, rate_type
+		from currency_rates
+		where rate_type = ? and date between ? and ?`
+	args := []interface{}{rateType, fromDate.Format("2006-01-02"), toDate.Format("2006-01-02")}
+	if len(quoteCurrencies) > 0 {
+		placeholders := make([]string, len(quoteCurrencies))
+		for i, currency := range quoteCurrencies {
+			placeholders[i] = "?"
+			args = append(args, strings.ToTitle(currency))
+		}
+		query += " and quote_currency in (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " order by quote_currency asc, date asc"
+
+	rows, err := d.Client.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rate, err := scanRate(rows)
+		if err != nil {
+			return repository.WrapTimeout(ctx, err)
+		}
+		if err = fn(rate); err != nil {
+			return err
+		}
+	}
+
+	return repository.WrapTimeout(ctx, rows.Err())
+}
+
+// GetRatesAsOf - newest rate on or before date of every quote currency in one query
+func (d *Database) GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	if len(quoteCurrencies) == 0 {
+		return nil, nil
+	}
+
+	on := date.Format("2006-01-02")
+	placeholders := make([]string, len(quoteCurrencies))
+	args := []interface{}{on}
+	for i, currency := range quoteCurrencies {
+		placeholders[i] = "?"
+		args = append(args, strings.ToTitle(currency))
+	}
+
+	query := `select r.date, r.base_currency, r.quote_currency, r.rate, r.rate_type
+		from currency_rates r
+		join (
+			select quote_currency, max(date) as date
+			from currency_rates
+			where rate_type = 'mid' and date <= ? and quote_currency in (` + strings.Join(placeholders, ", ") + `)
+			group by quote_currency
+		) newest on newest.quote_currency = r.quote_currency and newest.date = r.date
+		where r.rate_type = 'mid'
+		order by r.quote_currency asc`
+
+	rows, err := d.Client.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	rates, err := scanRates(rows)
+
+	return rates, repository.WrapTimeout(ctx, err)
+}
+
+// Currencies - quote currencies that have rates
+func (d *Database) Currencies(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var currencies []string
+	err := d.Client.SelectContext(ctx, &currencies, "select distinct quote_currency from currency_rates where rate_type = 'mid' order by quote_currency asc")
+
+	return currencies, repository.WrapTimeout(ctx, err)
+}
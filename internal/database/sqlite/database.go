@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// DefaultPath - database file used when SQLITE_PATH is not set
+const DefaultPath = "rates.db"
+
+type Database struct {
+	Client   *sqlx.DB
+	Timeouts repository.Timeouts
+}
+
+// NewDatabase - returns a pointer to a database object backed by the sqlite file at path
+func NewDatabase(path string) *Database {
+	log.Println("Setting up new sqlite database", path)
+
+	db, err := sqlx.Connect("sqlite", path)
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+	// sqlite allows a single writer, serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 5000;"); err != nil {
+		log.Fatal("Error configuring database: ", err)
+	}
+
+	return &Database{
+		Client:   db,
+		Timeouts: repository.DefaultTimeouts,
+	}
+}
+
+// Ping - pings the db
+func (d *Database) Ping(ctx context.Context) error {
+	return d.Client.DB.PingContext(ctx)
+}
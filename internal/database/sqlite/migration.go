@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Shambou/golang-challenge/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Migrator - returns a migrate instance for the embedded migrations
+func (d *Database) Migrator() (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations.SQLite, "sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("could not read the migrations: %w", err)
+	}
+	driver, err := sqlite.WithInstance(d.Client.DB, &sqlite.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create the sqlite driver: %w", err)
+	}
+
+	return migrate.NewWithInstance("iofs", source, "sqlite", driver)
+}
+
+// MigrateDB - runs all migrations in the migrations/sqlite
+func (d *Database) MigrateDB() error {
+	log.Println("migrating our database")
+	m, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+
+	if err = m.Up(); err != nil {
+		return err
+	}
+
+	return nil
+}
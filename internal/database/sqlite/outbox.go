@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// OutboxSince - messages recorded by the currency_rates triggers after afterID
+func (d *Database) OutboxSince(ctx context.Context, afterID int64, limit int) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	rows, err := d.Client.QueryContext(
+		ctx,
+		"select id, topic, type, payload, created_at from outbox where id > $1 order by id limit $2",
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		var payload, createdAt string
+		if err := rows.Scan(&message.ID, &message.Topic, &message.Type, &payload, &createdAt); err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		message.Payload = []byte(payload)
+		if message.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// ClaimOutboxSink - makes owner the only publisher to sink until lease runs out, a new sink starts after the newest
+// message
+func (d *Database) ClaimOutboxSink(ctx context.Context, sink string, owner string, lease time.Duration) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into outbox_offsets (sink, last_id, locked_until)
+		values ($1, (select coalesce(max(id), 0) from outbox), $2)
+		on conflict (sink) do nothing`,
+		sink,
+		now.Format(timeFormat),
+	)
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+	result, err := tx.ExecContext(
+		ctx,
+		"update outbox_offsets set owner = $1, locked_until = $2 where sink = $3 and (owner = $1 or locked_until <= $4)",
+		owner,
+		now.Add(lease).Format(timeFormat),
+		sink,
+		now.Format(timeFormat),
+	)
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, false, nil
+	}
+
+	var offset int64
+	if err = tx.GetContext(ctx, &offset, "select last_id from outbox_offsets where sink = $1", sink); err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+
+	return offset, true, repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// SetOutboxOffset - stores the id of the last message published to sink while owner holds it
+func (d *Database) SetOutboxOffset(ctx context.Context, sink string, owner string, lastID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(ctx, "update outbox_offsets set last_id = $1 where sink = $2 and owner = $3", lastID, sink, owner)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	affected, _ := result.RowsAffected()
+
+	return affected > 0, nil
+}
+
+// DeleteOutboxSink - drops the offset of sink while owner holds it
+func (d *Database) DeleteOutboxSink(ctx context.Context, sink string, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	_, err := d.Client.ExecContext(ctx, "delete from outbox_offsets where sink = $1 and owner = $2", sink, owner)
+
+	return repository.WrapTimeout(ctx, err)
+}
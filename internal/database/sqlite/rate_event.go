@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// EventsSince - events recorded by the currency_rates trigger after afterID
+func (d *Database) EventsSince(ctx context.Context, afterID int64, quoteCurrencies []string, limit int) ([]models.RateEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	query := `select id, type, base_currency, quote_currency, rate, date, created_at from rate_events where id > ?`
+	args := []interface{}{afterID}
+	if len(quoteCurrencies) > 0 {
+		placeholders := make([]string, len(quoteCurrencies))
+		for i, currency := range quoteCurrencies {
+			placeholders[i] = "?"
+			args = append(args, currency)
+		}
+		query += " and quote_currency in (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " order by id asc limit ?"
+	args = append(args, limit)
+
+	rows, err := d.Client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var events []models.RateEvent
+	for rows.Next() {
+		var event models.RateEvent
+		var rate, date, createdAt string
+		err := rows.Scan(&event.ID, &event.Type, &event.BaseCurrency, &event.QuoteCurrency, &rate, &date, &createdAt)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		if event.Rate, err = decimal.NewFromString(rate); err != nil {
+			return nil, err
+		}
+		if event.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		if event.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// LastEventID - id of the newest event
+func (d *Database) LastEventID(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var id int64
+	err := d.Client.GetContext(ctx, &id, "select coalesce(max(id), 0) from rate_events")
+
+	return id, repository.WrapTimeout(ctx, err)
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// GetSeedFile - gets the seed record of path, nil if the file was never seeded
+func (d *Database) GetSeedFile(ctx context.Context, path string) (*models.SeedFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var file models.SeedFile
+	var updatedAt string
+	row := d.Client.QueryRowContext(
+		ctx,
+		"select path, checksum, lines, updated_at from seed_files where path = $1",
+		path,
+	)
+	err := row.Scan(&file.Path, &file.Checksum, &file.Lines, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+
+	return &file, err
+}
+
+// SaveSeedFile - creates or updates the seed record of a file
+func (d *Database) SaveSeedFile(ctx context.Context, file *models.SeedFile) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	file.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	query := `insert into seed_files (path, checksum, lines, updated_at) values ($1, $2, $3, $4)
+		on conflict (path) do update set checksum = excluded.checksum, lines = excluded.lines, updated_at = excluded.updated_at`
+
+	_, err := d.Client.ExecContext(ctx, query, file.Path, file.Checksum, file.Lines, file.UpdatedAt.Format(time.RFC3339))
+
+	return err
+}
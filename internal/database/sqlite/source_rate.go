@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// SaveSourceRates - stores the values in one transaction, a source giving a currency and date again replaces its
+// value
+func (d *Database) SaveSourceRates(ctx context.Context, rates []models.SourceRate) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, `insert into source_rates (base_currency, quote_currency, date, source, rate, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (quote_currency, date, base_currency, source) do update set rate = excluded.rate, updated_at = excluded.updated_at`)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(timeFormat)
+	for _, rate := range rates {
+		_, err = stmt.ExecContext(
+			ctx,
+			BaseCurrency,
+			strings.ToTitle(rate.QuoteCurrency),
+			rate.Date.Format("2006-01-02"),
+			rate.Source,
+			rate.Rate.String(),
+			now,
+		)
+		if err != nil {
+			return repository.WrapTimeout(ctx, err)
+		}
+	}
+
+	return repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// SourceRates - values of the quote currencies between two dates ordered by currency, date and source
+func (d *Database) SourceRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time) ([]models.SourceRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	query := `select source, base_currency, quote_currency, date, rate, updated_at
+		from source_rates
+		where date between ? and ?`
+	args := []interface{}{fromDate.Format("2006-01-02"), toDate.Format("2006-01-02")}
+	if len(quoteCurrencies) > 0 {
+		placeholders := make([]string, len(quoteCurrencies))
+		for i, currency := range quoteCurrencies {
+			placeholders[i] = "?"
+			args = append(args, strings.ToTitle(currency))
+		}
+		query += " and quote_currency in (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " order by quote_currency, date, source"
+
+	rows, err := d.Client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var rates []models.SourceRate
+	for rows.Next() {
+		var rate models.SourceRate
+		var date, value, updatedAt string
+		if err := rows.Scan(&rate.Source, &rate.BaseCurrency, &rate.QuoteCurrency, &date, &value, &updatedAt); err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		if rate.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		if rate.Rate, err = decimal.NewFromString(value); err != nil {
+			return nil, err
+		}
+		if rate.UpdatedAt, err = time.Parse(timeFormat, updatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, repository.WrapTimeout(ctx, rows.Err())
+}
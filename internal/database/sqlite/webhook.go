@@ -0,0 +1,375 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	repository "github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// timeFormat - fixed width UTC timestamps, so they compare in time order as text
+const timeFormat = "2006-01-02T15:04:05.000000Z"
+
+const deliveryColumns = `d.id, d.webhook_id, d.status, d.attempts, d.next_attempt_at, d.last_error, d.created_at, d.delivered_at,
+	e.id, e.type, e.base_currency, e.quote_currency, e.rate, e.date, e.created_at`
+
+// CreateWebhook - stores the webhook, the cursor starts at the newest event with the first webhook
+func (d *Database) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.GetContext(ctx, &webhook.AfterEventID, "select coalesce(max(id), 0) from rate_events"); err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	webhook.CreatedAt = time.Now().UTC()
+	result, err := tx.ExecContext(
+		ctx,
+		"insert into webhooks (url, secret, currencies, after_event_id, created_at) values ($1, $2, $3, $4, $5)",
+		webhook.URL,
+		webhook.Secret,
+		strings.Join(webhook.Currencies, ","),
+		webhook.AfterEventID,
+		webhook.CreatedAt.Format(timeFormat),
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if webhook.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into webhook_cursor (id, last_event_id) values (1, $1) on conflict (id) do nothing", webhook.AfterEventID)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+
+	return repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// Webhooks - every webhook in id order
+func (d *Database) Webhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	rows, err := d.Client.QueryContext(ctx, "select id, url, secret, currencies, after_event_id, created_at from webhooks order by id")
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, repository.WrapTimeout(ctx, rows.Err())
+}
+
+// GetWebhook - returns ErrWebhookNotFound if there is no webhook with id
+func (d *Database) GetWebhook(ctx context.Context, id int64) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	row := d.Client.QueryRowContext(ctx, "select id, url, secret, currencies, after_event_id, created_at from webhooks where id = $1", id)
+	webhook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook, repository.ErrWebhookNotFound
+	}
+
+	return webhook, repository.WrapTimeout(ctx, err)
+}
+
+// DeleteWebhook - removes the webhook and its deliveries
+func (d *Database) DeleteWebhook(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "delete from webhooks where id = $1", id)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrWebhookNotFound
+	}
+	if _, err = tx.ExecContext(ctx, "delete from webhook_deliveries where webhook_id = $1", id); err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+
+	return repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// WebhookCursor - id of the last event turned into deliveries
+func (d *Database) WebhookCursor(ctx context.Context) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	var id int64
+	err := d.Client.GetContext(ctx, &id, "select last_event_id from webhook_cursor where id = 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, repository.WrapTimeout(ctx, err)
+	}
+
+	return id, true, nil
+}
+
+// EnqueueDeliveries - queues deliveries and moves the cursor if it is still at afterID
+func (d *Database) EnqueueDeliveries(ctx context.Context, afterID int64, lastID int64, deliveries []models.WebhookDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update webhook_cursor set last_event_id = $1 where id = 1 and last_event_id = $2", lastID, afterID)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	now := time.Now().UTC().Format(timeFormat)
+	for _, delivery := range deliveries {
+		_, err = tx.ExecContext(
+			ctx,
+			`insert into webhook_deliveries (webhook_id, event_id, status, next_attempt_at, created_at)
+			values ($1, $2, $3, $4, $4)
+			on conflict (webhook_id, event_id) do nothing`,
+			delivery.WebhookID,
+			delivery.Event.ID,
+			models.DeliveryPending,
+			now,
+		)
+		if err != nil {
+			return false, repository.WrapTimeout(ctx, err)
+		}
+	}
+
+	return true, repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// ClaimDeliveries - pending deliveries due at now, their next attempt is pushed back by lease
+func (d *Database) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer tx.Rollback()
+
+	deliveries, err := queryDeliveries(
+		ctx,
+		tx,
+		`select `+deliveryColumns+`
+		from webhook_deliveries d join rate_events e on e.id = d.event_id
+		where d.status = $1 and d.next_attempt_at <= $2
+		order by d.id
+		limit $3`,
+		models.DeliveryPending,
+		now.UTC().Format(timeFormat),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	next := now.Add(lease).UTC()
+	for i := range deliveries {
+		_, err = tx.ExecContext(ctx, "update webhook_deliveries set next_attempt_at = $1 where id = $2", next.Format(timeFormat), deliveries[i].ID)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		deliveries[i].NextAttemptAt = next
+	}
+
+	return deliveries, repository.WrapTimeout(ctx, tx.Commit())
+}
+
+// UpdateDelivery - stores the outcome of an attempt
+func (d *Database) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	var deliveredAt interface{}
+	if delivery.DeliveredAt != nil {
+		deliveredAt = delivery.DeliveredAt.UTC().Format(timeFormat)
+	}
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		`update webhook_deliveries
+		set status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5
+		where id = $6`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC().Format(timeFormat),
+		delivery.LastError,
+		deliveredAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return repository.WrapTimeout(ctx, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return repository.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// RequeueDelivery - makes the delivery pending and due at now unless it is pending and not due yet
+func (d *Database) RequeueDelivery(ctx context.Context, id int64, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Write)
+	defer cancel()
+
+	result, err := d.Client.ExecContext(
+		ctx,
+		`update webhook_deliveries
+		set status = $1, attempts = 0, next_attempt_at = $2, last_error = '', delivered_at = null
+		where id = $3 and (status <> $1 or next_attempt_at <= $2)`,
+		models.DeliveryPending,
+		now.UTC().Format(timeFormat),
+		id,
+	)
+	if err != nil {
+		return false, repository.WrapTimeout(ctx, err)
+	}
+	affected, err := result.RowsAffected()
+
+	return affected == 1, err
+}
+
+// GetDelivery - returns ErrDeliveryNotFound if there is no delivery with id
+func (d *Database) GetDelivery(ctx context.Context, id int64) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	deliveries, err := queryDeliveries(
+		ctx,
+		d.Client,
+		`select `+deliveryColumns+` from webhook_deliveries d join rate_events e on e.id = d.event_id where d.id = $1`,
+		id,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return models.WebhookDelivery{}, repository.ErrDeliveryNotFound
+	}
+
+	return deliveries[0], nil
+}
+
+// Deliveries - deliveries of a webhook newest first
+func (d *Database) Deliveries(ctx context.Context, webhookID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Read)
+	defer cancel()
+
+	return queryDeliveries(
+		ctx,
+		d.Client,
+		`select `+deliveryColumns+`
+		from webhook_deliveries d join rate_events e on e.id = d.event_id
+		where d.webhook_id = $1 and ($2 = '' or d.status = $2)
+		order by d.id desc
+		limit $3`,
+		webhookID,
+		status,
+		limit,
+	)
+}
+
+// queryer - common interface of sqlx.DB and sqlx.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanWebhook(row scanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var currencies, createdAt string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &currencies, &webhook.AfterEventID, &createdAt)
+	if err != nil {
+		return webhook, err
+	}
+	if currencies != "" {
+		webhook.Currencies = strings.Split(currencies, ",")
+	}
+	webhook.CreatedAt, err = time.Parse(timeFormat, createdAt)
+
+	return webhook, err
+}
+
+func queryDeliveries(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repository.WrapTimeout(ctx, err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var nextAttemptAt, createdAt, rate, date, eventCreatedAt string
+		var deliveredAt sql.NullString
+		err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Status, &delivery.Attempts, &nextAttemptAt, &delivery.LastError, &createdAt, &deliveredAt,
+			&delivery.Event.ID, &delivery.Event.Type, &delivery.Event.BaseCurrency, &delivery.Event.QuoteCurrency, &rate, &date, &eventCreatedAt,
+		)
+		if err != nil {
+			return nil, repository.WrapTimeout(ctx, err)
+		}
+		if delivery.NextAttemptAt, err = time.Parse(timeFormat, nextAttemptAt); err != nil {
+			return nil, err
+		}
+		if delivery.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			at, err := time.Parse(timeFormat, deliveredAt.String)
+			if err != nil {
+				return nil, err
+			}
+			delivery.DeliveredAt = &at
+		}
+		if delivery.Event.Rate, err = decimal.NewFromString(rate); err != nil {
+			return nil, err
+		}
+		if delivery.Event.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		if delivery.Event.CreatedAt, err = time.Parse(time.RFC3339, eventCreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, repository.WrapTimeout(ctx, rows.Err())
+}
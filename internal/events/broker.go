@@ -0,0 +1,224 @@
+package events
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// DefaultPollInterval - how often the event store is checked when nothing calls Notify
+const DefaultPollInterval = time.Second
+
+// DefaultBufferSize - events a subscriber can fall behind before it is dropped
+const DefaultBufferSize = 256
+
+// BatchSize - events read from the store at once
+const BatchSize = 500
+
+// Broker - tails the event store and fans new events out to subscribers. Subscribers that can't keep up are
+// dropped instead of slowing everyone down, they can resume from the store with the id of their last event
+type Broker struct {
+	Store        database.EventStore
+	PollInterval time.Duration
+	BufferSize   int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	last   int64
+	ready  bool
+	closed bool
+	wake   chan struct{}
+}
+
+// Subscription - live events of some quote currencies, all of them when none are given
+type Subscription struct {
+	// Start - id of the last event before the subscription, everything after it is delivered on Events.
+	// Subscriptions made before the broker read the position of the store start at 0
+	Start int64
+
+	events     chan models.RateEvent
+	currencies map[string]bool
+	all        bool
+	broker     *Broker
+	once       sync.Once
+	slow       bool
+}
+
+// NewBroker - returns a broker over store, Run has to be called for it to deliver anything
+func NewBroker(store database.EventStore) *Broker {
+	return &Broker{
+		Store:        store,
+		PollInterval: DefaultPollInterval,
+		BufferSize:   DefaultBufferSize,
+		subs:         make(map[*Subscription]struct{}),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Run - polls the store until ctx is done, Notify makes it look right away
+func (b *Broker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Println("could not read rate events: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			b.Close()
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// Notify - tells the broker there may be new events, safe to call on a nil broker
+func (b *Broker) Notify() {
+	if b == nil {
+		return
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe - starts delivering events of currencies, returns nil once the broker is closed
+func (b *Broker) Subscribe(currencies []string) *Subscription {
+	sub := &Subscription{
+		events:     make(chan models.RateEvent, b.BufferSize),
+		currencies: make(map[string]bool, len(currencies)),
+		all:        len(currencies) == 0,
+		broker:     b,
+	}
+	for _, currency := range currencies {
+		sub.currencies[strings.ToTitle(currency)] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	sub.Start = b.last
+	b.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Close - ends every subscription, used on shutdown so open streams don't hold it up
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+func (b *Broker) poll(ctx context.Context) error {
+	b.mu.Lock()
+	ready, last := b.ready, b.last
+	b.mu.Unlock()
+
+	// only events stored from now on are live, older ones are read from the store by whoever asks for them
+	if !ready {
+		id, err := b.Store.LastEventID(ctx)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.last, b.ready = id, true
+		b.mu.Unlock()
+		return nil
+	}
+
+	for {
+		events, err := b.Store.EventsSince(ctx, last, nil, BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		b.publish(events)
+		last = events[len(events)-1].ID
+		if len(events) < BatchSize {
+			return nil
+		}
+	}
+}
+
+func (b *Broker) publish(events []models.RateEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		for sub := range b.subs {
+			if !sub.all && !sub.currencies[event.QuoteCurrency] {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				log.Printf("dropping rate event subscriber that is %d events behind", cap(sub.events))
+				sub.slow = true
+				b.drop(sub)
+			}
+		}
+		b.last = event.ID
+	}
+}
+
+// drop - ends a subscription, the caller holds the lock
+func (b *Broker) drop(sub *Subscription) {
+	delete(b.subs, sub)
+	sub.once.Do(func() {
+		close(sub.events)
+	})
+}
+
+// Events - closed when the subscriber falls too far behind or the broker shuts down
+func (s *Subscription) Events() <-chan models.RateEvent {
+	return s.events
+}
+
+// SetCurrencies - from now on only events of currencies are delivered, none when it is empty
+func (s *Subscription) SetCurrencies(currencies []string) {
+	set := make(map[string]bool, len(currencies))
+	for _, currency := range currencies {
+		set[strings.ToTitle(currency)] = true
+	}
+
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.currencies, s.all = set, false
+}
+
+// Close - stops the subscription
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.drop(s)
+}
+
+// Slow - true when the subscription ended because the subscriber fell too far behind
+func (s *Subscription) Slow() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return s.slow
+}
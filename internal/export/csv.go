@@ -0,0 +1,122 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// CSVRateDecimals - decimals the fxdata files write most rates with, trailing zeros past them are dropped
+const CSVRateDecimals = 4
+
+// CSV - one currency pair in the layout of the fxdata files, so an export can be seeded again
+//
+//	DATE,CHFUSD
+//	2016-01-29,1.0226
+//	2016-02-01,.
+type CSV struct {
+	w    *bufio.Writer
+	pair string
+	last time.Time
+}
+
+// NewCSV - returns a csv writer for a single currency pair
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: bufio.NewWriter(w)}
+}
+
+// Write - writes the header before the first rate, weekdays without a rate since the previous one get a . like in fxdata
+func (c *CSV) Write(rate models.CurrencyRate) error {
+	if c.pair == "" {
+		c.pair = pairName(rate)
+		if _, err := c.w.WriteString("DATE," + c.pair + "\n"); err != nil {
+			return err
+		}
+	} else {
+		for day := c.last.AddDate(0, 0, 1); day.Before(rate.Date); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				continue
+			}
+			if _, err := c.w.WriteString(day.Format("2006-01-02") + ",.\n"); err != nil {
+				return err
+			}
+		}
+	}
+	c.last = rate.Date
+
+	_, err := c.w.WriteString(rate.Date.Format("2006-01-02") + "," + formatRate(rate) + "\n")
+
+	return err
+}
+
+// Close - flushes the buffered lines
+func (c *CSV) Close() error {
+	return c.w.Flush()
+}
+
+// CSVZip - a zip archive with a csv file per currency pair
+type CSVZip struct {
+	zip  *zip.Writer
+	csv  *CSV
+	pair string
+}
+
+// NewCSVZip - returns a writer that starts a new csv file in the archive every time the quote currency changes
+func NewCSVZip(w io.Writer) *CSVZip {
+	return &CSVZip{zip: zip.NewWriter(w)}
+}
+
+// Write - writes rate to the csv file of its pair
+func (c *CSVZip) Write(rate models.CurrencyRate) error {
+	if pair := pairName(rate); pair != c.pair {
+		if c.csv != nil {
+			if err := c.csv.Close(); err != nil {
+				return err
+			}
+		}
+
+		f, err := c.zip.Create(pair + ".csv")
+		if err != nil {
+			return err
+		}
+		c.csv = NewCSV(f)
+		c.pair = pair
+	}
+
+	return c.csv.Write(rate)
+}
+
+// Close - flushes the last csv file and writes the zip directory
+func (c *CSVZip) Close() error {
+	if c.csv != nil {
+		if err := c.csv.Close(); err != nil {
+			return err
+		}
+	}
+
+	return c.zip.Close()
+}
+
+func pairName(rate models.CurrencyRate) string {
+	return strings.ToTitle(rate.QuoteCurrency + rate.BaseCurrency)
+}
+
+// formatRate - the rate with the decimals it was stored with, String would drop the trailing zero of 1.0070. Postgres
+// pads every rate to 6 decimals, trailing zeros past CSVRateDecimals are dropped so 1.022600 is written as 1.0226
+func formatRate(rate models.CurrencyRate) string {
+	exp := rate.Rate.Exponent()
+	if exp >= 0 {
+		return rate.Rate.String()
+	}
+
+	text := rate.Rate.StringFixed(-exp)
+	for decimals := -exp; decimals > CSVRateDecimals && strings.HasSuffix(text, "0"); decimals-- {
+		text = text[:len(text)-1]
+	}
+
+	return text
+}
@@ -0,0 +1,61 @@
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// Writer - writes rates to an io.Writer in one format, rates have to arrive ordered by quote currency and date
+type Writer interface {
+	Write(rate models.CurrencyRate) error
+	// Close - flushes whatever is buffered, it does not close the underlying io.Writer
+	Close() error
+}
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Formats - formats an export can be written in
+var Formats = []string{FormatCSV, FormatNDJSON, FormatParquet}
+
+// File - what to call an export and how to serve it
+type File struct {
+	Name        string
+	ContentType string
+}
+
+// NewWriter - returns a writer for format, csv exports of more than one currency are zipped with a file per pair
+func NewWriter(w io.Writer, format string, zipped bool) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		if zipped {
+			return NewCSVZip(w), nil
+		}
+		return NewCSV(w), nil
+	case FormatNDJSON:
+		return NewNDJSON(w), nil
+	case FormatParquet:
+		return NewParquet(w)
+	}
+
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// FileFor - name and content type of an export, name is used without the extension
+func FileFor(format string, name string, zipped bool) File {
+	switch {
+	case format == FormatCSV && zipped:
+		return File{Name: name + ".zip", ContentType: "application/zip"}
+	case format == FormatCSV:
+		return File{Name: name + ".csv", ContentType: "text/csv"}
+	case format == FormatNDJSON:
+		return File{Name: name + ".ndjson", ContentType: "application/x-ndjson"}
+	}
+
+	return File{Name: name + ".parquet", ContentType: "application/vnd.apache.parquet"}
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// NDJSON - one rate per line, readable by the ndjson seed importer
+//
+//	{"date":"2016-01-29","base_currency":"USD","quote_currency":"CHF","rate":"1.0226"}
+type NDJSON struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+type ndjsonRate struct {
+	Date          string `json:"date"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	Rate          string `json:"rate"`
+}
+
+// NewNDJSON - returns an ndjson writer
+func NewNDJSON(w io.Writer) *NDJSON {
+	buf := bufio.NewWriter(w)
+
+	return &NDJSON{w: buf, enc: json.NewEncoder(buf)}
+}
+
+// Write - writes rate as a single line, the rate keeps its full precision
+func (n *NDJSON) Write(rate models.CurrencyRate) error {
+	return n.enc.Encode(ndjsonRate{
+		Date:          rate.Date.Format("2006-01-02"),
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate.String(),
+	})
+}
+
+// Close - flushes the buffered lines
+func (n *NDJSON) Close() error {
+	return n.w.Flush()
+}
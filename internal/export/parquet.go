@@ -0,0 +1,57 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ParquetRateScale - decimals kept in the rate column of a parquet export
+const ParquetRateScale = 8
+
+// ParquetRowGroupSize - bytes of rows buffered before a row group is written, the library default is 128MB
+const ParquetRowGroupSize = 8 * 1024 * 1024
+
+// parquetRate - a row of a parquet export, date is a DATE column and rate a DECIMAL(18,8) so warehouses
+// don't have to parse strings
+type parquetRate struct {
+	Date          int32  `parquet:"name=date, type=INT32, convertedtype=DATE"`
+	BaseCurrency  string `parquet:"name=base_currency, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	QuoteCurrency string `parquet:"name=quote_currency, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Rate          int64  `parquet:"name=rate, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+}
+
+// Parquet - snappy compressed parquet file, at most ParquetRowGroupSize of rows is held in memory
+type Parquet struct {
+	w *writer.ParquetWriter
+}
+
+// NewParquet - returns a parquet writer
+func NewParquet(w io.Writer) (*Parquet, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRate), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	pw.RowGroupSize = ParquetRowGroupSize
+
+	return &Parquet{w: pw}, nil
+}
+
+// Write - adds rate to the current row group
+func (p *Parquet) Write(rate models.CurrencyRate) error {
+	return p.w.Write(parquetRate{
+		Date:          int32(rate.Date.Unix() / int64(24*time.Hour/time.Second)),
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate.Shift(ParquetRateScale).Round(0).IntPart(),
+	})
+}
+
+// Close - writes the last row group and the footer
+func (p *Parquet) Close() error {
+	return p.w.WriteStop()
+}
@@ -0,0 +1,22 @@
+package gql
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// NewHandler - serves graphql queries posted as {"query", "operationName", "variables"} over db
+func NewHandler(db database.DatabaseRepo) http.Handler {
+	h := &relay.Handler{Schema: graphql.MustParseSchema(schema, &Resolver{DB: db})}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(withLoaders(r.Context(), db)))
+	})
+}
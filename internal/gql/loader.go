@@ -0,0 +1,139 @@
+package gql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/graph-gophers/dataloader"
+)
+
+type loadersKey struct{}
+
+// loaders - batch the lookups of every resolver of one request, so a query over n currencies makes one
+// repository call per distinct date or range instead of n
+type loaders struct {
+	asOf      *dataloader.Loader
+	rateRange *dataloader.Loader
+}
+
+// withLoaders - adds fresh loaders to ctx, they cache results so they must not outlive the request
+func withLoaders(ctx context.Context, db database.DatabaseRepo) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		asOf:      dataloader.NewBatchedLoader(asOfBatch(db)),
+		rateRange: dataloader.NewBatchedLoader(rangeBatch(db)),
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// loadAsOf - newest rate of rateType of currency on or before date, nil when there is none
+func loadAsOf(ctx context.Context, currency string, date time.Time, rateType string) (*models.CurrencyRate, error) {
+	rates, err := loadAsOfMany(ctx, []string{currency}, date, rateType)
+	if err != nil {
+		return nil, err
+	}
+
+	return rates[0], nil
+}
+
+// loadAsOfMany - loadAsOf for several currencies, the keys are queued together so they end up in the same batch
+func loadAsOfMany(ctx context.Context, currencies []string, date time.Time, rateType string) ([]*models.CurrencyRate, error) {
+	keys := make(dataloader.Keys, len(currencies))
+	for i, currency := range currencies {
+		keys[i] = dataloader.StringKey(strings.ToTitle(currency) + " " + date.Format("2006-01-02") + " " + rateType)
+	}
+
+	values, errs := loadersFrom(ctx).asOf.LoadMany(ctx, keys)()
+	rates := make([]*models.CurrencyRate, len(values))
+	for i, value := range values {
+		if errs != nil && errs[i] != nil {
+			return nil, errs[i]
+		}
+		rates[i] = value.(*models.CurrencyRate)
+	}
+
+	return rates, nil
+}
+
+// loadRange - rates of rateType of currency between two dates
+func loadRange(ctx context.Context, currency string, from time.Time, to time.Time, rateType string) ([]models.CurrencyRate, error) {
+	key := strings.ToTitle(currency) + " " + from.Format("2006-01-02") + " " + to.Format("2006-01-02") + " " + rateType
+	value, err := loadersFrom(ctx).rateRange.Load(ctx, dataloader.StringKey(key))()
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]models.CurrencyRate), nil
+}
+
+// asOfBatch - one GetRatesAsOfOfType per distinct date and type, keys are "CHF 2016-02-01 mid"
+func asOfBatch(db database.DatabaseRepo) dataloader.BatchFunc {
+	return func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		results := make([]*dataloader.Result, len(keys))
+		for rest, group := range groupKeys(keys) {
+			date, rateType, _ := strings.Cut(rest, " ")
+			on, _ := time.Parse("2006-01-02", date)
+			rates, err := database.GetRatesAsOfOfType(ctx, db, group.currencies, on, rateType)
+
+			byCurrency := make(map[string]*models.CurrencyRate, len(rates))
+			for i := range rates {
+				byCurrency[rates[i].QuoteCurrency] = &rates[i]
+			}
+			for i, currency := range group.currencies {
+				results[group.indexes[i]] = &dataloader.Result{Data: byCurrency[currency], Error: err}
+			}
+		}
+
+		return results
+	}
+}
+
+// rangeBatch - one StreamRatesOfType per distinct range and type, keys are "CHF 2016-01-01 2016-02-01 mid"
+func rangeBatch(db database.DatabaseRepo) dataloader.BatchFunc {
+	return func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		results := make([]*dataloader.Result, len(keys))
+		for rest, group := range groupKeys(keys) {
+			fields := strings.Fields(rest)
+			from, _ := time.Parse("2006-01-02", fields[0])
+			to, _ := time.Parse("2006-01-02", fields[1])
+
+			byCurrency := make(map[string][]models.CurrencyRate, len(group.currencies))
+			err := database.StreamRatesOfType(ctx, db, group.currencies, from, to, fields[2], func(rate models.CurrencyRate) error {
+				byCurrency[rate.QuoteCurrency] = append(byCurrency[rate.QuoteCurrency], rate)
+				return nil
+			})
+			for i, currency := range group.currencies {
+				results[group.indexes[i]] = &dataloader.Result{Data: byCurrency[currency], Error: err}
+			}
+		}
+
+		return results
+	}
+}
+
+// keyGroup - currencies of the keys that share everything after the currency, and where the keys were in the batch
+type keyGroup struct {
+	currencies []string
+	indexes    []int
+}
+
+func groupKeys(keys dataloader.Keys) map[string]*keyGroup {
+	groups := make(map[string]*keyGroup)
+	for i, key := range keys {
+		currency, rest, _ := strings.Cut(key.String(), " ")
+		group, ok := groups[rest]
+		if !ok {
+			group = &keyGroup{}
+			groups[rest] = group
+		}
+		group.currencies = append(group.currencies, currency)
+		group.indexes = append(group.indexes, i)
+	}
+
+	return groups
+}
@@ -0,0 +1,286 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/shopspring/decimal"
+)
+
+// ConversionScale - decimals of a conversion rate and result
+const ConversionScale = 8
+
+// Resolver - root of the schema, every lookup goes through the request loaders
+type Resolver struct {
+	DB database.DatabaseRepo
+}
+
+// Currencies - every quote currency with rates
+func (r *Resolver) Currencies(ctx context.Context) ([]*currencyResolver, error) {
+	codes, err := database.Currencies(ctx, r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make([]*currencyResolver, len(codes))
+	for i, code := range codes {
+		currencies[i] = &currencyResolver{code: code}
+	}
+
+	return currencies, nil
+}
+
+// Currency - one currency by its code
+func (r *Resolver) Currency(args struct{ Code string }) (*currencyResolver, error) {
+	if err := validator.LatestRate(args.Code).Err(); err != nil {
+		return nil, err
+	}
+
+	return &currencyResolver{code: strings.ToTitle(args.Code)}, nil
+}
+
+// Latest - latest rate of each currency
+func (r *Resolver) Latest(ctx context.Context, args struct {
+	Currencies []string
+	Type       *string
+}) ([]*rateResolver, error) {
+	return asOf(ctx, args.Currencies, today(), args.Type)
+}
+
+// AsOf - newest rate on or before date of each currency
+func (r *Resolver) AsOf(ctx context.Context, args struct {
+	Currencies []string
+	Date       string
+	Type       *string
+}) ([]*rateResolver, error) {
+	if err := validator.Timeseries(args.Date).Err(); err != nil {
+		return nil, err
+	}
+	date, _ := time.Parse("2006-01-02", args.Date)
+
+	return asOf(ctx, args.Currencies, date, args.Type)
+}
+
+// Range - rates of a currency between two dates
+func (r *Resolver) Range(ctx context.Context, args struct {
+	Currency, From, To string
+	Type               *string
+}) ([]*rateResolver, error) {
+	return (&currencyResolver{code: args.Currency}).Range(ctx, rangeArgs{args.From, args.To, args.Type})
+}
+
+// Convert - converts amount through the base currency, every stored rate is units of quote currency per base currency
+func (r *Resolver) Convert(ctx context.Context, args struct {
+	Amount, From, To string
+	Date             *string
+}) (*conversionResolver, error) {
+	if err := validator.Conversion(args.Amount, args.From, args.To).Err(); err != nil {
+		return nil, err
+	}
+	date := today()
+	if args.Date != nil {
+		if err := validator.Timeseries(*args.Date).Err(); err != nil {
+			return nil, err
+		}
+		date, _ = time.Parse("2006-01-02", *args.Date)
+	}
+
+	amount, _ := decimal.NewFromString(args.Amount)
+	rates, err := baseRates(ctx, []string{args.From, args.To}, date)
+	if err != nil {
+		return nil, err
+	}
+	from, to := rates[0], rates[1]
+
+	return &conversionResolver{
+		from:   strings.ToTitle(args.From),
+		to:     strings.ToTitle(args.To),
+		amount: amount,
+		rate:   to.DivRound(from, ConversionScale),
+		result: amount.Mul(to).DivRound(from, ConversionScale),
+	}, nil
+}
+
+// baseRates - units of each currency per base currency on date
+func baseRates(ctx context.Context, currencies []string, date time.Time) ([]decimal.Decimal, error) {
+	loaded, err := loadAsOfMany(ctx, currencies, date, models.RateMid)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]decimal.Decimal, len(currencies))
+	for i, currency := range currencies {
+		switch {
+		case strings.EqualFold(currency, database.BaseCurrency):
+			rates[i] = decimal.NewFromInt(1)
+		case loaded[i] == nil:
+			return nil, fmt.Errorf("%w for %s", database.ErrNoRates, strings.ToTitle(currency))
+		default:
+			rates[i] = loaded[i].Rate
+		}
+	}
+
+	return rates, nil
+}
+
+func asOf(ctx context.Context, currencies []string, date time.Time, t *string) ([]*rateResolver, error) {
+	rateType, err := rateTypeOf(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, currency := range currencies {
+		if err := validator.LatestRate(currency).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rates, err := loadAsOfMany(ctx, currencies, date, rateType)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*rateResolver, len(rates))
+	for i, rate := range rates {
+		if rate != nil {
+			resolvers[i] = &rateResolver{*rate, rateType}
+		}
+	}
+
+	return resolvers, nil
+}
+
+// rateTypeOf - validated type argument, mid when it is left out
+func rateTypeOf(t *string) (string, error) {
+	if t == nil {
+		return models.RateMid, nil
+	}
+	if err := validator.New(map[string]string{}).RateType(*t).Err(); err != nil {
+		return "", err
+	}
+
+	return models.RateType(*t), nil
+}
+
+// today - rates can't be stored for future dates, so the newest rate on or before today is the latest
+func today() time.Time {
+	return time.Now().UTC()
+}
+
+type currencyResolver struct {
+	code string
+}
+
+func (c *currencyResolver) Code() string {
+	return c.code
+}
+
+func (c *currencyResolver) Latest(ctx context.Context, args struct{ Type *string }) (*rateResolver, error) {
+	return c.AsOf(ctx, asOfArgs{today().Format("2006-01-02"), args.Type})
+}
+
+type asOfArgs struct {
+	Date string
+	Type *string
+}
+
+func (c *currencyResolver) AsOf(ctx context.Context, args asOfArgs) (*rateResolver, error) {
+	if err := validator.Timeseries(args.Date).Err(); err != nil {
+		return nil, err
+	}
+	rateType, err := rateTypeOf(args.Type)
+	if err != nil {
+		return nil, err
+	}
+	date, _ := time.Parse("2006-01-02", args.Date)
+
+	rate, err := loadAsOf(ctx, c.code, date, rateType)
+	if err != nil || rate == nil {
+		return nil, err
+	}
+
+	return &rateResolver{*rate, rateType}, nil
+}
+
+type rangeArgs struct {
+	From, To string
+	Type     *string
+}
+
+func (c *currencyResolver) Range(ctx context.Context, args rangeArgs) ([]*rateResolver, error) {
+	if err := validator.RatesInRange(c.code, args.From, args.To).Err(); err != nil {
+		return nil, err
+	}
+	rateType, err := rateTypeOf(args.Type)
+	if err != nil {
+		return nil, err
+	}
+	from, _ := time.Parse("2006-01-02", args.From)
+	to, _ := time.Parse("2006-01-02", args.To)
+
+	rates, err := loadRange(ctx, c.code, from, to, rateType)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*rateResolver, len(rates))
+	for i, rate := range rates {
+		resolvers[i] = &rateResolver{rate, rateType}
+	}
+
+	return resolvers, nil
+}
+
+type rateResolver struct {
+	rate     models.CurrencyRate
+	rateType string
+}
+
+func (r *rateResolver) Date() string {
+	return r.rate.Date.Format("2006-01-02")
+}
+
+func (r *rateResolver) BaseCurrency() string {
+	return r.rate.BaseCurrency
+}
+
+func (r *rateResolver) QuoteCurrency() string {
+	return r.rate.QuoteCurrency
+}
+
+func (r *rateResolver) Rate() string {
+	return r.rate.Rate.String()
+}
+
+func (r *rateResolver) Type() string {
+	return r.rateType
+}
+
+type conversionResolver struct {
+	from, to             string
+	amount, rate, result decimal.Decimal
+}
+
+func (c *conversionResolver) From() string {
+	return c.from
+}
+
+func (c *conversionResolver) To() string {
+	return c.to
+}
+
+func (c *conversionResolver) Amount() string {
+	return c.amount.String()
+}
+
+func (c *conversionResolver) Rate() string {
+	return c.rate.String()
+}
+
+func (c *conversionResolver) Result() string {
+	return c.result.String()
+}
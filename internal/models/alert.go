@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Types of alert rules
+const (
+	// AlertThreshold - the latest rate is above or below Value
+	AlertThreshold = "threshold"
+	// AlertMove - the latest rate moved more than Value percent from the rate before it
+	AlertMove = "move"
+	// AlertStale - no rate for Value business days
+	AlertStale = "stale"
+)
+
+// Conditions of threshold rules
+const (
+	AlertAbove = "above"
+	AlertBelow = "below"
+)
+
+// AlertRule - a condition on the rates of a quote currency and where to send a note when it starts to hold
+type AlertRule struct {
+	ID            int64  `json:"id"`
+	Type          string `json:"type"`
+	QuoteCurrency string `json:"quote_currency"`
+	// Condition - above or below, only used by threshold rules
+	Condition string          `json:"condition"`
+	Value     decimal.Decimal `json:"value"`
+	// Notifier - name of the notifier matches are sent through, Target is passed on to it, e.g. a url
+	Notifier string `json:"notifier"`
+	Target   string `json:"target"`
+	// Active - the condition held at the last evaluation, a rule notifies again only after it stopped holding
+	Active      bool       `json:"active"`
+	TriggeredAt *time.Time `json:"triggered_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Alert - a rule whose condition started to hold
+type Alert struct {
+	Rule    AlertRule `json:"rule"`
+	Message string    `json:"message"`
+	// Rate - latest rate of the currency when the rule matched
+	Rate        CurrencyRate `json:"rate"`
+	TriggeredAt time.Time    `json:"triggered_at"`
+}
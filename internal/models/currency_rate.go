@@ -6,10 +6,31 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// Rate types, a rate stored without one is a mid
+const (
+	RateMid    = "mid"
+	RateBid    = "bid"
+	RateAsk    = "ask"
+	RateFixing = "fixing"
+)
+
+// RateTypes - every rate type in the order they are listed in errors and docs
+var RateTypes = []string{RateMid, RateBid, RateAsk, RateFixing}
+
 type CurrencyRate struct {
 	ID            int             `json:"id"`
 	BaseCurrency  string          `json:"base_currency"`
 	QuoteCurrency string          `json:"quote_currency"`
 	Rate          decimal.Decimal `json:"rate"`
 	Date          time.Time       `json:"date"`
+	Type          string          `json:"type"`
+}
+
+// RateType - rateType, or RateMid when it is empty
+func RateType(rateType string) string {
+	if rateType == "" {
+		return RateMid
+	}
+
+	return rateType
 }
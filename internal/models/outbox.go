@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxMessage - a rate change recorded in the same transaction as the change itself, published to the
+// outbox sinks afterwards
+type OutboxMessage struct {
+	ID int64 `json:"id"`
+	// Topic - rates.{quote currency}, messages of one topic are published in id order
+	Topic     string          `json:"topic"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
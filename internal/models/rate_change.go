@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RateChange - a rate was created, updated or deleted, sent between processes so they can drop what they cached
+type RateChange struct {
+	// Type - rate.created, rate.updated or rate.deleted
+	Type          string    `json:"type"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Date          time.Time `json:"date"`
+	// To - last date of a change of several rates at once, zero when only Date changed
+	To time.Time `json:"to"`
+}
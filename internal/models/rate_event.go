@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Types of rate events, deleted events carry the rate that was removed
+const (
+	RateEventCreated = "rate.created"
+	RateEventUpdated = "rate.updated"
+	RateEventDeleted = "rate.deleted"
+)
+
+// RateEvent - a change to a rate, IDs only ever grow so they double as the position in the event stream
+type RateEvent struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	BaseCurrency  string          `json:"base_currency"`
+	QuoteCurrency string          `json:"quote_currency"`
+	Rate          decimal.Decimal `json:"rate"`
+	Date          time.Time       `json:"date"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// SeedFile - how much of an fxdata file the seeder has loaded
+type SeedFile struct {
+	Path string `json:"path"`
+	// Checksum - sha256 of the first Lines lines of the file
+	Checksum  string    `json:"checksum"`
+	Lines     int       `json:"lines"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Sources the API records itself, providers and imports use their own names
+const (
+	SourceAPI = "api"
+)
+
+// SourceRate - the value one source gave for a currency on a date, the published rate in currency_rates is
+// reconciled from these
+type SourceRate struct {
+	Source        string          `json:"source"`
+	BaseCurrency  string          `json:"base_currency"`
+	QuoteCurrency string          `json:"quote_currency"`
+	Date          time.Time       `json:"date"`
+	Rate          decimal.Decimal `json:"rate"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Delivery statuses, pending deliveries are retried until they are delivered or run out of attempts
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook - an endpoint that is sent the rate events of some quote currencies, all of them when none are given
+type Webhook struct {
+	ID         int64    `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"-"`
+	Currencies []string `json:"currencies"`
+	// AfterEventID - newest event when the webhook was registered, only later events are sent to it
+	AfterEventID int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Wants - true when events of quoteCurrency are sent to the webhook
+func (w Webhook) Wants(quoteCurrency string) bool {
+	if len(w.Currencies) == 0 {
+		return true
+	}
+	for _, currency := range w.Currencies {
+		if currency == quoteCurrency {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery - one event queued for one webhook
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	Event         RateEvent  `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
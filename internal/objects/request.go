@@ -5,4 +5,23 @@ import "github.com/shopspring/decimal"
 type PostRateRequest struct {
 	Date string          `json:"date"`
 	Rate decimal.Decimal `json:"rate"`
+	// Type - mid, bid, ask or fixing, a mid rate when it is left out
+	Type string `json:"type"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	Currencies []string `json:"currencies"`
+	// Secret - key of the delivery signatures, generated when left out
+	Secret string `json:"secret"`
+}
+
+type AlertRuleRequest struct {
+	Type      string `json:"type"`
+	Currency  string `json:"currency"`
+	Condition string `json:"condition"`
+	// Value - the rate of threshold rules, percent of move rules and business days of stale rules
+	Value    string `json:"value"`
+	Notifier string `json:"notifier"`
+	Target   string `json:"target"`
 }
@@ -1,34 +1,204 @@
 package objects
 
+import "github.com/Shambou/golang-challenge/internal/models"
+
 type JsonDateRateResponse struct {
-	Date string `json:"date"`
-	Rate string `json:"rate"`
+	Date string `json:"date" xml:"date"`
+	Rate string `json:"rate" xml:"rate"`
 }
 
 type JsonDateRateResponses []JsonDateRateResponse
 
 type JsonQuoteRateResponse struct {
-	QuoteCurrency string `json:"quote_currency"`
-	Rate          string `json:"rate"`
+	QuoteCurrency string `json:"quote_currency" xml:"quote_currency"`
+	Rate          string `json:"rate" xml:"rate"`
 }
 
 type JsonQuoteRateResponses []JsonQuoteRateResponse
 
 type BaseRateResponse struct {
-	Date          string `json:"date"`
-	BaseCurrency  string `json:"base_currency"`
-	QuoteCurrency string `json:"quote_currency"`
-	Rate          string `json:"rate"`
+	Date          string `json:"date" xml:"date"`
+	BaseCurrency  string `json:"base_currency" xml:"base_currency"`
+	QuoteCurrency string `json:"quote_currency" xml:"quote_currency"`
+	Rate          string `json:"rate" xml:"rate"`
+	Type          string `json:"type" xml:"type"`
 }
 
 type RangeRatesResponse struct {
-	BaseCurrency  string                `json:"base_currency"`
-	QuoteCurrency string                `json:"quote_currency"`
-	Rates         JsonDateRateResponses `json:"rates"`
+	BaseCurrency  string                `json:"base_currency" xml:"base_currency"`
+	QuoteCurrency string                `json:"quote_currency" xml:"quote_currency"`
+	Type          string                `json:"type" xml:"type"`
+	Rates         JsonDateRateResponses `json:"rates" xml:"rates>rate"`
 }
 
 type QuoteRatesResponse struct {
-	BaseCurrency string                 `json:"base_currency"`
-	Date         string                 `json:"date"`
-	Rates        JsonQuoteRateResponses `json:"rates"`
+	BaseCurrency string                 `json:"base_currency" xml:"base_currency"`
+	Date         string                 `json:"date" xml:"date"`
+	Type         string                 `json:"type" xml:"type"`
+	Rates        JsonQuoteRateResponses `json:"rates" xml:"rates>rate"`
+}
+
+// rateHeader - every rate response has the same csv columns so spreadsheets can be appended to each other
+var rateHeader = []string{"date", "base_currency", "quote_currency", "rate"}
+
+// rateTable - adds a type column to the rows of bid, ask and fixing rates, mid rates keep the columns they always had
+func rateTable(rateType string, rows [][]string) ([]string, [][]string) {
+	if models.RateType(rateType) == models.RateMid {
+		return rateHeader, rows
+	}
+	for i := range rows {
+		rows[i] = append(rows[i], rateType)
+	}
+
+	return append(rateHeader[:len(rateHeader):len(rateHeader)], "type"), rows
+}
+
+// Table - the rate as a single csv row
+func (b BaseRateResponse) Table() ([]string, [][]string) {
+	return rateTable(b.Type, [][]string{{b.Date, b.BaseCurrency, b.QuoteCurrency, b.Rate}})
+}
+
+// Table - a csv row per date
+func (r RangeRatesResponse) Table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Rates))
+	for i, rate := range r.Rates {
+		rows[i] = []string{rate.Date, r.BaseCurrency, r.QuoteCurrency, rate.Rate}
+	}
+
+	return rateTable(r.Type, rows)
+}
+
+// Table - a csv row per quote currency
+func (q QuoteRatesResponse) Table() ([]string, [][]string) {
+	rows := make([][]string, len(q.Rates))
+	for i, rate := range q.Rates {
+		rows[i] = []string{q.Date, q.BaseCurrency, rate.QuoteCurrency, rate.Rate}
+	}
+
+	return rateTable(q.Type, rows)
+}
+
+type JsonSpreadResponse struct {
+	Date string `json:"date" xml:"date"`
+	Bid  string `json:"bid" xml:"bid"`
+	Ask  string `json:"ask" xml:"ask"`
+	// Spread - ask minus bid
+	Spread string `json:"spread" xml:"spread"`
+	// SpreadPercent - the spread in percent of the mid between bid and ask
+	SpreadPercent string `json:"spread_percent" xml:"spread_percent"`
+}
+
+type SpreadResponse struct {
+	BaseCurrency  string               `json:"base_currency" xml:"base_currency"`
+	QuoteCurrency string               `json:"quote_currency" xml:"quote_currency"`
+	Spreads       []JsonSpreadResponse `json:"spreads" xml:"spreads>spread"`
+	// Average - average spread in percent over the dates, empty when there are none
+	Average string `json:"average_spread_percent,omitempty" xml:"average_spread_percent,omitempty"`
+}
+
+// Table - a csv row per date
+func (s SpreadResponse) Table() ([]string, [][]string) {
+	rows := make([][]string, len(s.Spreads))
+	for i, spread := range s.Spreads {
+		rows[i] = []string{spread.Date, s.BaseCurrency, s.QuoteCurrency, spread.Bid, spread.Ask, spread.Spread, spread.SpreadPercent}
+	}
+
+	return []string{"date", "base_currency", "quote_currency", "bid", "ask", "spread", "spread_percent"}, rows
+}
+
+type RateEventResponse struct {
+	ID            int64  `json:"id" xml:"id"`
+	Type          string `json:"type" xml:"type"`
+	Date          string `json:"date" xml:"date"`
+	BaseCurrency  string `json:"base_currency" xml:"base_currency"`
+	QuoteCurrency string `json:"quote_currency" xml:"quote_currency"`
+	Rate          string `json:"rate" xml:"rate"`
+}
+
+type WebhookResponse struct {
+	ID         int64    `json:"id" xml:"id"`
+	URL        string   `json:"url" xml:"url"`
+	Currencies []string `json:"currencies" xml:"currencies>currency"`
+	// Secret - only returned when the webhook is registered
+	Secret    string `json:"secret,omitempty" xml:"secret,omitempty"`
+	CreatedAt string `json:"created_at" xml:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID            int64             `json:"id" xml:"id"`
+	WebhookID     int64             `json:"webhook_id" xml:"webhook_id"`
+	Event         RateEventResponse `json:"event" xml:"event"`
+	Status        string            `json:"status" xml:"status"`
+	Attempts      int               `json:"attempts" xml:"attempts"`
+	NextAttemptAt string            `json:"next_attempt_at" xml:"next_attempt_at"`
+	LastError     string            `json:"last_error" xml:"last_error"`
+	CreatedAt     string            `json:"created_at" xml:"created_at"`
+	DeliveredAt   string            `json:"delivered_at,omitempty" xml:"delivered_at,omitempty"`
+}
+
+type AlertRuleResponse struct {
+	ID            int64  `json:"id" xml:"id"`
+	Type          string `json:"type" xml:"type"`
+	QuoteCurrency string `json:"quote_currency" xml:"quote_currency"`
+	Condition     string `json:"condition,omitempty" xml:"condition,omitempty"`
+	Value         string `json:"value" xml:"value"`
+	Notifier      string `json:"notifier" xml:"notifier"`
+	Target        string `json:"target,omitempty" xml:"target,omitempty"`
+	Active        bool   `json:"active" xml:"active"`
+	TriggeredAt   string `json:"triggered_at,omitempty" xml:"triggered_at,omitempty"`
+	CreatedAt     string `json:"created_at" xml:"created_at"`
+}
+
+// NewRateEventResponse - the rate event as the stream, websocket and webhooks send it
+func NewRateEventResponse(event models.RateEvent) RateEventResponse {
+	return RateEventResponse{
+		ID:            event.ID,
+		Type:          event.Type,
+		Date:          event.Date.Format("2006-01-02"),
+		BaseCurrency:  event.BaseCurrency,
+		QuoteCurrency: event.QuoteCurrency,
+		Rate:          event.Rate.String(),
+	}
+}
+
+type SourceRateResponse struct {
+	Source    string `json:"source" xml:"source"`
+	Rate      string `json:"rate" xml:"rate"`
+	UpdatedAt string `json:"updated_at" xml:"updated_at"`
+}
+
+type DisagreementResponse struct {
+	Date          string `json:"date" xml:"date"`
+	BaseCurrency  string `json:"base_currency" xml:"base_currency"`
+	QuoteCurrency string `json:"quote_currency" xml:"quote_currency"`
+	// Published - the rate in currency_rates, empty when there is none
+	Published string `json:"published,omitempty" xml:"published,omitempty"`
+	// Reconciled - the rate the policy gives, empty when it rejects the sources
+	Reconciled string               `json:"reconciled,omitempty" xml:"reconciled,omitempty"`
+	Source     string               `json:"source,omitempty" xml:"source,omitempty"`
+	Spread     string               `json:"spread" xml:"spread"`
+	Rejected   bool                 `json:"rejected" xml:"rejected"`
+	Sources    []SourceRateResponse `json:"sources" xml:"sources>source"`
+}
+
+type DisagreementResponses []DisagreementResponse
+
+// Table - a csv row per source value
+func (d DisagreementResponses) Table() ([]string, [][]string) {
+	var rows [][]string
+	for _, disagreement := range d {
+		for _, source := range disagreement.Sources {
+			rows = append(rows, []string{
+				disagreement.Date,
+				disagreement.BaseCurrency,
+				disagreement.QuoteCurrency,
+				source.Source,
+				source.Rate,
+				disagreement.Published,
+				disagreement.Reconciled,
+			})
+		}
+	}
+
+	return []string{"date", "base_currency", "quote_currency", "source", "rate", "published", "reconciled"}, rows
 }
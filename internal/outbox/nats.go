@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// NATSSink - publishes messages to a NATS compatible server under their topic as subject. It speaks the plain
+// text protocol itself and waits for the PONG after every message, so a message counts as published only once the
+// server has read it. TLS is not supported
+type NATSSink struct {
+	URL     string
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSSink - returns a sink for a nats://[user:password@]host[:port] url, the connection is opened on the
+// first publish and again after every error
+func NewNATSSink(url string, timeout time.Duration) *NATSSink {
+	return &NATSSink{URL: url, Timeout: timeout}
+}
+
+// Name - offset key of the nats sink
+func (n *NATSSink) Name() string {
+	return SinkNATS
+}
+
+// Publish - sends the message as json and waits for the server to confirm it
+func (n *NATSSink) Publish(ctx context.Context, message models.OutboxMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		if err = n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err = n.publish(ctx, message.Topic, body); err != nil {
+		n.close()
+		return err
+	}
+
+	return nil
+}
+
+// Close - closes the connection
+func (n *NATSSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.close()
+}
+
+func (n *NATSSink) close() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	n.reader = nil
+
+	return err
+}
+
+func (n *NATSSink) connect(ctx context.Context) error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := net.Dialer{Timeout: n.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+	n.setDeadline(ctx)
+
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		n.close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		n.close()
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		n.close()
+		return err
+	}
+	if info.TLSRequired {
+		n.close()
+		return errors.New("server requires tls")
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "rates-outbox", "lang": "go"}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		options["pass"], _ = u.User.Password()
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		n.close()
+		return err
+	}
+	// the PING makes the server answer -ERR to a rejected CONNECT before anything is published
+	if _, err = fmt.Fprintf(n.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		n.close()
+		return err
+	}
+	if err = n.waitForPong(); err != nil {
+		n.close()
+		return err
+	}
+
+	return nil
+}
+
+func (n *NATSSink) publish(ctx context.Context, subject string, body []byte) error {
+	n.setDeadline(ctx)
+
+	if _, err := fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(body), body); err != nil {
+		return err
+	}
+
+	return n.waitForPong()
+}
+
+// waitForPong - reads until the PONG, answering the server's own PINGs on the way
+func (n *NATSSink) waitForPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// setDeadline - the earlier of the context deadline and the timeout
+func (n *NATSSink) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(n.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = n.conn.SetDeadline(deadline)
+}
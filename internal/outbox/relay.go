@@ -0,0 +1,256 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// Sink - somewhere outbox messages are published to. Publish returns only once the message is accepted, an error
+// makes the relay try the same message again later
+type Sink interface {
+	// Name - key of the sink's offset in the store, it must not change between restarts
+	Name() string
+	Publish(ctx context.Context, message models.OutboxMessage) error
+}
+
+// Config - how the relay polls and retries
+type Config struct {
+	// PollInterval - how often new messages are looked for when no events come in
+	PollInterval time.Duration
+	// InitialBackoff - wait after the first failed publish, doubled after each one
+	InitialBackoff time.Duration
+	// MaxBackoff - upper bound of the wait between retries
+	MaxBackoff time.Duration
+	// Lease - how long a process keeps a sink to itself without renewing the claim, a single publish has to
+	// take less than half of it
+	Lease time.Duration
+}
+
+// DefaultConfig - used when the OUTBOX_* env vars are not set
+var DefaultConfig = Config{
+	PollInterval:   5 * time.Second,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Lease:          30 * time.Second,
+}
+
+// BatchSize - messages read from the store at once
+const BatchSize = 500
+
+// ReleaseTimeout - how long deleting the offsets of the sinks that end with the process may take on shutdown
+const ReleaseTimeout = 5 * time.Second
+
+// Relay - publishes the outbox to its sinks. Every sink has its own offset and goroutine, messages go out in id
+// order and a failed one is retried before anything after it, so a slow or broken sink holds back only itself and
+// every topic keeps its order. A message may be published twice when a process stops between publishing it and
+// storing the offset
+type Relay struct {
+	Store  database.OutboxStore
+	Events *events.Broker
+	Sinks  []Sink
+	Config Config
+	// Owner - identifies this process in the sink claims
+	Owner string
+
+	wakes []chan struct{}
+}
+
+// NewRelay - returns a relay over store, broker wakes it up on new rate events and may be nil
+func NewRelay(store database.OutboxStore, broker *events.Broker, config Config, sinks ...Sink) *Relay {
+	wakes := make([]chan struct{}, len(sinks))
+	for i := range wakes {
+		wakes[i] = make(chan struct{}, 1)
+	}
+
+	return &Relay{
+		Store:  store,
+		Events: broker,
+		Sinks:  sinks,
+		Config: config,
+		Owner:  newOwner(),
+		wakes:  wakes,
+	}
+}
+
+// Run - publishes to every sink until ctx is done, then drops the offset of the bus, no process publishes to it
+// again
+func (r *Relay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, sink := range r.Sinks {
+		wg.Add(1)
+		go func(sink Sink, wake chan struct{}) {
+			defer wg.Done()
+			r.runSink(ctx, sink, wake)
+		}(sink, r.wakes[i])
+	}
+
+	sub := r.subscribe()
+	for sub != nil {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+			sub = nil
+		case _, ok := <-sub.Events():
+			// events are only a wake up call, the messages are read from the store
+			if !ok {
+				sub = r.subscribe()
+			}
+			r.Notify()
+		}
+	}
+
+	wg.Wait()
+	r.release()
+}
+
+// release - deletes the offsets of the sinks that end with this process
+func (r *Relay) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), ReleaseTimeout)
+	defer cancel()
+
+	for _, sink := range r.Sinks {
+		if _, ok := sink.(*Bus); !ok {
+			continue
+		}
+		if err := r.Store.DeleteOutboxSink(ctx, sink.Name(), r.Owner); err != nil {
+			log.Printf("could not delete the outbox offset of %s: %s", sink.Name(), err)
+		}
+	}
+}
+
+// Notify - tells the relay there may be new messages, safe to call on a nil relay
+func (r *Relay) Notify() {
+	if r == nil {
+		return
+	}
+
+	for _, wake := range r.wakes {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *Relay) subscribe() *events.Subscription {
+	if r.Events == nil {
+		return nil
+	}
+
+	return r.Events.Subscribe(nil)
+}
+
+// runSink - publishes to sink, after a failure it waits with backoff instead of being woken up
+func (r *Relay) runSink(ctx context.Context, sink Sink, wake chan struct{}) {
+	failures := 0
+	for {
+		wait := r.Config.PollInterval
+		if err := r.publish(ctx, sink); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			wait = Backoff(r.Config, failures)
+			log.Printf("could not publish outbox to %s, retrying in %s: %s", sink.Name(), wait, err)
+		} else {
+			failures = 0
+		}
+
+		var woken <-chan struct{}
+		if failures == 0 {
+			woken = wake
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-woken:
+			timer.Stop()
+		}
+	}
+}
+
+// publish - sends the messages after the sink's offset. The claim is renewed before every batch and, since a
+// batch of slow publishes can outlast the lease, whenever half of the lease has passed
+func (r *Relay) publish(ctx context.Context, sink Sink) error {
+	for {
+		offset, ok, err := r.Store.ClaimOutboxSink(ctx, sink.Name(), r.Owner, r.Config.Lease)
+		if err != nil || !ok {
+			// another process publishes to the sink
+			return err
+		}
+		claimed := time.Now()
+		messages, err := r.Store.OutboxSince(ctx, offset, BatchSize)
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		published := offset
+		for _, message := range messages {
+			if time.Since(claimed) >= r.Config.Lease/2 {
+				if ok, err := r.saveOffset(ctx, sink, offset, published); err != nil || !ok {
+					return err
+				}
+				offset = published
+				if _, ok, err := r.Store.ClaimOutboxSink(ctx, sink.Name(), r.Owner, r.Config.Lease); err != nil || !ok {
+					return err
+				}
+				claimed = time.Now()
+			}
+			if err = sink.Publish(ctx, message); err != nil {
+				err = fmt.Errorf("message %d: %w", message.ID, err)
+				break
+			}
+			published = message.ID
+		}
+		if ok, err := r.saveOffset(ctx, sink, offset, published); err != nil || !ok {
+			return err
+		}
+		if err != nil || len(messages) < BatchSize {
+			return err
+		}
+	}
+}
+
+// saveOffset - stores published as the offset of sink when it moved past offset, false when the claim was lost
+func (r *Relay) saveOffset(ctx context.Context, sink Sink, offset int64, published int64) (bool, error) {
+	if published <= offset {
+		return true, nil
+	}
+
+	return r.Store.SetOutboxOffset(ctx, sink.Name(), r.Owner, published)
+}
+
+// Backoff - wait before the next try after the given number of failed ones
+func Backoff(config Config, failures int) time.Duration {
+	backoff := config.InitialBackoff
+	for i := 1; i < failures && backoff < config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.MaxBackoff {
+		backoff = config.MaxBackoff
+	}
+
+	return backoff
+}
+
+// newOwner - the host name and a random suffix, unique per process
+func newOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return host + "-" + hex.EncodeToString(b)
+}
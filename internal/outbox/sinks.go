@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/webhooks"
+)
+
+// Names of the sinks OUTBOX_SINKS can list
+const (
+	SinkBus     = "bus"
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkNATS    = "nats"
+)
+
+// Handler - receives the messages of a bus subscription, an error fails the publish so the message comes again
+type Handler func(ctx context.Context, message models.OutboxMessage) error
+
+// Bus - in-process sink, hands messages to the handlers subscribed to their topic. Its handlers live in this
+// process only, so every process publishes to its own bus with its own offset, which the relay deletes when it stops
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[int]busHandler
+	nextID   int
+	name     string
+}
+
+type busHandler struct {
+	topic string
+	fn    Handler
+}
+
+// NewBus - returns a bus without subscribers, it starts at the newest message like any sink claimed the first time
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[int]busHandler), name: SinkBus + ":" + newOwner()}
+}
+
+// Name - offset key of the bus, bus: and an id unique to the process
+func (b *Bus) Name() string {
+	return b.name
+}
+
+// Subscribe - calls fn with every message of topic, an empty topic means all of them. The returned func
+// unsubscribes
+func (b *Bus) Subscribe(topic string, fn Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.handlers[id] = busHandler{topic: topic, fn: fn}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish - calls the handlers of the message's topic one after the other, the first error stops it
+func (b *Bus) Publish(ctx context.Context, message models.OutboxMessage) error {
+	b.mu.RLock()
+	var handlers []Handler
+	for _, handler := range b.handlers {
+		if handler.topic == "" || handler.topic == message.Topic {
+			handlers = append(handlers, handler.fn)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		if err := fn(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WebhookSink - posts messages as json to a url, signed like webhook deliveries with the message id in
+// X-Rates-Delivery so receivers can drop duplicates
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhookSink - returns a webhook sink whose requests give up after timeout
+func NewWebhookSink(url string, secret string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{URL: url, Secret: secret, Client: &http.Client{Timeout: timeout}}
+}
+
+// Name - offset key of the webhook sink
+func (w *WebhookSink) Name() string {
+	return SinkWebhook
+}
+
+// Publish - posts the message, anything but a 2xx answer is an error
+func (w *WebhookSink) Publish(ctx context.Context, message models.OutboxMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhooks.HeaderEvent, message.Type)
+	req.Header.Set(webhooks.HeaderDelivery, strconv.FormatInt(message.ID, 10))
+	req.Header.Set(webhooks.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(w.Secret, timestamp, body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// FileSink - appends messages as json lines to a file, each one is synced to disk before the next
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Name - offset key of the file sink
+func (f *FileSink) Name() string {
+	return SinkFile
+}
+
+// Publish - appends the message to the file
+func (f *FileSink) Publish(ctx context.Context, message models.OutboxMessage) error {
+	line, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+)
+
+// Names of the providers PROVIDER can pick
+const (
+	ProviderHTTP = "http"
+	ProviderStub = "stub"
+)
+
+// RateProvider - an upstream source of rates
+type RateProvider interface {
+	// Name - used in logs and as the source of the rates
+	Name() string
+	// FetchRates - rates of the currencies against base on date. Providers without rates on a day, like weekends,
+	// may answer with an earlier day, the date of every rate says which one it is
+	FetchRates(ctx context.Context, base string, currencies []string, date time.Time) ([]models.CurrencyRate, error)
+}
+
+// HTTPProvider - fetches rates from an api answering GET {url}/{date}?base=USD&symbols=CHF,JPY with
+//
+//	{"base": "USD", "date": "2024-01-05", "rates": {"CHF": 0.8512, "JPY": 144.62}}
+//
+// like exchangerate.host, frankfurter and fixer compatible services do
+type HTTPProvider struct {
+	Client *resty.Client
+}
+
+// NewHTTPProvider - returns a provider for the api at baseURL, apiKey is sent as a bearer token when set
+func NewHTTPProvider(baseURL string, apiKey string, timeout time.Duration) *HTTPProvider {
+	client := resty.New().
+		SetBaseURL(strings.TrimSuffix(baseURL, "/")).
+		SetTimeout(timeout).
+		SetHeader("Accept", "application/json")
+	if apiKey != "" {
+		client.SetAuthToken(apiKey)
+	}
+
+	return &HTTPProvider{Client: client}
+}
+
+// Name - the host of the api, also the source its rates are recorded under
+func (p *HTTPProvider) Name() string {
+	if u, err := url.Parse(p.Client.BaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return p.Client.BaseURL
+}
+
+// httpRates - answer of the api, numbers are read as decimals so no precision is lost
+type httpRates struct {
+	Base  string                     `json:"base"`
+	Date  string                     `json:"date"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+// FetchRates - one request for all currencies
+func (p *HTTPProvider) FetchRates(ctx context.Context, base string, currencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	var body httpRates
+	resp, err := p.Client.R().
+		SetContext(ctx).
+		SetPathParam("date", date.Format("2006-01-02")).
+		SetQueryParam("base", base).
+		SetQueryParam("symbols", strings.ToTitle(strings.Join(currencies, ","))).
+		SetResult(&body).
+		Get("/{date}")
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("%s answered %s", p.Name(), resp.Status())
+	}
+	if !strings.EqualFold(body.Base, base) {
+		return nil, fmt.Errorf("%s answered with base %q instead of %s", p.Name(), body.Base, base)
+	}
+	on, err := time.Parse("2006-01-02", body.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%s answered with date %q", p.Name(), body.Date)
+	}
+
+	rates := make([]models.CurrencyRate, 0, len(body.Rates))
+	for _, currency := range currencies {
+		if rate, ok := body.Rates[strings.ToTitle(currency)]; ok {
+			rates = append(rates, models.CurrencyRate{
+				BaseCurrency:  base,
+				QuoteCurrency: strings.ToTitle(currency),
+				Rate:          rate,
+				Date:          on,
+			})
+		}
+	}
+
+	return rates, nil
+}
+
+// Stub - local provider with fixed rates, for development and tests without an upstream api
+type Stub struct {
+	Rates map[string]decimal.Decimal
+}
+
+// NewStub - returns a stub answering with rates for every date
+func NewStub(rates map[string]decimal.Decimal) *Stub {
+	return &Stub{Rates: rates}
+}
+
+// ParseStubRates - reads rates like CHF:0.91,JPY:110.2
+func ParseStubRates(value string) (map[string]decimal.Decimal, error) {
+	rates := make(map[string]decimal.Decimal)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		currency, rate, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not CURRENCY:RATE", pair)
+		}
+		d, err := decimal.NewFromString(strings.TrimSpace(rate))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		rates[strings.ToTitle(strings.TrimSpace(currency))] = d
+	}
+
+	return rates, nil
+}
+
+// Name - stub
+func (s *Stub) Name() string {
+	return ProviderStub
+}
+
+// FetchRates - the fixed rates of the currencies it knows, dated date
+func (s *Stub) FetchRates(ctx context.Context, base string, currencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	var rates []models.CurrencyRate
+	for _, currency := range currencies {
+		if rate, ok := s.Rates[strings.ToTitle(currency)]; ok {
+			rates = append(rates, models.CurrencyRate{
+				BaseCurrency:  base,
+				QuoteCurrency: strings.ToTitle(currency),
+				Rate:          rate,
+				Date:          date,
+			})
+		}
+	}
+
+	return rates, nil
+}
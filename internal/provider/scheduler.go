@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+	"github.com/Shambou/golang-challenge/internal/validator"
+)
+
+// Config - what the scheduler fetches and when
+type Config struct {
+	// Currencies - quote currencies fetched every day, none means the ones the store already has
+	Currencies []string
+	// At - time of day, in UTC, of the daily fetch
+	At time.Duration
+	// RetryInterval - wait before trying a failed fetch again, or checking whether the process fetching the day
+	// finished it
+	RetryInterval time.Duration
+	// Lease - how long a process keeps the fetch of a day to itself, another one takes over when it runs out
+	Lease time.Duration
+}
+
+// DefaultConfig - used when the PROVIDER_* env vars are not set, the ECB publishes around 16:00 CET
+var DefaultConfig = Config{
+	At:            16*time.Hour + 30*time.Minute,
+	RetryInterval: 15 * time.Minute,
+	Lease:         5 * time.Minute,
+}
+
+// Result - outcome of one fetch
+type Result struct {
+	Stored int `json:"stored"`
+	// Existing - rates the store already had, they are left as they are
+	Existing int `json:"existing"`
+	// Invalid - rates rejected by the validator or for currencies that weren't asked for
+	Invalid int `json:"invalid"`
+	// Rejected - rates not published because the sources disagree too much
+	Rejected int `json:"rejected"`
+}
+
+// Scheduler - fetches the configured currencies from a provider once a day and stores them
+type Scheduler struct {
+	Provider RateProvider
+	DB       database.DatabaseRepo
+	// Reconciler - when set rates are submitted as the provider's values instead of being stored directly
+	Reconciler *reconcile.Reconciler
+	// Runs - when set only the process that claims the fetch of a day runs it
+	Runs database.ProviderRunStore
+	// Owner - identifies this process in the claims of Runs
+	Owner  string
+	Config Config
+	// Now - current time, replaced in tests
+	Now func() time.Time
+}
+
+// NewScheduler - returns a scheduler storing the rates of provider in db
+func NewScheduler(provider RateProvider, db database.DatabaseRepo, config Config) *Scheduler {
+	return &Scheduler{
+		Provider: provider,
+		DB:       db,
+		Config:   config,
+		Owner:    newOwner(),
+		Now:      time.Now,
+	}
+}
+
+// Run - fetches today's rates right away, then every day at Config.At until ctx is done. A failed fetch is tried
+// again after Config.RetryInterval. With Runs set a day another process claimed is checked again after
+// Config.RetryInterval, in case that process fails
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		wait := s.Next(s.Now()).Sub(s.Now())
+		if err := s.run(ctx, s.Now()); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("could not fetch rates from %s, retrying in %s: %s", s.Provider.Name(), s.Config.RetryInterval, err)
+			wait = s.Config.RetryInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// errClaimed - the fetch of the day is held by another process
+var errClaimed = errors.New("another process is fetching them")
+
+// run - fetches the rates on date unless another process claimed or finished them
+func (s *Scheduler) run(ctx context.Context, date time.Time) error {
+	if s.Runs == nil {
+		_, err := s.Fetch(ctx, date)
+		return err
+	}
+
+	ok, done, err := s.Runs.ClaimProviderRun(ctx, s.Provider.Name(), date, s.Owner, s.Config.Lease)
+	switch {
+	case err != nil:
+		return err
+	case done:
+		return nil
+	case !ok:
+		return errClaimed
+	}
+
+	if _, err = s.Fetch(ctx, date); err != nil {
+		return err
+	}
+
+	return s.Runs.FinishProviderRun(ctx, s.Provider.Name(), date, s.Owner)
+}
+
+// Next - the first daily fetch after now
+func (s *Scheduler) Next(now time.Time) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(s.Config.At)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+// Fetch - gets the rates on date from the provider, validates them like POSTed ones and stores the new ones, or
+// reconciles them with the other sources when there is a reconciler
+func (s *Scheduler) Fetch(ctx context.Context, date time.Time) (Result, error) {
+	var result Result
+	currencies := s.Config.Currencies
+	if len(currencies) == 0 {
+		var err error
+		if currencies, err = database.Currencies(ctx, s.DB); err != nil || len(currencies) == 0 {
+			return result, err
+		}
+	}
+
+	rates, err := s.Provider.FetchRates(ctx, database.BaseCurrency, currencies, date)
+	if err != nil {
+		return result, err
+	}
+
+	wanted := make(map[string]bool, len(currencies))
+	for _, currency := range currencies {
+		wanted[strings.ToTitle(currency)] = true
+	}
+
+	var valid []models.CurrencyRate
+	for _, rate := range rates {
+		rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+		err := validator.StoreRate(rate.QuoteCurrency, rate.Date.Format("2006-01-02"), rate.Rate.String(), database.BaseCurrency).Err()
+		if !wanted[rate.QuoteCurrency] || !strings.EqualFold(rate.BaseCurrency, database.BaseCurrency) {
+			err = fmt.Errorf("%s%s wasn't asked for", rate.QuoteCurrency, rate.BaseCurrency)
+		}
+		if err != nil {
+			result.Invalid++
+			log.Printf("skipping %s rate from %s: %s", rate.QuoteCurrency, s.Provider.Name(), err)
+			continue
+		}
+		valid = append(valid, models.CurrencyRate{BaseCurrency: database.BaseCurrency, QuoteCurrency: rate.QuoteCurrency, Rate: rate.Rate, Date: rate.Date})
+	}
+
+	if err = s.store(ctx, valid, &result); err != nil {
+		return result, err
+	}
+	log.Printf("fetched rates from %s: %d stored, %d existing, %d invalid, %d rejected", s.Provider.Name(), result.Stored, result.Existing, result.Invalid, result.Rejected)
+
+	return result, nil
+}
+
+// store - submits the rates to the reconciler, or stores the new ones without one
+func (s *Scheduler) store(ctx context.Context, rates []models.CurrencyRate, result *Result) error {
+	if s.Reconciler != nil {
+		submitted, err := s.Reconciler.Submit(ctx, s.Provider.Name(), rates)
+		result.Stored += submitted.Published
+		result.Existing += submitted.Unchanged
+		result.Rejected += submitted.Rejected
+
+		return err
+	}
+
+	for _, rate := range rates {
+		stored := rate
+		err := s.DB.CreateRate(ctx, &stored)
+		switch {
+		case errors.Is(err, database.ErrRateExists):
+			result.Existing++
+		case err != nil:
+			return fmt.Errorf("could not store %s rate: %w", rate.QuoteCurrency, err)
+		default:
+			result.Stored++
+		}
+	}
+
+	return nil
+}
+
+// newOwner - the host name and a random suffix, unique per process
+func newOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return host + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,124 @@
+package reconcile
+
+import (
+	"sort"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// Policies that turn the values of several sources into the published rate
+const (
+	// PolicyPriority - the value of the first source in Config.Priority, sources that aren't listed come after
+	// in alphabetical order
+	PolicyPriority = "priority"
+	// PolicyMedian - the median of all values
+	PolicyMedian = "median"
+	// PolicyReject - the median, but nothing is published while the spread exceeds the tolerance
+	PolicyReject = "reject"
+)
+
+// SourceMedian - the source of a published rate that is the median of several sources
+const SourceMedian = "median"
+
+// RateScale - decimals of a published rate, the rate column keeps 6 and a median of two values can have more
+const RateScale = 6
+
+// Config - how rates are reconciled
+type Config struct {
+	Policy string
+	// Priority - sources in order of trust for PolicyPriority
+	Priority []string
+	// Tolerance - relative spread between the lowest and highest value sources may have without disagreeing,
+	// 0.01 is 1%
+	Tolerance decimal.Decimal
+}
+
+// DefaultConfig - used when the RECONCILE_* env vars are not set, rates entered through the api win
+var DefaultConfig = Config{
+	Policy:    PolicyPriority,
+	Priority:  []string{models.SourceAPI},
+	Tolerance: decimal.RequireFromString("0.01"),
+}
+
+// Decision - the outcome of reconciling the values of one currency on one date
+type Decision struct {
+	// Rate - the rate to publish rounded to RateScale, zero when Rejected
+	Rate decimal.Decimal
+	// Source - where Rate comes from, a source name or SourceMedian
+	Source string
+	// Spread - (highest - lowest) / lowest of the values
+	Spread decimal.Decimal
+	// Disagree - the spread exceeds the tolerance
+	Disagree bool
+	// Rejected - nothing should be published
+	Rejected bool
+}
+
+// Resolve - applies the policy to the values of one currency on one date, values must not be empty
+func Resolve(config Config, values []models.SourceRate) Decision {
+	rates := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		rates[i] = value.Rate
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].LessThan(rates[j])
+	})
+
+	decision := Decision{}
+	if low := rates[0]; low.IsPositive() {
+		decision.Spread = rates[len(rates)-1].Sub(low).DivRound(low, 8)
+	}
+	decision.Disagree = decision.Spread.GreaterThan(config.Tolerance)
+
+	switch config.Policy {
+	case PolicyMedian, PolicyReject:
+		if config.Policy == PolicyReject && decision.Disagree {
+			decision.Rejected = true
+			return decision
+		}
+		decision.Rate, decision.Source = median(rates), SourceMedian
+		if len(values) == 1 {
+			decision.Source = values[0].Source
+		}
+	default:
+		preferred := preferred(config.Priority, values)
+		decision.Rate, decision.Source = preferred.Rate, preferred.Source
+	}
+	// rounded like the stored rate, so comparing with what is published doesn't see a change that isn't there
+	decision.Rate = decision.Rate.Round(RateScale)
+
+	return decision
+}
+
+// median - middle of sorted rates, the mean of the two middle ones for an even count
+func median(rates []decimal.Decimal) decimal.Decimal {
+	middle := len(rates) / 2
+	if len(rates)%2 == 1 {
+		return rates[middle]
+	}
+
+	return rates[middle-1].Add(rates[middle]).Div(decimal.NewFromInt(2))
+}
+
+// preferred - the value of the highest priority source
+func preferred(priority []string, values []models.SourceRate) models.SourceRate {
+	rank := make(map[string]int, len(priority))
+	for i, source := range priority {
+		rank[source] = i
+	}
+
+	best := values[0]
+	for _, value := range values[1:] {
+		bestRank, bestListed := rank[best.Source]
+		valueRank, valueListed := rank[value.Source]
+		switch {
+		case valueListed && (!bestListed || valueRank < bestRank):
+			best = value
+		case !valueListed && !bestListed && value.Source < best.Source:
+			best = value
+		}
+	}
+
+	return best
+}
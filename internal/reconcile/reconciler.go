@@ -0,0 +1,217 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// ErrRejected - returned when a submitted rate isn't published because the values of its sources disagree
+var ErrRejected = errors.New("the sources of the rate disagree, it wasn't published")
+
+// Result - outcome of a submit
+type Result struct {
+	// Published - rates created or changed
+	Published int `json:"published"`
+	// Unchanged - rates that already had the reconciled value
+	Unchanged int `json:"unchanged"`
+	// Rejected - rates left as they were because their sources disagree, only with PolicyReject
+	Rejected int `json:"rejected"`
+}
+
+// Disagreement - a currency and date whose sources disagree, or whose published rate isn't the one the policy
+// gives
+type Disagreement struct {
+	QuoteCurrency string
+	Date          time.Time
+	// Published - the rate in currency_rates, nil when there is none
+	Published *decimal.Decimal
+	Decision  Decision
+	Values    []models.SourceRate
+}
+
+// Reconciler - keeps the value of every source and publishes the rate the policy picks from them
+type Reconciler struct {
+	Sources database.SourceStore
+	// DB - where rates are published, the cache when there is one so it drops what changes
+	DB     database.DatabaseRepo
+	Config Config
+
+	// mu - submits of this process see each other's values
+	mu sync.Mutex
+}
+
+// NewReconciler - returns a reconciler keeping values in sources and publishing to db
+func NewReconciler(sources database.SourceStore, db database.DatabaseRepo, config Config) *Reconciler {
+	return &Reconciler{Sources: sources, DB: db, Config: config}
+}
+
+// Submit - stores the values of a source and publishes the reconciled rate of every currency and date they are for
+func (r *Reconciler) Submit(ctx context.Context, source string, rates []models.CurrencyRate) (Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result Result
+	if err := r.Sources.SaveSourceRates(ctx, sourceRates(source, rates)); err != nil {
+		return result, err
+	}
+
+	for _, rate := range rates {
+		values, err := r.Sources.SourceRates(ctx, []string{rate.QuoteCurrency}, rate.Date, rate.Date)
+		if err != nil {
+			return result, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		decision := Resolve(r.Config, values)
+		if decision.Rejected {
+			result.Rejected++
+			continue
+		}
+		changed, err := r.publish(ctx, strings.ToTitle(rate.QuoteCurrency), rate.Date, decision.Rate)
+		if err != nil {
+			return result, err
+		}
+		if changed {
+			result.Published++
+		} else {
+			result.Unchanged++
+		}
+	}
+
+	return result, nil
+}
+
+// SubmitRate - submits one rate as the value of source and returns the rate published for its currency and date,
+// ErrRejected when the sources disagree and the published rate was left alone
+func (r *Reconciler) SubmitRate(ctx context.Context, source string, rate models.CurrencyRate) (models.CurrencyRate, error) {
+	rate.QuoteCurrency = strings.ToTitle(rate.QuoteCurrency)
+	result, err := r.Submit(ctx, source, []models.CurrencyRate{rate})
+	if err != nil {
+		return rate, err
+	}
+	if result.Rejected > 0 {
+		return rate, ErrRejected
+	}
+
+	published, err := r.DB.GetRatesInRange(ctx, rate.QuoteCurrency, rate.Date, rate.Date)
+	if err != nil {
+		return rate, err
+	}
+	if len(published) == 0 {
+		return rate, database.ErrRateNotFound
+	}
+
+	return published[0], nil
+}
+
+// publish - creates the rate or updates it when it differs, changed is false when it already had the value
+func (r *Reconciler) publish(ctx context.Context, quoteCurrency string, date time.Time, value decimal.Decimal) (bool, error) {
+	rate := models.CurrencyRate{QuoteCurrency: quoteCurrency, Date: date, Rate: value}
+	err := r.DB.CreateRate(ctx, &rate)
+	if !errors.Is(err, database.ErrRateExists) {
+		return err == nil, err
+	}
+
+	published, err := r.DB.GetRatesInRange(ctx, quoteCurrency, date, date)
+	if err != nil {
+		return false, err
+	}
+	if len(published) > 0 && published[0].Rate.Equal(value) {
+		return false, nil
+	}
+	rate = models.CurrencyRate{QuoteCurrency: quoteCurrency, Date: date, Rate: value}
+
+	return true, database.UpdateRate(ctx, r.DB, &rate)
+}
+
+// Report - the currencies and dates between two dates whose sources disagree or whose published rate isn't the one
+// the policy gives, no quote currencies means all of them
+func (r *Reconciler) Report(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time) ([]Disagreement, error) {
+	values, err := r.Sources.SourceRates(ctx, quoteCurrencies, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var disagreements []Disagreement
+	var published map[string]decimal.Decimal
+	publishedCurrency := ""
+	for start := 0; start < len(values); {
+		end := start + 1
+		for end < len(values) && values[end].QuoteCurrency == values[start].QuoteCurrency && values[end].Date.Equal(values[start].Date) {
+			end++
+		}
+		group := values[start:end]
+		start = end
+
+		currency := group[0].QuoteCurrency
+		if currency != publishedCurrency {
+			if published, err = r.published(ctx, currency, fromDate, toDate); err != nil {
+				return nil, err
+			}
+			publishedCurrency = currency
+		}
+
+		disagreement := Disagreement{
+			QuoteCurrency: currency,
+			Date:          group[0].Date,
+			Decision:      Resolve(r.Config, group),
+			Values:        group,
+		}
+		if rate, ok := published[group[0].Date.Format("2006-01-02")]; ok {
+			disagreement.Published = &rate
+		}
+		if disagreement.Decision.Disagree || !disagreement.matches() {
+			disagreements = append(disagreements, disagreement)
+		}
+	}
+
+	return disagreements, nil
+}
+
+// published - published rates of the currency by date
+func (r *Reconciler) published(ctx context.Context, quoteCurrency string, fromDate time.Time, toDate time.Time) (map[string]decimal.Decimal, error) {
+	rates, err := r.DB.GetRatesInRange(ctx, quoteCurrency, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	published := make(map[string]decimal.Decimal, len(rates))
+	for _, rate := range rates {
+		published[rate.Date.Format("2006-01-02")] = rate.Rate
+	}
+
+	return published, nil
+}
+
+// matches - the published rate is the one the policy gives, rejected rates match whatever is published
+func (d Disagreement) matches() bool {
+	if d.Decision.Rejected {
+		return true
+	}
+
+	return d.Published != nil && d.Published.Equal(d.Decision.Rate)
+}
+
+func sourceRates(source string, rates []models.CurrencyRate) []models.SourceRate {
+	values := make([]models.SourceRate, len(rates))
+	for i, rate := range rates {
+		values[i] = models.SourceRate{
+			Source:        source,
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: strings.ToTitle(rate.QuoteCurrency),
+			Date:          rate.Date,
+			Rate:          rate.Rate,
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,81 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Tabular - values that can be written as csv
+type Tabular interface {
+	Table() (header []string, rows [][]string)
+}
+
+// JSON - application/json
+type JSON struct{}
+
+func (JSON) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (JSON) Render(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XML - application/xml, values need xml tags or they are written with their go field names
+type XML struct{}
+
+func (XML) ContentType() string {
+	return "application/xml; charset=UTF-8"
+}
+
+func (XML) Render(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// CSV - text/csv, only Tabular values can be rendered
+type CSV struct{}
+
+func (CSV) ContentType() string {
+	return "text/csv; charset=UTF-8"
+}
+
+func (CSV) Render(w io.Writer, v interface{}) error {
+	table, ok := v.(Tabular)
+	if !ok {
+		return fmt.Errorf("%T can't be rendered as csv", v)
+	}
+
+	header, rows := table.Table()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+// MsgPack - application/msgpack, fields are named after their json tags
+type MsgPack struct{}
+
+func (MsgPack) ContentType() string {
+	return "application/msgpack"
+}
+
+func (MsgPack) Render(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+
+	return enc.Encode(v)
+}
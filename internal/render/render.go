@@ -0,0 +1,108 @@
+package render
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Renderer - writes a response body in one media type
+type Renderer interface {
+	ContentType() string
+	Render(w io.Writer, v interface{}) error
+}
+
+// ErrNotAcceptable - none of the accepted media types or the format override can be rendered
+var ErrNotAcceptable = errors.New("none of the requested media types can be rendered")
+
+// Formats - renderers by the name used in the format= query parameter
+var Formats = map[string]Renderer{
+	"json":    JSON{},
+	"xml":     XML{},
+	"csv":     CSV{},
+	"msgpack": MsgPack{},
+}
+
+// mediaTypes - renderers by the media types they answer to in an Accept header
+var mediaTypes = map[string]Renderer{
+	"application/json":        JSON{},
+	"application/xml":         XML{},
+	"text/xml":                XML{},
+	"text/csv":                CSV{},
+	"application/msgpack":     MsgPack{},
+	"application/x-msgpack":   MsgPack{},
+	"application/vnd.msgpack": MsgPack{},
+}
+
+// Default - used when the request doesn't ask for anything or accepts anything
+var Default Renderer = JSON{}
+
+// Negotiate - picks a renderer, a format override wins over the Accept header
+func Negotiate(accept string, format string) (Renderer, error) {
+	if format != "" {
+		if renderer, ok := Formats[strings.ToLower(format)]; ok {
+			return renderer, nil
+		}
+		return nil, ErrNotAcceptable
+	}
+	if strings.TrimSpace(accept) == "" {
+		return Default, nil
+	}
+
+	for _, mediaType := range parseAccept(accept) {
+		switch {
+		case mediaType == "*/*" || mediaType == "application/*":
+			return Default, nil
+		case mediaType == "text/*":
+			return CSV{}, nil
+		}
+		if renderer, ok := mediaTypes[mediaType]; ok {
+			return renderer, nil
+		}
+	}
+
+	return nil, ErrNotAcceptable
+}
+
+// parseAccept - media types of an Accept header ordered by their q value, types with q=0 are dropped
+func parseAccept(accept string) []string {
+	type weighted struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []weighted
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{mediaType, q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	mediaTypes := make([]string, len(ranges))
+	for i, r := range ranges {
+		mediaTypes[i] = r.mediaType
+	}
+
+	return mediaTypes
+}
@@ -0,0 +1,73 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+)
+
+// DefaultAge - how long events and outbox messages are kept at least, used when RETENTION_AGE is not set. A sink
+// whose process is down for longer loses its offset and starts after the newest message again
+const DefaultAge = 7 * 24 * time.Hour
+
+// DefaultInterval - how often old rows are deleted, used when RETENTION_INTERVAL is not set
+const DefaultInterval = time.Hour
+
+// Job - deletes the events and outbox messages older than Age that the webhook cursor and every sink are past,
+// both tables grow with every rate change otherwise
+type Job struct {
+	Store    database.Pruner
+	Age      time.Duration
+	Interval time.Duration
+	// Now - the current time, rows are kept for Age up to it
+	Now func() time.Time
+}
+
+// NewJob - returns a job pruning store every interval
+func NewJob(store database.Pruner, age time.Duration, interval time.Duration) *Job {
+	return &Job{
+		Store:    store,
+		Age:      age,
+		Interval: interval,
+		Now:      time.Now,
+	}
+}
+
+// Run - prunes right away and then every Interval until ctx is done, replicas may prune at the same time since
+// deleting a row twice does no harm
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Prune(ctx); err != nil && ctx.Err() == nil {
+			log.Println("could not prune old events: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune - deletes the events and outbox messages older than Age that no reader needs anymore
+func (j *Job) Prune(ctx context.Context) error {
+	before := j.Now().Add(-j.Age)
+	events, err := j.Store.PruneEvents(ctx, before)
+	if err != nil {
+		return err
+	}
+	messages, err := j.Store.PruneOutbox(ctx, before)
+	if err != nil {
+		return err
+	}
+	if events > 0 || messages > 0 {
+		log.Printf("pruned %d events and %d outbox messages from before %s", events, messages, before.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
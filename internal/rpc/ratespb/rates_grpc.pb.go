@@ -0,0 +1,283 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package ratespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RatesClient is the client API for Rates service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RatesClient interface {
+	// GetLatestRate - latest rate stored for a quote currency
+	GetLatestRate(ctx context.Context, in *GetLatestRateRequest, opts ...grpc.CallOption) (*Rate, error)
+	// GetRatesInRange - rates of a quote currency between two dates
+	GetRatesInRange(ctx context.Context, in *GetRatesInRangeRequest, opts ...grpc.CallOption) (*GetRatesInRangeResponse, error)
+	// StreamRatesInRange - same as GetRatesInRange but sends the rates one by one as they are read
+	StreamRatesInRange(ctx context.Context, in *GetRatesInRangeRequest, opts ...grpc.CallOption) (Rates_StreamRatesInRangeClient, error)
+	// GetTimeseries - rates of every quote currency on a date
+	GetTimeseries(ctx context.Context, in *GetTimeseriesRequest, opts ...grpc.CallOption) (*GetTimeseriesResponse, error)
+	// StoreRate - stores a new rate, fails with ALREADY_EXISTS when the currency has a rate on that date
+	StoreRate(ctx context.Context, in *StoreRateRequest, opts ...grpc.CallOption) (*Rate, error)
+}
+
+type ratesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRatesClient(cc grpc.ClientConnInterface) RatesClient {
+	return &ratesClient{cc}
+}
+
+func (c *ratesClient) GetLatestRate(ctx context.Context, in *GetLatestRateRequest, opts ...grpc.CallOption) (*Rate, error) {
+	out := new(Rate)
+	err := c.cc.Invoke(ctx, "/rates.v1.Rates/GetLatestRate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) GetRatesInRange(ctx context.Context, in *GetRatesInRangeRequest, opts ...grpc.CallOption) (*GetRatesInRangeResponse, error) {
+	out := new(GetRatesInRangeResponse)
+	err := c.cc.Invoke(ctx, "/rates.v1.Rates/GetRatesInRange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) StreamRatesInRange(ctx context.Context, in *GetRatesInRangeRequest, opts ...grpc.CallOption) (Rates_StreamRatesInRangeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Rates_ServiceDesc.Streams[0], "/rates.v1.Rates/StreamRatesInRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ratesStreamRatesInRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Rates_StreamRatesInRangeClient interface {
+	Recv() (*Rate, error)
+	grpc.ClientStream
+}
+
+type ratesStreamRatesInRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *ratesStreamRatesInRangeClient) Recv() (*Rate, error) {
+	m := new(Rate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ratesClient) GetTimeseries(ctx context.Context, in *GetTimeseriesRequest, opts ...grpc.CallOption) (*GetTimeseriesResponse, error) {
+	out := new(GetTimeseriesResponse)
+	err := c.cc.Invoke(ctx, "/rates.v1.Rates/GetTimeseries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratesClient) StoreRate(ctx context.Context, in *StoreRateRequest, opts ...grpc.CallOption) (*Rate, error) {
+	out := new(Rate)
+	err := c.cc.Invoke(ctx, "/rates.v1.Rates/StoreRate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RatesServer is the server API for Rates service.
+// All implementations must embed UnimplementedRatesServer
+// for forward compatibility
+type RatesServer interface {
+	// GetLatestRate - latest rate stored for a quote currency
+	GetLatestRate(context.Context, *GetLatestRateRequest) (*Rate, error)
+	// GetRatesInRange - rates of a quote currency between two dates
+	GetRatesInRange(context.Context, *GetRatesInRangeRequest) (*GetRatesInRangeResponse, error)
+	// StreamRatesInRange - same as GetRatesInRange but sends the rates one by one as they are read
+	StreamRatesInRange(*GetRatesInRangeRequest, Rates_StreamRatesInRangeServer) error
+	// GetTimeseries - rates of every quote currency on a date
+	GetTimeseries(context.Context, *GetTimeseriesRequest) (*GetTimeseriesResponse, error)
+	// StoreRate - stores a new rate, fails with ALREADY_EXISTS when the currency has a rate on that date
+	StoreRate(context.Context, *StoreRateRequest) (*Rate, error)
+	mustEmbedUnimplementedRatesServer()
+}
+
+// UnimplementedRatesServer must be embedded to have forward compatible implementations.
+type UnimplementedRatesServer struct {
+}
+
+func (UnimplementedRatesServer) GetLatestRate(context.Context, *GetLatestRateRequest) (*Rate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatestRate not implemented")
+}
+func (UnimplementedRatesServer) GetRatesInRange(context.Context, *GetRatesInRangeRequest) (*GetRatesInRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRatesInRange not implemented")
+}
+func (UnimplementedRatesServer) StreamRatesInRange(*GetRatesInRangeRequest, Rates_StreamRatesInRangeServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamRatesInRange not implemented")
+}
+func (UnimplementedRatesServer) GetTimeseries(context.Context, *GetTimeseriesRequest) (*GetTimeseriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTimeseries not implemented")
+}
+func (UnimplementedRatesServer) StoreRate(context.Context, *StoreRateRequest) (*Rate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StoreRate not implemented")
+}
+func (UnimplementedRatesServer) mustEmbedUnimplementedRatesServer() {}
+
+// UnsafeRatesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RatesServer will
+// result in compilation errors.
+type UnsafeRatesServer interface {
+	mustEmbedUnimplementedRatesServer()
+}
+
+func RegisterRatesServer(s grpc.ServiceRegistrar, srv RatesServer) {
+	s.RegisterService(&Rates_ServiceDesc, srv)
+}
+
+func _Rates_GetLatestRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).GetLatestRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rates.v1.Rates/GetLatestRate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).GetLatestRate(ctx, req.(*GetLatestRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_GetRatesInRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRatesInRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).GetRatesInRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rates.v1.Rates/GetRatesInRange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).GetRatesInRange(ctx, req.(*GetRatesInRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_StreamRatesInRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRatesInRangeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RatesServer).StreamRatesInRange(m, &ratesStreamRatesInRangeServer{stream})
+}
+
+type Rates_StreamRatesInRangeServer interface {
+	Send(*Rate) error
+	grpc.ServerStream
+}
+
+type ratesStreamRatesInRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *ratesStreamRatesInRangeServer) Send(m *Rate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Rates_GetTimeseries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTimeseriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).GetTimeseries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rates.v1.Rates/GetTimeseries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).GetTimeseries(ctx, req.(*GetTimeseriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rates_StoreRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StoreRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatesServer).StoreRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rates.v1.Rates/StoreRate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatesServer).StoreRate(ctx, req.(*StoreRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Rates_ServiceDesc is the grpc.ServiceDesc for Rates service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Rates_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rates.v1.Rates",
+	HandlerType: (*RatesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLatestRate",
+			Handler:    _Rates_GetLatestRate_Handler,
+		},
+		{
+			MethodName: "GetRatesInRange",
+			Handler:    _Rates_GetRatesInRange_Handler,
+		},
+		{
+			MethodName: "GetTimeseries",
+			Handler:    _Rates_GetTimeseries_Handler,
+		},
+		{
+			MethodName: "StoreRate",
+			Handler:    _Rates_StoreRate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRatesInRange",
+			Handler:       _Rates_StreamRatesInRange_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rates.proto",
+}
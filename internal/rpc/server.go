@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+	"github.com/Shambou/golang-challenge/internal/rpc/ratespb"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server - gRPC implementation of the rates service on the same repository as the REST API
+type Server struct {
+	ratespb.UnimplementedRatesServer
+	DB database.DatabaseRepo
+	// Events - told about stored rates so streams see them right away, may be nil
+	Events *events.Broker
+	// Reconciler - when set stored rates are submitted as the value of the api source, like the ones of the REST API
+	Reconciler *reconcile.Reconciler
+}
+
+// NewServer - returns a grpc server with the rates service registered, reconciler may be nil
+func NewServer(db database.DatabaseRepo, broker *events.Broker, reconciler *reconcile.Reconciler, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	ratespb.RegisterRatesServer(s, &Server{DB: db, Events: broker, Reconciler: reconciler})
+
+	return s
+}
+
+// GetLatestRate - gets the latest rate of type for quote_currency
+func (s *Server) GetLatestRate(ctx context.Context, req *ratespb.GetLatestRateRequest) (*ratespb.Rate, error) {
+	if v := validator.LatestRate(req.QuoteCurrency).RateType(req.Type); !v.Valid() {
+		return nil, invalid(v)
+	}
+
+	rateType := models.RateType(req.Type)
+	rate, err := database.GetLastRateOfType(ctx, s.DB, req.QuoteCurrency, rateType)
+	if err != nil {
+		return nil, statusError(err, codes.Internal)
+	}
+
+	return toRate(rate, rateType), nil
+}
+
+// GetRatesInRange - gets the rates between two dates
+func (s *Server) GetRatesInRange(ctx context.Context, req *ratespb.GetRatesInRangeRequest) (*ratespb.GetRatesInRangeResponse, error) {
+	quoteCurrency, fromDate, toDate, rateType, err := rangeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := database.GetRatesInRangeOfType(ctx, s.DB, quoteCurrency, fromDate, toDate, rateType)
+	if err != nil {
+		return nil, statusError(err, codes.Internal)
+	}
+
+	resp := &ratespb.GetRatesInRangeResponse{
+		BaseCurrency:  database.BaseCurrency,
+		QuoteCurrency: quoteCurrency,
+		Rates:         make([]*ratespb.Rate, len(rates)),
+	}
+	for i, rate := range rates {
+		resp.Rates[i] = toRate(rate, rateType)
+	}
+
+	return resp, nil
+}
+
+// StreamRatesInRange - sends the rates between two dates as they are read from the repository
+func (s *Server) StreamRatesInRange(req *ratespb.GetRatesInRangeRequest, stream ratespb.Rates_StreamRatesInRangeServer) error {
+	quoteCurrency, fromDate, toDate, rateType, err := rangeRequest(req)
+	if err != nil {
+		return err
+	}
+
+	err = database.StreamRatesOfType(stream.Context(), s.DB, []string{quoteCurrency}, fromDate, toDate, rateType, func(rate models.CurrencyRate) error {
+		return stream.Send(toRate(rate, rateType))
+	})
+	if err != nil {
+		return statusError(err, codes.Internal)
+	}
+
+	return nil
+}
+
+// GetTimeseries - gets all rates available on date
+func (s *Server) GetTimeseries(ctx context.Context, req *ratespb.GetTimeseriesRequest) (*ratespb.GetTimeseriesResponse, error) {
+	if v := validator.Timeseries(req.Date).RateType(req.Type); !v.Valid() {
+		return nil, invalid(v)
+	}
+	date, _ := time.Parse("2006-01-02", req.Date)
+
+	rateType := models.RateType(req.Type)
+	rates, err := database.GetAllRatesOnDateOfType(ctx, s.DB, date, rateType)
+	if err != nil {
+		return nil, statusError(err, codes.Internal)
+	}
+
+	resp := &ratespb.GetTimeseriesResponse{
+		BaseCurrency: database.BaseCurrency,
+		Date:         req.Date,
+		Rates:        make([]*ratespb.Rate, len(rates)),
+	}
+	for i, rate := range rates {
+		resp.Rates[i] = toRate(rate, rateType)
+	}
+
+	return resp, nil
+}
+
+// StoreRate - stores a new rate, or submits it as the value of the api source when there is a reconciler
+func (s *Server) StoreRate(ctx context.Context, req *ratespb.StoreRateRequest) (*ratespb.Rate, error) {
+	if v := validator.StoreRate(req.QuoteCurrency, req.Date, req.Rate, database.BaseCurrency); !v.Valid() {
+		return nil, invalid(v)
+	}
+	date, _ := time.Parse("2006-01-02", req.Date)
+	value, _ := decimal.NewFromString(req.Rate)
+
+	rate := models.CurrencyRate{
+		QuoteCurrency: strings.ToTitle(req.QuoteCurrency),
+		Date:          date,
+		Rate:          value,
+	}
+	var err error
+	switch {
+	case s.Reconciler == nil:
+		err = s.DB.CreateRate(ctx, &rate)
+	case s.DB.CheckRateQuoteOnDateExists(ctx, rate.QuoteCurrency, rate.Date):
+		err = database.ErrRateExists
+	default:
+		rate, err = s.Reconciler.SubmitRate(ctx, models.SourceAPI, rate)
+	}
+	if err != nil {
+		return nil, statusError(err, codes.Internal)
+	}
+	s.Events.Notify()
+
+	return toRate(rate, models.RateMid), nil
+}
+
+// rangeRequest - validates a range request and parses its dates, the type is mid when it is left out
+func rangeRequest(req *ratespb.GetRatesInRangeRequest) (string, time.Time, time.Time, string, error) {
+	if v := validator.RatesInRange(req.QuoteCurrency, req.From, req.To).RateType(req.Type); !v.Valid() {
+		return "", time.Time{}, time.Time{}, "", invalid(v)
+	}
+	fromDate, _ := time.Parse("2006-01-02", req.From)
+	toDate, _ := time.Parse("2006-01-02", req.To)
+
+	return strings.ToTitle(req.QuoteCurrency), fromDate, toDate, models.RateType(req.Type), nil
+}
+
+// toRate - rates keep their full precision as a decimal string
+func toRate(rate models.CurrencyRate, rateType string) *ratespb.Rate {
+	return &ratespb.Rate{
+		Date:          rate.Date.Format("2006-01-02"),
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate.String(),
+		Type:          rateType,
+	}
+}
+
+// invalid - INVALID_ARGUMENT listing every failed rule
+func invalid(v *validator.Validator) error {
+	return status.Error(codes.InvalidArgument, v.Err().Error())
+}
+
+// statusError - maps repository errors to grpc codes, anything unknown gets code
+func statusError(err error, code codes.Code) error {
+	switch {
+	case errors.Is(err, database.ErrNoRates):
+		code = codes.NotFound
+	case errors.Is(err, database.ErrTimeout):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, database.ErrRateExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, reconcile.ErrRejected):
+		code = codes.FailedPrecondition
+	case errors.Is(err, database.ErrNotSupported):
+		code = codes.Unimplemented
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+
+	return status.Error(code, err.Error())
+}
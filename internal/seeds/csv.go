@@ -0,0 +1,143 @@
+package seeds
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// PairCSV - DATE,CHFUSD files holding one pair, the layout of fxdata
+type PairCSV struct {
+	QuoteCurrency string
+	BaseCurrency  string
+}
+
+// Import - the header is a record without rates, rows with a missing date or rate are skipped
+func (p *PairCSV) Import(r io.Reader, fn func(Record) error) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	for line := 0; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		record := Record{Raw: strings.Join(row, ",")}
+		if line > 0 {
+			rate, ok := parseRate(row, p.BaseCurrency, p.QuoteCurrency)
+			if ok {
+				record.Rates = []models.CurrencyRate{rate}
+			} else {
+				record.Skipped++
+			}
+		}
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// WideCSV - DATE,CHF,JPY,... files with one column per quote currency, columns may also be pairs of the base like CHFUSD
+type WideCSV struct {
+	BaseCurrency string
+}
+
+// Import - the header is a record without rates, empty or invalid cells are skipped
+func (w *WideCSV) Import(r io.Reader, fn func(Record) error) error {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	currencies := make([]string, len(header))
+	bases := make([]string, len(header))
+	for i, column := range header[1:] {
+		column = strings.ToTitle(strings.TrimSpace(column))
+		switch len(column) {
+		case 3:
+			currencies[i+1], bases[i+1] = column, w.BaseCurrency
+		case 6:
+			if column[3:6] != w.BaseCurrency {
+				return fmt.Errorf("column %q: %w", column, ErrForeignBaseCurrency)
+			}
+			currencies[i+1], bases[i+1] = column[0:3], column[3:6]
+		default:
+			return fmt.Errorf("column %q is not a currency", column)
+		}
+	}
+	if err = fn(Record{Raw: strings.Join(header, ",")}); err != nil {
+		return err
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		record := Record{Raw: strings.Join(row, ",")}
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			record.Skipped += len(row) - 1
+		} else {
+			for i := 1; i < len(row); i++ {
+				rate, err := decimal.NewFromString(strings.TrimSpace(row[i]))
+				if err != nil {
+					record.Skipped++
+					continue
+				}
+				record.Rates = append(record.Rates, models.CurrencyRate{
+					BaseCurrency:  bases[i],
+					QuoteCurrency: currencies[i],
+					Rate:          rate,
+					Date:          date,
+				})
+			}
+		}
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRate - parses a date,rate row, false when the date or rate is missing
+func parseRate(row []string, baseCurrency string, quoteCurrency string) (models.CurrencyRate, bool) {
+	var rate models.CurrencyRate
+	rate.BaseCurrency = baseCurrency
+	rate.QuoteCurrency = quoteCurrency
+
+	if len(row) < 2 {
+		return rate, false
+	}
+
+	var err error
+	rate.Date, err = time.Parse("2006-01-02", row[0])
+	if err != nil {
+		return rate, false
+	}
+	rate.Rate, err = decimal.NewFromString(row[1])
+	if err != nil {
+		return rate, false
+	}
+
+	return rate, true
+}
@@ -0,0 +1,155 @@
+package seeds
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// ecbBase - currency the ECB reference rates are quoted against
+const ecbBase = "EUR"
+
+// ECB - the ECB eurofxref xml, daily, 90 day or full history
+//
+//	<Cube time="2024-01-05"><Cube currency="USD" rate="1.0921"/>...</Cube>
+type ECB struct {
+	// BaseCurrency - rates are converted to this base through its EUR rate, days without it are skipped
+	BaseCurrency string
+	// Window - the file is the daily or 90 day feed, which drop their oldest day every day
+	Window bool
+}
+
+// Windowed - the daily and 90 day feeds are loaded whole whenever they change
+func (e *ECB) Windowed() bool {
+	return e.Window
+}
+
+// ecbDay - one <Cube time=".."> element
+type ecbDay struct {
+	date  string
+	rates [][2]string // currency, rate in document order
+}
+
+// Import - every day is a record. The ECB lists the newest day first, days are passed on oldest first
+// so a history file that gains days keeps its already loaded records in front
+func (e *ECB) Import(r io.Reader, fn func(Record) error) error {
+	decoder := xml.NewDecoder(r)
+
+	var days []ecbDay
+	var day *ecbDay
+	level, dayLevel := 0, 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "Cube" {
+				continue
+			}
+			level++
+
+			attrs := make(map[string]string)
+			for _, attr := range t.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			if date, ok := attrs["time"]; ok {
+				days = append(days, ecbDay{date: date})
+				day = &days[len(days)-1]
+				dayLevel = level
+			} else if currency, ok := attrs["currency"]; ok && day != nil {
+				day.rates = append(day.rates, [2]string{strings.ToTitle(currency), attrs["rate"]})
+			}
+		case xml.EndElement:
+			if t.Name.Local != "Cube" {
+				continue
+			}
+			if day != nil && level == dayLevel {
+				day = nil
+			}
+			level--
+		}
+	}
+
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].date < days[j].date
+	})
+
+	for _, day := range days {
+		if err := fn(e.record(day)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record - converts the EUR rates of a day to the base currency
+func (e *ECB) record(day ecbDay) Record {
+	raw := []string{day.date}
+	for _, rate := range day.rates {
+		raw = append(raw, rate[0]+"="+rate[1])
+	}
+	record := Record{Raw: strings.Join(raw, ",")}
+
+	date, err := time.Parse("2006-01-02", day.date)
+	if err != nil {
+		record.Skipped = len(day.rates)
+		return record
+	}
+
+	rates := make(map[string]decimal.Decimal)
+	for _, rate := range day.rates {
+		value, err := decimal.NewFromString(rate[1])
+		if err != nil || !value.IsPositive() {
+			record.Skipped++
+			continue
+		}
+		rates[rate[0]] = value
+	}
+
+	// units of the base currency one euro buys
+	perEuro := decimal.NewFromInt(1)
+	if e.BaseCurrency != ecbBase {
+		var ok bool
+		if perEuro, ok = rates[e.BaseCurrency]; !ok {
+			record.Skipped += len(rates)
+			return record
+		}
+	}
+
+	for _, rate := range day.rates {
+		currency := rate[0]
+		value, ok := rates[currency]
+		if !ok || currency == e.BaseCurrency {
+			continue
+		}
+		record.Rates = append(record.Rates, models.CurrencyRate{
+			BaseCurrency:  e.BaseCurrency,
+			QuoteCurrency: currency,
+			Rate:          value.Div(perEuro).Round(6),
+			Date:          date,
+		})
+	}
+	if e.BaseCurrency != ecbBase {
+		record.Rates = append(record.Rates, models.CurrencyRate{
+			BaseCurrency:  e.BaseCurrency,
+			QuoteCurrency: ecbBase,
+			Rate:          decimal.NewFromInt(1).Div(perEuro).Round(6),
+			Date:          date,
+		})
+	}
+
+	return record
+}
@@ -0,0 +1,143 @@
+package seeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// Supported formats, set in the manifest or picked by file extension
+const (
+	FormatPairCSV = "csv"      // DATE,CHFUSD - one file per pair, pair taken from the file name
+	FormatWideCSV = "wide-csv" // DATE,CHF,JPY,... - one column per currency
+	FormatECB     = "ecb"      // ECB eurofxref xml
+	FormatNDJSON  = "ndjson"   // one json rate per line
+)
+
+// ManifestFile - name of the optional manifest in the seeded directory
+const ManifestFile = "manifest.json"
+
+// extensions - format used for files the manifest doesn't mention
+var extensions = map[string]string{
+	".csv":    FormatPairCSV,
+	".xml":    FormatECB,
+	".ndjson": FormatNDJSON,
+	".jsonl":  FormatNDJSON,
+}
+
+// Record - one unit of a source file, a line or an xml day. Records are what the seeder counts and checksums
+// to know which part of a file was loaded before
+type Record struct {
+	// Raw - canonical text of the record
+	Raw   string
+	Rates []models.CurrencyRate
+	// Skipped - values of the record without a valid date or rate
+	Skipped int
+}
+
+// Importer - reads the records of one source file
+type Importer interface {
+	// Import - calls fn with every record of r in order, stops at the first error
+	Import(r io.Reader, fn func(Record) error) error
+}
+
+// Windowed - importers of files that drop their oldest records as they gain new ones, so the records loaded before
+// are no longer at the start of the file. Such files are loaded whole whenever they change, the days that were
+// loaded before already have their rates and are left as they are
+type Windowed interface {
+	Windowed() bool
+}
+
+// ManifestEntry - format settings of one file, path is relative to the seeded directory
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	// BaseCurrency - currency the rates are quoted against, wide csv columns are quote currencies of it
+	BaseCurrency string `json:"base_currency"`
+}
+
+// Manifest - lists files whose format can't be told from the extension
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+// readManifest - reads the manifest of dir, an empty manifest when there is none
+func readManifest(dir string) (Manifest, error) {
+	var manifest Manifest
+
+	content, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+
+	return manifest, nil
+}
+
+// entry - returns the manifest entry of path, falling back to the extension. ok is false for files that aren't rates
+func (m Manifest) entry(dir string, path string) (ManifestEntry, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, entry := range m.Files {
+		if filepath.ToSlash(filepath.Clean(entry.Path)) == rel {
+			return entry, true
+		}
+	}
+
+	if rel == ManifestFile {
+		return ManifestEntry{}, false
+	}
+	format, ok := extensions[strings.ToLower(filepath.Ext(path))]
+
+	return ManifestEntry{Path: rel, Format: format}, ok
+}
+
+// newImporter - returns the importer for a file, baseCurrency is used when the entry doesn't set one.
+// Every stored rate is quoted against baseCurrency, files with another base are rejected.
+func newImporter(path string, entry ManifestEntry, baseCurrency string) (Importer, error) {
+	if entry.BaseCurrency == "" {
+		entry.BaseCurrency = baseCurrency
+	}
+	base := strings.ToTitle(entry.BaseCurrency)
+	if base != baseCurrency {
+		return nil, fmt.Errorf("%w: %s", ErrForeignBaseCurrency, base)
+	}
+
+	switch entry.Format {
+	case FormatPairCSV:
+		// get quote and base currency from the file name, CHFUSD.csv
+		symbol := filepath.Base(path)
+		if len(symbol) < 6 {
+			return nil, fmt.Errorf("can't read currencies from file name")
+		}
+		if pairBase := strings.ToTitle(symbol[3:6]); pairBase != base {
+			return nil, fmt.Errorf("%w: %s", ErrForeignBaseCurrency, pairBase)
+		}
+		return &PairCSV{QuoteCurrency: strings.ToTitle(symbol[0:3]), BaseCurrency: base}, nil
+	case FormatWideCSV:
+		return &WideCSV{BaseCurrency: base}, nil
+	case FormatECB:
+		// eurofxref-daily.xml and eurofxref-hist-90d.xml, only eurofxref-hist.xml keeps every day
+		name := strings.ToLower(filepath.Base(path))
+		window := strings.Contains(name, "daily") || strings.Contains(name, "90d")
+		return &ECB{BaseCurrency: base, Window: window}, nil
+	case FormatNDJSON:
+		return &NDJSON{BaseCurrency: base}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", entry.Format)
+}
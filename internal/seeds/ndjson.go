@@ -0,0 +1,70 @@
+package seeds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// NDJSON - one rate per line
+//
+//	{"date": "2020-01-02", "quote_currency": "CHF", "rate": "0.9678"}
+type NDJSON struct {
+	// BaseCurrency - used for lines without base_currency, lines with another base are skipped
+	BaseCurrency string
+}
+
+// ndjsonRate - one line of an ndjson file
+type ndjsonRate struct {
+	Date          string          `json:"date"`
+	BaseCurrency  string          `json:"base_currency"`
+	QuoteCurrency string          `json:"quote_currency"`
+	Rate          decimal.Decimal `json:"rate"`
+}
+
+// Import - every non blank line is a record, lines with an invalid date, currency or rate or another base are skipped
+func (n *NDJSON) Import(r io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var value ndjsonRate
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		record := Record{Raw: text}
+		rate := models.CurrencyRate{
+			BaseCurrency:  strings.ToTitle(value.BaseCurrency),
+			QuoteCurrency: strings.ToTitle(value.QuoteCurrency),
+			Rate:          value.Rate,
+		}
+		if rate.BaseCurrency == "" {
+			rate.BaseCurrency = n.BaseCurrency
+		}
+
+		date, err := time.Parse("2006-01-02", value.Date)
+		if err != nil || len(rate.QuoteCurrency) != 3 || rate.BaseCurrency != n.BaseCurrency || !rate.Rate.IsPositive() {
+			record.Skipped++
+		} else {
+			rate.Date = date
+			record.Rates = []models.CurrencyRate{rate}
+		}
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
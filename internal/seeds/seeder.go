@@ -1,114 +1,355 @@
 package seeds
 
 import (
-	"bufio"
 	"context"
-	"encoding/csv"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
 	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
+	"runtime"
+	"sort"
+	"sync"
 
-	database "github.com/Shambou/golang-challenge/internal/database/postgres"
+	"github.com/Shambou/golang-challenge/internal/database"
 	"github.com/Shambou/golang-challenge/internal/models"
-	"github.com/shopspring/decimal"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
 )
 
+// Store - repository the seeder loads rates into and tracks seeded files in
+type Store interface {
+	BulkInsert(rates []models.CurrencyRate) error
+	GetSeedFile(ctx context.Context, path string) (*models.SeedFile, error)
+	SaveSeedFile(ctx context.Context, file *models.SeedFile) error
+}
+
+// Seeding outcomes of a file
+const (
+	FileNew       = "new"
+	FileAppended  = "appended"
+	FileUnchanged = "unchanged"
+	FileConflict  = "conflict"
+	FileFailed    = "failed"
+)
+
+// BatchSize - rates passed to BulkInsert at once, so a long file is never held in memory as a whole
+const BatchSize = 10000
+
+// ErrSeededLinesChanged - a file no longer starts with the lines that were loaded from it
+var ErrSeededLinesChanged = errors.New("lines that were already seeded have changed")
+
+// ErrForeignBaseCurrency - a file quotes its rates against another currency than the seeder's base
+var ErrForeignBaseCurrency = errors.New("rates are not quoted against the base currency")
+
+// FileReport - outcome of seeding one file
+type FileReport struct {
+	Path   string
+	Format string
+	Status string
+	// Rows - rates loaded from the new records per quote currency
+	Rows map[string]int
+	// Skipped - values in the new records without a valid date or rate
+	Skipped int
+	// Err - why the file conflicts or failed
+	Err error
+}
+
+// Summary - outcome of a seeder run
+type Summary struct {
+	Files []FileReport
+	// Rows - rates loaded per quote currency
+	Rows map[string]int
+}
+
+// Failed - returns the reports of files that conflict or failed
+func (s Summary) Failed() []FileReport {
+	var failed []FileReport
+	for _, report := range s.Files {
+		if report.Err != nil {
+			failed = append(failed, report)
+		}
+	}
+
+	return failed
+}
+
 // Seed type
 type Seed struct {
-	DB *database.Database
+	DB Store
+	// Dir - directory walked for rate files
+	Dir string
+	// BaseCurrency - base of formats that don't name it, unless the manifest does
+	BaseCurrency string
+	// Workers - number of files seeded at the same time
+	Workers int
+	// Reconciler - when set the rates of a file are submitted as the values of its import source, so the
+	// policy decides what is published, instead of being inserted where no rate is published yet
+	Reconciler *reconcile.Reconciler
 }
 
-func New(db *database.Database) *Seed {
+func New(db Store) *Seed {
 	s := &Seed{
-		DB: db,
+		DB:           db,
+		Dir:          "fxdata",
+		BaseCurrency: database.BaseCurrency,
+		Workers:      runtime.NumCPU(),
 	}
 
 	return s
 }
 
-func (s *Seed) Execute() {
-	if s.DB.TableSeeded(context.Background()) {
-		log.Println("Table already seeded")
-		return
+// job - a file and the importer reading it
+type job struct {
+	path     string
+	format   string
+	importer Importer
+	err      error
+}
+
+// Execute - seeds every rate file in Dir that is new or has grown since the last run. The format comes from
+// the manifest or the file extension, files are seeded in parallel and a failing file doesn't stop the others
+func (s *Seed) Execute() Summary {
+	var jobs []job
+
+	manifest, err := readManifest(s.Dir)
+	if err != nil {
+		log.Println(err)
 	}
-	ext := ".csv"
-	err := filepath.WalkDir("fxdata", func(str string, d fs.DirEntry, e error) error {
+
+	err = filepath.WalkDir(s.Dir, func(str string, d fs.DirEntry, e error) error {
 		if e != nil {
 			return e
 		}
-		if filepath.Ext(d.Name()) == ext {
-			s.seed(str)
+		if d.IsDir() {
+			return nil
 		}
+		entry, ok := manifest.entry(s.Dir, str)
+		if !ok {
+			return nil
+		}
+
+		importer, err := newImporter(str, entry, s.BaseCurrency)
+		jobs = append(jobs, job{path: str, format: entry.Format, importer: importer, err: err})
 		return nil
 	})
 	if err != nil {
 		log.Println(err)
 	}
+
+	summary := Summary{
+		Files: s.seedAll(jobs),
+		Rows:  make(map[string]int),
+	}
+
+	for _, report := range summary.Files {
+		if report.Err != nil {
+			log.Printf("seed %s: %s, %s", report.Path, report.Status, report.Err)
+		}
+		// failed files may have committed batches before the error
+		for currency, rows := range report.Rows {
+			summary.Rows[currency] += rows
+		}
+	}
+	for currency, rows := range summary.Rows {
+		log.Printf("seeded %d %s rates", rows, currency)
+	}
+
+	return summary
 }
 
-// seed - Parse CSV and seed the db
-// code taken from https://github.com/jasonbronson/example_Go_file_import/blob/master/part3/main.go
-func (s *Seed) seed(path string) {
-	fmt.Println("found seed in path ", path)
+// seedAll - seeds the files with a pool of workers, reports are sorted by path
+func (s *Seed) seedAll(jobs []job) []FileReport {
+	reports := make([]FileReport, len(jobs))
+	queue := make(chan int)
+
+	workers := s.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if jobs[i].err != nil {
+					reports[i] = FileReport{Path: jobs[i].path, Format: jobs[i].format, Status: FileFailed, Err: jobs[i].err}
+					continue
+				}
+				reports[i] = s.seed(jobs[i].path, jobs[i].importer)
+				reports[i].Format = jobs[i].format
+			}
+		}()
+	}
+
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
 
-	symbol := strings.Split(path, "/")
-	// get base and quote currency from symbol slice
-	quoteCurrency := symbol[1][0:3]
-	baseCurrency := symbol[1][3:6]
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Path < reports[j].Path
+	})
+
+	return reports
+}
+
+// seed - streams the file at path and loads the records that were not seeded yet
+func (s *Seed) seed(path string, importer Importer) (report FileReport) {
+	report = FileReport{Path: path, Status: FileNew, Rows: make(map[string]int)}
+	defer func() {
+		if report.Err != nil && report.Status != FileConflict {
+			report.Status = FileFailed
+		}
+	}()
+
+	stored, err := s.DB.GetSeedFile(context.Background(), path)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	if stored != nil {
+		report.Status = FileAppended
+	}
 
 	f, err := os.Open(path)
-	defer f.Close()
 	if err != nil {
-		panic(err)
+		report.Err = err
+		return report
 	}
-	reader := bufio.NewReader(f)
-	var line string
-	var lineCount int64
+	defer f.Close()
+
+	sum := sha256.New()
 	var rates []models.CurrencyRate
-	for {
-		line, err = reader.ReadString('\n')
-		if err == io.EOF {
-			break
+	records := 0
+	// records of a windowed file are loaded again instead of being checked against the stored ones
+	windowed := false
+	if w, ok := importer.(Windowed); ok {
+		windowed = w.Windowed()
+	}
+
+	// records up to the stored count were loaded before, they must not have changed
+	errConflict := errors.New("conflict")
+	err = importer.Import(f, func(record Record) error {
+		if stored != nil && !windowed && records == stored.Lines && hex.EncodeToString(sum.Sum(nil)) != stored.Checksum {
+			return errConflict
+		}
+		records++
+		io.WriteString(sum, record.Raw)
+		io.WriteString(sum, "\n")
+
+		if stored != nil && !windowed && records <= stored.Lines {
+			return nil
 		}
-		if err != nil {
-			panic(err)
+
+		report.Skipped += record.Skipped
+		rates = append(rates, record.Rates...)
+		if len(rates) >= BatchSize {
+			if err := s.insert(rates, &report); err != nil {
+				return err
+			}
+			rates = rates[:0]
+			// the records read so far are committed, a rerun after a later failure appends from here
+			if err := s.saveProgress(path, sum, records); err != nil {
+				return err
+			}
 		}
-		if lineCount == 0 {
-			lineCount++
-			continue
+
+		return nil
+	})
+	if err == errConflict || stored != nil && !windowed && records < stored.Lines {
+		report.Status, report.Err = FileConflict, ErrSeededLinesChanged
+		return report
+	}
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	if stored != nil && records == stored.Lines {
+		if hex.EncodeToString(sum.Sum(nil)) == stored.Checksum {
+			report.Status = FileUnchanged
+			return report
 		}
-		lineCount++
-		r := csv.NewReader(strings.NewReader(line))
-		r.Comma = ','
-		records, err := r.ReadAll()
-		if err != nil {
-			panic(err)
+		if !windowed {
+			report.Status, report.Err = FileConflict, ErrSeededLinesChanged
+			return report
 		}
+	}
 
-		var rate models.CurrencyRate
-		rate.BaseCurrency = baseCurrency
-		rate.QuoteCurrency = quoteCurrency
+	if report.Err = s.insert(rates, &report); report.Err != nil {
+		return report
+	}
 
-		for _, row := range records {
-			rate.Date, err = time.Parse("2006-01-02", row[0])
-			if err != nil {
-				continue
-			}
-			rate.Rate, err = decimal.NewFromString(row[1])
-			if err != nil {
-				continue
+	report.Err = s.saveProgress(path, sum, records)
+
+	return report
+}
+
+// saveProgress - stores the count and checksum of the records of path that were inserted
+func (s *Seed) saveProgress(path string, sum hash.Hash, records int) error {
+	return s.DB.SaveSeedFile(context.Background(), &models.SeedFile{
+		Path:     path,
+		Checksum: hex.EncodeToString(sum.Sum(nil)),
+		Lines:    records,
+	})
+}
+
+// insert - submits rates to the reconciler or bulk inserts them, and counts them per quote currency
+func (s *Seed) insert(rates []models.CurrencyRate, report *FileReport) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	if err := s.store(rates, ImportSource(s.Dir, report.Path)); err != nil {
+		return err
+	}
+	for _, rate := range rates {
+		report.Rows[rate.QuoteCurrency]++
+	}
+
+	return nil
+}
+
+// store - submits rates as the values of source, or inserts the ones that aren't published yet without a reconciler
+func (s *Seed) store(rates []models.CurrencyRate, source string) error {
+	if s.Reconciler != nil {
+		_, err := s.Reconciler.Submit(context.Background(), source, rates)
+		return err
+	}
+
+	if err := s.DB.BulkInsert(rates); err != nil {
+		return err
+	}
+	// the file is a source of its rates, whichever file was loaded first keeps publishing them
+	if sources, ok := s.DB.(database.SourceStore); ok {
+		values := make([]models.SourceRate, len(rates))
+		for i, rate := range rates {
+			values[i] = models.SourceRate{
+				Source:        source,
+				BaseCurrency:  rate.BaseCurrency,
+				QuoteCurrency: rate.QuoteCurrency,
+				Date:          rate.Date,
+				Rate:          rate.Rate,
 			}
-			rates = append(rates, rate)
+		}
+		if err := sources.SaveSourceRates(context.Background(), values); err != nil {
+			return err
 		}
 	}
 
-	if err = s.DB.BulkInsert(rates); err != nil {
-		fmt.Println(err)
+	return nil
+}
+
+// ImportSource - source name of the rates of a seeded file, import: and the path relative to the seeded directory
+func ImportSource(dir string, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		path = rel
 	}
-	fmt.Println("Finished")
+
+	return "import:" + filepath.ToSlash(path)
 }
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/alerts"
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// newEvaluator - alert rule evaluator over db, nil when the backend can't keep rules. The file notifier is only
+// set up when ALERTS_FILE names the file to append to
+func newEvaluator(db database.DatabaseRepo, broker *events.Broker) *alerts.Evaluator {
+	db = unwrapCache(db)
+	store, ok := db.(database.AlertStore)
+	if !ok {
+		return nil
+	}
+
+	notifiers := map[string]alerts.Notifier{
+		alerts.NotifierLog:     alerts.LogNotifier{},
+		alerts.NotifierWebhook: alerts.NewWebhookNotifier(envDuration("ALERTS_WEBHOOK_TIMEOUT", 10*time.Second)),
+	}
+	if path := os.Getenv("ALERTS_FILE"); path != "" {
+		notifiers[alerts.NotifierFile] = &alerts.FileNotifier{Path: path}
+	}
+
+	// rules are checked against the repository itself, a cached latest rate could hide a change from another process
+	return alerts.NewEvaluator(store, db, broker, notifiers, envDuration("ALERTS_INTERVAL", alerts.DefaultInterval))
+}
+
+// CreateAlertRule - stores a rule that notifies when its condition starts to hold
+func (h *Handler) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
+	if h.Alerts == nil {
+		response(w, r, http.StatusNotFound, "Alerts are not supported by this database", nil, nil)
+		return
+	}
+
+	var req objects.AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response(w, r, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+
+	notifiers := make([]string, 0, len(h.Alerts.Notifiers))
+	for name := range h.Alerts.Notifiers {
+		notifiers = append(notifiers, name)
+	}
+	sort.Strings(notifiers)
+
+	v := validator.AlertRule(req.Type, req.Currency, req.Condition, req.Value, req.Notifier, req.Target, notifiers, database.BaseCurrency)
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	rule := models.AlertRule{
+		Type:          req.Type,
+		QuoteCurrency: strings.ToTitle(req.Currency),
+		Condition:     req.Condition,
+		Value:         decimal.RequireFromString(req.Value),
+		Notifier:      req.Notifier,
+		Target:        req.Target,
+	}
+	if err := h.Alerts.Store.CreateAlertRule(r.Context(), &rule); err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+	// a rule that holds already notifies right away instead of on the next scheduled run
+	if err := h.Alerts.Evaluate(r.Context(), []string{rule.QuoteCurrency}); err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+	if stored, err := h.Alerts.Store.GetAlertRule(r.Context(), rule.ID); err == nil {
+		rule = stored
+	}
+
+	response(w, r, http.StatusCreated, "Created alert rule", alertRuleResponse(rule), nil)
+}
+
+// ListAlertRules - every alert rule, currency narrows them down to one quote currency
+func (h *Handler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
+	if h.Alerts == nil {
+		response(w, r, http.StatusNotFound, "Alerts are not supported by this database", nil, nil)
+		return
+	}
+
+	rules, err := h.Alerts.Store.AlertRules(r.Context(), parseCurrencies(r.URL.Query().Get("currency")))
+	if err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+
+	data := make([]objects.AlertRuleResponse, len(rules))
+	for i, rule := range rules {
+		data[i] = alertRuleResponse(rule)
+	}
+	response(w, r, http.StatusOK, "Alert rules", data, nil)
+}
+
+// GetAlertRule - an alert rule and whether it holds
+func (h *Handler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.alertRule(w, r)
+	if !ok {
+		return
+	}
+
+	response(w, r, http.StatusOK, "Alert rule", alertRuleResponse(rule), nil)
+}
+
+// DeleteAlertRule - removes an alert rule
+func (h *Handler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.alertRule(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Alerts.Store.DeleteAlertRule(r.Context(), rule.ID); err != nil {
+		response(w, r, alertErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+
+	response(w, r, http.StatusOK, "Deleted alert rule", nil, nil)
+}
+
+// alertRule - the rule of the id route variable, answers the request itself when there is none
+func (h *Handler) alertRule(w http.ResponseWriter, r *http.Request) (models.AlertRule, bool) {
+	if h.Alerts == nil {
+		response(w, r, http.StatusNotFound, "Alerts are not supported by this database", nil, nil)
+		return models.AlertRule{}, false
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		response(w, r, http.StatusNotFound, database.ErrAlertRuleNotFound.Error(), nil, nil)
+		return models.AlertRule{}, false
+	}
+
+	rule, err := h.Alerts.Store.GetAlertRule(r.Context(), id)
+	if err != nil {
+		response(w, r, alertErrorStatus(err), err.Error(), nil, nil)
+		return models.AlertRule{}, false
+	}
+
+	return rule, true
+}
+
+func alertErrorStatus(err error) int {
+	if errors.Is(err, database.ErrAlertRuleNotFound) {
+		return http.StatusNotFound
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
+
+func alertRuleResponse(rule models.AlertRule) objects.AlertRuleResponse {
+	data := objects.AlertRuleResponse{
+		ID:            rule.ID,
+		Type:          rule.Type,
+		QuoteCurrency: rule.QuoteCurrency,
+		Condition:     rule.Condition,
+		Value:         rule.Value.String(),
+		Notifier:      rule.Notifier,
+		Target:        rule.Target,
+		Active:        rule.Active,
+		CreatedAt:     rule.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if rule.TriggeredAt != nil {
+		data.TriggeredAt = rule.TriggeredAt.UTC().Format(time.RFC3339)
+	}
+
+	return data
+}
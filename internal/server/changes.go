@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// ListenRetryInterval - wait before listening again after the listener failed
+const ListenRetryInterval = 5 * time.Second
+
+// listenForChanges - drops cached results and wakes the event broker when any process changes a rate, so
+// replicas don't serve stale rates or hold back events until their next poll. Turned off with DB_LISTEN=false
+func (h *Handler) listenForChanges(ctx context.Context) {
+	listener, ok := unwrapCache(h.DB).(database.ChangeListener)
+	if !ok || os.Getenv("DB_LISTEN") == "false" {
+		return
+	}
+	c, _ := h.DB.(*cache.Cache)
+
+	for {
+		err := listener.ListenForChanges(ctx, func(change *models.RateChange) {
+			if c != nil && change == nil {
+				c.Purge()
+			}
+			if c != nil && change != nil && change.To.IsZero() {
+				c.Invalidate(change.QuoteCurrency, change.Date)
+			}
+			if c != nil && change != nil && !change.To.IsZero() {
+				c.InvalidateRange(change.QuoteCurrency, change.Date, change.To)
+			}
+			h.Events.Notify()
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("rate change listener stopped, listening again: ", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ListenRetryInterval):
+		}
+	}
+}
@@ -2,65 +2,68 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	database "github.com/Shambou/golang-challenge/internal/database/postgres"
+	"github.com/Shambou/golang-challenge/internal/database"
 	"github.com/Shambou/golang-challenge/internal/models"
 	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
 	"github.com/Shambou/golang-challenge/internal/validator"
 	"github.com/gorilla/mux"
 )
 
 // GetLatestRate - gets the latest requested rate for quote_currency
 func (h *Handler) GetLatestRate(w http.ResponseWriter, r *http.Request) {
-	v := validator.New(mux.Vars(r))
-	v.Length("quote_currency", 3)
+	v := validator.LatestRate(mux.Vars(r)["quote_currency"]).RateType(r.URL.Query().Get("type"))
 
 	if !v.Valid() {
 		fmt.Println(v.Errors)
-		jsonResponse(w, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
 		return
 	}
 
-	currencyRate, err := h.DB.GetLastRate(r.Context(), v.Get("quote_currency"))
+	rateType := models.RateType(v.Get("type"))
+	currencyRate, err := database.GetLastRateOfType(r.Context(), h.DB, v.Get("quote_currency"), rateType)
 	if err != nil {
-		jsonResponse(w, http.StatusOK, err.Error(), nil, nil)
+		response(w, r, readStatus(err), err.Error(), nil, nil)
 		return
 	}
 
 	message := fmt.Sprintf("Last rate for stored for %s%s", currencyRate.QuoteCurrency, currencyRate.BaseCurrency)
 
-	jsonResponse(w, http.StatusOK, message, objects.BaseRateResponse{
-		Date:          currencyRate.Date.Format("2006-02-01"),
+	response(w, r, http.StatusOK, message, objects.BaseRateResponse{
+		Date:          currencyRate.Date.Format("2006-01-02"),
 		BaseCurrency:  currencyRate.BaseCurrency,
 		QuoteCurrency: currencyRate.QuoteCurrency,
 		Rate:          currencyRate.Rate.StringFixedBank(4),
+		Type:          rateType,
 	}, nil)
 }
 
 // GetRatesInRange - gets the rates between two dates
 func (h *Handler) GetRatesInRange(w http.ResponseWriter, r *http.Request) {
-	v := validator.New(mux.Vars(r))
-	v.Length("quote_currency", 3)
-	v.Date("from", "to")
+	vars := mux.Vars(r)
+	v := validator.RatesInRange(vars["quote_currency"], vars["from"], vars["to"]).RateType(r.URL.Query().Get("type"))
 
 	if !v.Valid() {
 		fmt.Println(v.Errors)
-		jsonResponse(w, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
 		return
 	}
 
 	fromDate, err := time.Parse("2006-01-02", v.Get("from"))
 	toDate, err := time.Parse("2006-01-02", v.Get("to"))
 	quoteCurrency := strings.ToTitle(v.Get("quote_currency"))
+	rateType := models.RateType(v.Get("type"))
 
-	rates, err := h.DB.GetRatesInRange(r.Context(), quoteCurrency, fromDate, toDate)
+	rates, err := database.GetRatesInRangeOfType(r.Context(), h.DB, quoteCurrency, fromDate, toDate, rateType)
 	if err != nil {
 		fmt.Println(err)
-		jsonResponse(w, http.StatusOK, err.Error(), nil, nil)
+		response(w, r, readStatus(err), err.Error(), nil, nil)
 		return
 	}
 
@@ -77,6 +80,7 @@ func (h *Handler) GetRatesInRange(w http.ResponseWriter, r *http.Request) {
 	data := objects.RangeRatesResponse{
 		BaseCurrency:  database.BaseCurrency,
 		QuoteCurrency: quoteCurrency,
+		Type:          rateType,
 		Rates:         rangeRates,
 	}
 
@@ -87,25 +91,25 @@ func (h *Handler) GetRatesInRange(w http.ResponseWriter, r *http.Request) {
 		toDate.Format("2006-01-02"),
 	)
 
-	jsonResponse(w, http.StatusOK, message, data, nil)
+	response(w, r, http.StatusOK, message, data, nil)
 }
 
 // GetTimeseriesData - gets the all available rates on date
 func (h *Handler) GetTimeseriesData(w http.ResponseWriter, r *http.Request) {
-	v := validator.New(mux.Vars(r))
-	v.Date("date")
+	v := validator.Timeseries(mux.Vars(r)["date"]).RateType(r.URL.Query().Get("type"))
 
 	if !v.Valid() {
 		fmt.Println(v.Errors)
-		jsonResponse(w, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
 		return
 	}
 
+	rateType := models.RateType(v.Get("type"))
 	date, err := time.Parse("2006-01-02", v.Get("date"))
-	rates, err := h.DB.GetAllRatesOnDate(r.Context(), date)
+	rates, err := database.GetAllRatesOnDateOfType(r.Context(), h.DB, date, rateType)
 
 	if err != nil {
-		jsonResponse(w, http.StatusOK, err.Error(), nil, nil)
+		response(w, r, readStatus(err), err.Error(), nil, nil)
 		return
 	}
 
@@ -122,11 +126,12 @@ func (h *Handler) GetTimeseriesData(w http.ResponseWriter, r *http.Request) {
 	data := objects.QuoteRatesResponse{
 		BaseCurrency: database.BaseCurrency,
 		Date:         date.Format("2006-01-02"),
+		Type:         rateType,
 		Rates:        quoteRates,
 	}
 	message := fmt.Sprintf("All available currency rates on %s", data.Date)
 
-	jsonResponse(w, http.StatusOK, message, data, nil)
+	response(w, r, http.StatusOK, message, data, nil)
 }
 
 // StoreRate - stores new rate
@@ -134,51 +139,158 @@ func (h *Handler) StoreRate(w http.ResponseWriter, r *http.Request) {
 	var postRateReq objects.PostRateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&postRateReq); err != nil {
-		jsonResponse(w, http.StatusBadRequest, err.Error(), nil, nil)
+		response(w, r, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
 
 	vars := mux.Vars(r)
-	data := make(map[string]string)
-	data["currency"] = vars["currency"]
-	data["rate"] = postRateReq.Rate.String()
-	data["date"] = postRateReq.Date
-
-	v := validator.New(data)
-	v.Date("date")
-	v.DateInFuture("date")
-	v.NotEqual("currency", database.BaseCurrency)
-	v.ValidRate("rate")
+	v := validator.StoreRate(vars["currency"], postRateReq.Date, postRateReq.Rate.String(), database.BaseCurrency).RateType(postRateReq.Type)
 
 	if !v.Valid() {
 		fmt.Println(v.Errors)
-		jsonResponse(w, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
 		return
 	}
 
 	date, err := time.Parse("2006-01-02", postRateReq.Date)
 
-	if h.DB.CheckRateQuoteOnDateExists(r.Context(), v.Get("currency"), date) {
-		jsonResponse(w, http.StatusUnprocessableEntity, "Rate for this currency and date already exists", nil, nil)
-		return
-	}
-
 	var currencyRate = models.CurrencyRate{}
 	currencyRate.QuoteCurrency = strings.ToTitle(vars["currency"])
 	currencyRate.Date = date
 	currencyRate.Rate = postRateReq.Rate
+	currencyRate.Type = models.RateType(postRateReq.Type)
+
+	if !database.SupportsRateType(unwrapCache(h.DB), currencyRate.Type) {
+		response(w, r, http.StatusNotImplemented, database.ErrNotSupported.Error(), nil, nil)
+		return
+	}
 
-	err = h.DB.CreateRate(r.Context(), &currencyRate)
+	switch {
+	case !h.reconciles(currencyRate):
+		err = h.DB.CreateRate(r.Context(), &currencyRate)
+	case h.DB.CheckRateQuoteOnDateExists(r.Context(), currencyRate.QuoteCurrency, currencyRate.Date):
+		err = database.ErrRateExists
+	default:
+		currencyRate, err = h.Reconciler.SubmitRate(r.Context(), models.SourceAPI, currencyRate)
+	}
+	if errors.Is(err, database.ErrRateExists) {
+		response(w, r, http.StatusUnprocessableEntity, "Rate for this currency and date already exists", nil, nil)
+		return
+	}
+	if errors.Is(err, reconcile.ErrRejected) {
+		response(w, r, http.StatusConflict, err.Error(), nil, nil)
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
-		jsonResponse(w, http.StatusInternalServerError, err.Error(), nil, nil)
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
 		return
 	}
+	h.Events.Notify()
 
-	jsonResponse(w, http.StatusCreated, "Stored new rate", objects.BaseRateResponse{
+	response(w, r, http.StatusCreated, "Stored new rate", objects.BaseRateResponse{
 		BaseCurrency:  currencyRate.BaseCurrency,
 		QuoteCurrency: currencyRate.QuoteCurrency,
 		Rate:          currencyRate.Rate.StringFixedBank(4),
 		Date:          currencyRate.Date.Format("2006-01-02"),
+		Type:          currencyRate.Type,
 	}, nil)
 }
+
+// UpdateRate - changes the rate of a currency on a date
+func (h *Handler) UpdateRate(w http.ResponseWriter, r *http.Request) {
+	var putRateReq objects.PostRateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&putRateReq); err != nil {
+		response(w, r, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+
+	vars := mux.Vars(r)
+	v := validator.StoreRate(vars["currency"], putRateReq.Date, putRateReq.Rate.String(), database.BaseCurrency).RateType(putRateReq.Type)
+
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	date, _ := time.Parse("2006-01-02", putRateReq.Date)
+	currencyRate := models.CurrencyRate{
+		QuoteCurrency: strings.ToTitle(vars["currency"]),
+		Date:          date,
+		Rate:          putRateReq.Rate,
+		Type:          models.RateType(putRateReq.Type),
+	}
+
+	if !database.SupportsRateType(unwrapCache(h.DB), currencyRate.Type) {
+		response(w, r, http.StatusNotImplemented, database.ErrNotSupported.Error(), nil, nil)
+		return
+	}
+
+	var err error
+	switch {
+	case !h.reconciles(currencyRate):
+		err = database.UpdateRate(r.Context(), h.DB, &currencyRate)
+	case !h.DB.CheckRateQuoteOnDateExists(r.Context(), currencyRate.QuoteCurrency, currencyRate.Date):
+		err = database.ErrRateNotFound
+	default:
+		currencyRate, err = h.Reconciler.SubmitRate(r.Context(), models.SourceAPI, currencyRate)
+	}
+	if err != nil {
+		response(w, r, rateEditStatus(err), err.Error(), nil, nil)
+		return
+	}
+	h.Events.Notify()
+
+	response(w, r, http.StatusOK, "Updated rate", objects.BaseRateResponse{
+		BaseCurrency:  currencyRate.BaseCurrency,
+		QuoteCurrency: currencyRate.QuoteCurrency,
+		Rate:          currencyRate.Rate.StringFixedBank(4),
+		Date:          currencyRate.Date.Format("2006-01-02"),
+		Type:          currencyRate.Type,
+	}, nil)
+}
+
+// DeleteRate - removes the rate of a currency on a date
+func (h *Handler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	v := validator.DeleteRate(vars["currency"], vars["date"]).RateType(r.URL.Query().Get("type"))
+
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	date, _ := time.Parse("2006-01-02", v.Get("date"))
+	err := database.DeleteRateOfType(r.Context(), h.DB, v.Get("currency"), date, v.Get("type"))
+	if err != nil {
+		response(w, r, rateEditStatus(err), err.Error(), nil, nil)
+		return
+	}
+	h.Events.Notify()
+
+	response(w, r, http.StatusOK, "Deleted rate", nil, nil)
+}
+
+// readStatus - status of a failed lookup, errors of a lookup that ran are sent with 200 like an empty result
+func readStatus(err error) int {
+	if errors.Is(err, database.ErrNotSupported) {
+		return http.StatusNotImplemented
+	}
+
+	return errorStatus(err, http.StatusOK)
+}
+
+// rateEditStatus - status of a failed update or delete
+func rateEditStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrRateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, reconcile.ErrRejected):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
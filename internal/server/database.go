@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	postgres "github.com/Shambou/golang-challenge/internal/database/postgres"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/seeds"
+)
+
+// newPostgresDatabase - connects to postgres, runs the migrations and seeds the rates table. If postgres isn't up
+// within DB_CONNECT_TIMEOUT the app starts anyway and setup finishes once it's reachable, the returned channel is
+// closed when setup is done
+func newPostgresDatabase() (*postgres.Database, <-chan struct{}) {
+	db := postgres.NewDatabase()
+	db.Timeouts = dbTimeouts()
+	db.ConfigurePool(postgres.PoolConfig{
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: envDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+	})
+	retry := postgres.RetryConfig{
+		InitialBackoff: envDuration("DB_RETRY_INITIAL_BACKOFF", postgres.DefaultRetryConfig.InitialBackoff),
+		MaxBackoff:     envDuration("DB_RETRY_MAX_BACKOFF", postgres.DefaultRetryConfig.MaxBackoff),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("DB_CONNECT_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	setup := make(chan struct{})
+	if err := db.Connect(ctx, retry); err != nil {
+		log.Println("starting without database", err)
+		go func() {
+			// no deadline here, the app is useless without the db anyway
+			_ = db.Connect(context.Background(), retry)
+			setupPostgres(db)
+			close(setup)
+		}()
+
+		return db, setup
+	}
+
+	setupPostgres(db)
+	close(setup)
+
+	return db, setup
+}
+
+// setupPostgres - runs the migrations and seeds the rates table
+func setupPostgres(db *postgres.Database) {
+	if autoMigrate() {
+		err := db.MigrateDB()
+		if err != nil && err.Error() != "no change" {
+			log.Println("failed to setup database", err)
+		}
+	}
+
+	seeder := seeds.New(db)
+	seeder.Reconciler = newReconciler(db)
+	seeder.Execute()
+}
+
+// newSQLiteDatabase - opens the sqlite file from SQLITE_PATH, runs the migrations and seeds the rates table
+func newSQLiteDatabase() *sqlite.Database {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = sqlite.DefaultPath
+	}
+	db := sqlite.NewDatabase(path)
+	db.Timeouts = dbTimeouts()
+
+	if autoMigrate() {
+		err := db.MigrateDB()
+		if err != nil && err.Error() != "no change" {
+			log.Println("failed to setup database", err)
+		}
+	}
+
+	seeder := seeds.New(db)
+	seeder.Reconciler = newReconciler(db)
+	seeder.Execute()
+
+	return db
+}
+
+// newMemoryDatabase - builds an in-memory store loaded from the fxdata directory, no external services needed
+func newMemoryDatabase() *memory.Memory {
+	log.Println("Setting up in-memory database")
+
+	db := memory.NewMemory(database.BaseCurrency)
+	if err := db.LoadDir("fxdata", ".csv"); err != nil {
+		log.Println("failed to load fxdata", err)
+	}
+
+	return db
+}
+
+// newCache - wraps db in a read-through cache configured by CACHE_SIZE, CACHE_LATEST_TTL and CACHE_HISTORY_TTL,
+// CACHE_SIZE=0 turns it off
+func newCache(db database.DatabaseRepo) database.DatabaseRepo {
+	config := cache.DefaultConfig
+	config.Size = envInt("CACHE_SIZE", config.Size)
+	config.LatestTTL = envDuration("CACHE_LATEST_TTL", config.LatestTTL)
+	config.HistoryTTL = envDuration("CACHE_HISTORY_TTL", config.HistoryTTL)
+
+	if config.Size <= 0 {
+		return db
+	}
+
+	return cache.NewCache(db, config)
+}
+
+// autoMigrate - migrations run on startup unless DB_AUTO_MIGRATE=false, then they are left to `app migrate up`
+func autoMigrate() bool {
+	return os.Getenv("DB_AUTO_MIGRATE") != "false"
+}
+
+// dbTimeouts - query timeouts from DB_READ_TIMEOUT and DB_WRITE_TIMEOUT
+func dbTimeouts() database.Timeouts {
+	return database.Timeouts{
+		Read:  envDuration("DB_READ_TIMEOUT", database.DefaultTimeouts.Read),
+		Write: envDuration("DB_WRITE_TIMEOUT", database.DefaultTimeouts.Write),
+	}
+}
+
+// envInt - parses an int from the env var, falls back to def when unset or invalid
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s: %s", key, err)
+		return def
+	}
+
+	return i
+}
+
+// envDuration - parses a duration like 30s or 5m from the env var, falls back to def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid %s: %s", key, err)
+		return def
+	}
+
+	return d
+}
+
+// envPositiveDuration - like envDuration, but falls back to def for durations that aren't positive, tickers panic on them
+func envPositiveDuration(key string, def time.Duration) time.Duration {
+	d := envDuration(key, def)
+	if d <= 0 {
+		log.Printf("invalid %s: %s is not positive", key, d)
+		return def
+	}
+
+	return d
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
+	"github.com/Shambou/golang-challenge/internal/events"
+)
+
+// connKey - context key of the connection a request came in on
+type connKey struct{}
+
+// newBroker - broker over the event store of db, nil when the backend doesn't record events
+func newBroker(db database.DatabaseRepo) *events.Broker {
+	store, ok := unwrapCache(db).(database.EventStore)
+	if !ok {
+		return nil
+	}
+
+	broker := events.NewBroker(store)
+	broker.PollInterval = envPositiveDuration("EVENTS_POLL_INTERVAL", events.DefaultPollInterval)
+	broker.BufferSize = envInt("EVENTS_BUFFER_SIZE", events.DefaultBufferSize)
+	if broker.BufferSize < 0 {
+		log.Printf("invalid EVENTS_BUFFER_SIZE: %d is negative", broker.BufferSize)
+		broker.BufferSize = events.DefaultBufferSize
+	}
+
+	return broker
+}
+
+// unwrapCache - the repository behind the cache, the cache only passes on rate reads and writes
+func unwrapCache(db database.DatabaseRepo) database.DatabaseRepo {
+	if c, ok := db.(*cache.Cache); ok {
+		return c.DatabaseRepo
+	}
+
+	return db
+}
+
+// saveConn - keeps the connection in the request context so long lived responses can lift its write deadline
+func saveConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// clearWriteDeadline - lets a streaming response outlive the server WriteTimeout, the deadline is set again
+// for the next request on the connection
+func clearWriteDeadline(r *http.Request) {
+	if conn, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		_ = conn.SetWriteDeadline(time.Time{})
+	}
+}
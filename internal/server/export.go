@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/export"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/validator"
+)
+
+// ExportRates - streams rates of several currencies between two dates as csv, ndjson or parquet
+func (h *Handler) ExportRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := map[string]string{
+		"currencies": query.Get("currencies"),
+		"from":       query.Get("from"),
+		"to":         query.Get("to"),
+		"format":     query.Get("format"),
+	}
+
+	v := validator.New(data).RateType(query.Get("type"))
+	v.Currencies("currencies")
+	v.Date("from", "to")
+	v.In("format", export.Formats...)
+
+	if !v.Valid() {
+		fmt.Println(v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	fromDate, _ := time.Parse("2006-01-02", v.Get("from"))
+	toDate, _ := time.Parse("2006-01-02", v.Get("to"))
+
+	currencies := parseCurrencies(v.Get("currencies"))
+
+	rateType := models.RateType(v.Get("type"))
+	format := v.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	// a single currency as csv is served like the fxdata files so it can be seeded again
+	zipped := len(currencies) != 1
+	name := fmt.Sprintf("rates_%s_%s", fromDate.Format("2006-01-02"), toDate.Format("2006-01-02"))
+	if !zipped && format == export.FormatCSV {
+		name = currencies[0] + database.BaseCurrency
+	}
+	if rateType != models.RateMid {
+		name += "_" + rateType
+	}
+	file := export.FileFor(format, name, zipped)
+
+	// the writer is created with the first rate, until then a failed query can still get a json error
+	var out export.Writer
+	start := func() error {
+		w.Header().Set("Content-Type", file.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
+
+		var err error
+		out, err = export.NewWriter(w, format, zipped)
+
+		return err
+	}
+
+	// a large export takes longer than the server WriteTimeout, it ends when the client goes away
+	clearWriteDeadline(r)
+
+	err := database.StreamRatesOfType(r.Context(), h.DB, currencies, fromDate, toDate, rateType, func(rate models.CurrencyRate) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		return out.Write(rate)
+	})
+	if err != nil && out == nil {
+		fmt.Println(err)
+		status := errorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, database.ErrNotSupported) {
+			status = http.StatusNotImplemented
+		}
+		response(w, r, status, err.Error(), nil, nil)
+		return
+	}
+	if err != nil {
+		// the status is already sent, aborting keeps the client from taking a truncated file for a whole one
+		log.Println("export interrupted: ", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if out == nil {
+		if err = start(); err != nil {
+			fmt.Println(err)
+			response(w, r, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+	}
+	if err = out.Close(); err != nil {
+		log.Println("export interrupted: ", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
 	"github.com/Shambou/golang-challenge/internal/objects"
 	"github.com/Shambou/golang-challenge/internal/validator"
 	"github.com/gorilla/mux"
@@ -11,27 +13,29 @@ import (
 
 // GetLatestFileRate - gets the latest requested rate for quote_currency
 func (h *Handler) GetLatestFileRate(w http.ResponseWriter, r *http.Request) {
-	v := validator.New(mux.Vars(r))
-	v.Length("quote_currency", 3)
+	v := validator.LatestRate(mux.Vars(r)["quote_currency"]).RateType(r.URL.Query().Get("type"))
 
 	if !v.Valid() {
 		fmt.Println(v.Errors)
-		jsonResponse(w, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
 		return
 	}
 
-	currencyRate, err := h.File.GetLastRate(r.Context(), v.Get("quote_currency"))
+	// the fxdata files only have mid rates
+	rateType := models.RateType(v.Get("type"))
+	currencyRate, err := database.GetLastRateOfType(r.Context(), h.File, v.Get("quote_currency"), rateType)
 	if err != nil {
-		jsonResponse(w, http.StatusOK, err.Error(), nil, nil)
+		response(w, r, readStatus(err), err.Error(), nil, nil)
 		return
 	}
 
 	message := fmt.Sprintf("Last rate for stored for %s%s", currencyRate.QuoteCurrency, currencyRate.BaseCurrency)
 
-	jsonResponse(w, http.StatusOK, message, objects.BaseRateResponse{
-		Date:          currencyRate.Date.Format("2006-02-01"),
+	response(w, r, http.StatusOK, message, objects.BaseRateResponse{
+		Date:          currencyRate.Date.Format("2006-01-02"),
 		BaseCurrency:  currencyRate.BaseCurrency,
 		QuoteCurrency: currencyRate.QuoteCurrency,
 		Rate:          currencyRate.Rate.StringFixedBank(4),
+		Type:          rateType,
 	}, nil)
 }
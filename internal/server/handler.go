@@ -3,58 +3,162 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
+	"github.com/Shambou/golang-challenge/internal/alerts"
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
 	file "github.com/Shambou/golang-challenge/internal/database/file"
-	database "github.com/Shambou/golang-challenge/internal/database/postgres"
-	"github.com/Shambou/golang-challenge/internal/seeds"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/outbox"
+	"github.com/Shambou/golang-challenge/internal/provider"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+	"github.com/Shambou/golang-challenge/internal/render"
+	"github.com/Shambou/golang-challenge/internal/retention"
+	"github.com/Shambou/golang-challenge/internal/rpc"
+	"github.com/Shambou/golang-challenge/internal/webhooks"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 )
 
+// DefaultGRPCPort - used when GRPC_PORT is not set
+const DefaultGRPCPort = "9090"
+
 type Handler struct {
 	Router *mux.Router
 	Server *http.Server
-	DB     *database.Database
-	File   *file.File
+	// GRPC - the rates service on GRPC_PORT, served next to the REST API
+	GRPC *grpc.Server
+	DB   database.DatabaseRepo
+	File *file.File
+	// Events - live rate events, nil when the backend doesn't record them
+	Events *events.Broker
+	// Webhooks - sends rate events to registered endpoints, nil when the backend can't keep them
+	Webhooks *webhooks.Dispatcher
+	// Alerts - evaluates alert rules, nil when the backend can't keep them
+	Alerts *alerts.Evaluator
+	// Outbox - publishes the outbox to the sinks in OUTBOX_SINKS, nil when there are none
+	Outbox *outbox.Relay
+	// Bus - in-process sink of the outbox, nil unless OUTBOX_SINKS lists bus
+	Bus *outbox.Bus
+	// Reconciler - keeps the value of every source and publishes the reconciled rate, nil when the backend can't
+	// keep them
+	Reconciler *reconcile.Reconciler
+	// Scheduler - fetches rates from the provider in PROVIDER once a day, nil when it is not set
+	Scheduler *provider.Scheduler
+	// Retention - deletes the events and outbox messages every reader is done with, nil when the backend keeps none
+	Retention *retention.Job
+	// WebSocket - limits of connections to the rates websocket
+	WebSocket WebSocketConfig
+	// Setup - closed once migrations and seeding are done, /ready reports not ready until then. Nil when there is
+	// nothing to wait for
+	Setup <-chan struct{}
+
+	// ctx - parent of every request context, cancelled when shutdown runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type JsonResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-	Errors  interface{} `json:"errors"`
+	XMLName xml.Name    `json:"-" xml:"response"`
+	Message string      `json:"message" xml:"message"`
+	Data    interface{} `json:"data" xml:"data,omitempty"`
+	Errors  interface{} `json:"errors" xml:"errors,omitempty"`
+}
+
+// Table - csv of the data or the errors, responses without either are just their message
+func (j JsonResponse) Table() ([]string, [][]string) {
+	if table, ok := j.Data.(render.Tabular); ok {
+		return table.Table()
+	}
+	if table, ok := j.Errors.(render.Tabular); ok {
+		return table.Table()
+	}
+
+	return []string{"message"}, [][]string{{j.Message}}
 }
 
-// New - creates a new HTTP handler
+// New - creates a new HTTP handler, DB_DRIVER picks the backend: postgres (default), sqlite or memory
 func New() *Handler {
-	h := &Handler{
-		DB:   database.NewDatabase(),
-		File: file.NewFile("USD", "fxdata/", ".csv"),
+	var db database.DatabaseRepo
+	var setup <-chan struct{}
+	switch os.Getenv("DB_DRIVER") {
+	case "sqlite":
+		db = newSQLiteDatabase()
+	case "memory":
+		db = newMemoryDatabase()
+	default:
+		db, setup = newPostgresDatabase()
 	}
 
-	h.Router = mux.NewRouter()
-	h.MapRoutes()
+	h := NewHandler(newCache(db), file.NewFile(database.BaseCurrency, "fxdata/", ".csv"))
+	h.Setup = setup
+
+	return h
+}
 
-	err := h.DB.MigrateDB()
-	if err != nil && err.Error() != "no change" {
-		log.Println("failed to setup database", err)
+// NewHandler - creates a new HTTP handler on top of the given repository
+func NewHandler(db database.DatabaseRepo, f *file.File) *Handler {
+	h := &Handler{
+		DB:        db,
+		File:      f,
+		WebSocket: webSocketConfig(),
 	}
 
-	seeder := seeds.New(h.DB)
-	seeder.Execute()
+	h.Events = newBroker(db)
+	h.Webhooks = newDispatcher(db, h.Events)
+	h.Alerts = newEvaluator(db, h.Events)
+	h.Outbox, h.Bus = newRelay(db, h.Events)
+	h.Reconciler = newReconciler(db)
+	h.Scheduler = newScheduler(db, h.Reconciler)
+	h.Retention = newRetention(db)
+	h.Router = mux.NewRouter()
+	h.MapRoutes()
+	h.GRPC = rpc.NewServer(db, h.Events, h.Reconciler)
 
+	h.ctx, h.cancel = context.WithCancel(context.Background())
 	h.Server = &http.Server{
 		Addr:    ":" + os.Getenv("PORT"),
 		Handler: h.Router,
+		BaseContext: func(net.Listener) context.Context {
+			return h.ctx
+		},
+		ConnContext: saveConn,
 		// Good practice to set timeouts to avoid slow loris attacks.
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
 	}
 
+	if h.Events != nil {
+		go h.Events.Run(h.ctx)
+		// streams never go idle, closing them lets Shutdown finish
+		h.Server.RegisterOnShutdown(h.Events.Close)
+	}
+	if h.Webhooks != nil {
+		go h.Webhooks.Run(h.ctx)
+	}
+	if h.Alerts != nil {
+		go h.Alerts.Run(h.ctx)
+	}
+	if h.Outbox != nil {
+		go h.Outbox.Run(h.ctx)
+	}
+	if h.Scheduler != nil {
+		go h.Scheduler.Run(h.ctx)
+	}
+	if h.Retention != nil {
+		go h.Retention.Run(h.ctx)
+	}
+	go h.listenForChanges(h.ctx)
+
 	return h
 }
 
@@ -67,6 +171,21 @@ func (h *Handler) Serve() error {
 		}
 	}()
 
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = DefaultGRPCPort
+	}
+	log.Printf("Serving grpc on :%s port", grpcPort)
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := h.GRPC.Serve(lis); err != nil {
+			log.Println(err)
+		}
+	}()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
@@ -74,7 +193,20 @@ func (h *Handler) Serve() error {
 	// Create a deadline to wait for
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
-	err := h.Server.Shutdown(ctx)
+	grpcStopped := make(chan struct{})
+	go func() {
+		h.GRPC.GracefulStop()
+		close(grpcStopped)
+	}()
+	err = h.Server.Shutdown(ctx)
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		// cut off streams that are still open
+		h.GRPC.Stop()
+	}
+	// abort queries of requests that are still running
+	h.cancel()
 	if err != nil {
 		return err
 	}
@@ -83,10 +215,29 @@ func (h *Handler) Serve() error {
 	return nil
 }
 
-// ReadyCheck - Check if are connected to the database
+// Close - stops the background workers of a handler that is never served, Serve stops them on shutdown
+func (h *Handler) Close() {
+	h.cancel()
+}
+
+// ReadyCheck - Check if are connected to the database and done setting it up
 func (h *Handler) ReadyCheck(w http.ResponseWriter, r *http.Request) {
+	if h.Setup != nil {
+		select {
+		case <-h.Setup:
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if err := json.NewEncoder(w).Encode("Database is being set up"); err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
 	if err := h.DB.Ping(r.Context()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode("Database is not reachable"); err != nil {
+			panic(err)
+		}
 		return
 	}
 
@@ -96,10 +247,33 @@ func (h *Handler) ReadyCheck(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// jsonResponse - renders json response
-func jsonResponse(w http.ResponseWriter, status int, message string, data interface{}, errors interface{}) {
+// CacheStats - reports how many reads were served from the cache
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.DB.(*cache.Cache)
+	if !ok {
+		response(w, r, http.StatusNotFound, "Cache is disabled", nil, nil)
+		return
+	}
+
+	response(w, r, http.StatusOK, "Cache stats", c.Stats(), nil)
+}
+
+// errorStatus - status for a failed repository call, timeouts get 504 so clients know they can retry
+func errorStatus(err error, status int) int {
+	if errors.Is(err, database.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+
+	return status
+}
+
+// response - renders the response in the format negotiated for the request
+func response(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}, errors interface{}) {
+	renderer := rendererFor(r)
+
+	w.Header().Set("Content-Type", renderer.ContentType())
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(JsonResponse{
+	if err := renderer.Render(w, JsonResponse{
 		Message: message,
 		Data:    data,
 		Errors:  errors,
@@ -1,13 +1,36 @@
 package server
 
 import (
+	"context"
 	"net/http"
+
+	"github.com/Shambou/golang-challenge/internal/render"
 )
 
-// JSONMiddleware - sets content type to application json
-func JSONMiddleware(next http.Handler) http.Handler {
+// rendererKey - context key of the renderer picked by NegotiateMiddleware
+type rendererKey struct{}
+
+// NegotiateMiddleware - picks the renderer of the response from the format query parameter or the Accept header,
+// answers 406 when neither can be rendered
+func NegotiateMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		next.ServeHTTP(w, r)
+		w.Header().Add("Vary", "Accept")
+
+		renderer, err := render.Negotiate(r.Header.Get("Accept"), r.URL.Query().Get("format"))
+		if err != nil {
+			response(w, r, http.StatusNotAcceptable, err.Error(), nil, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rendererKey{}, renderer)))
 	})
 }
+
+// rendererFor - renderer picked for the request, json when the route doesn't negotiate
+func rendererFor(r *http.Request) render.Renderer {
+	if renderer, ok := r.Context().Value(rendererKey{}).(render.Renderer); ok {
+		return renderer
+	}
+
+	return render.Default
+}
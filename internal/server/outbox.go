@@ -0,0 +1,57 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/outbox"
+)
+
+// newRelay - outbox relay publishing to the sinks listed in OUTBOX_SINKS, nil when none are listed or the backend
+// has no outbox. The bus is returned too when it is one of the sinks
+func newRelay(db database.DatabaseRepo, broker *events.Broker) (*outbox.Relay, *outbox.Bus) {
+	store, ok := unwrapCache(db).(database.OutboxStore)
+	if !ok || os.Getenv("OUTBOX_SINKS") == "" {
+		return nil, nil
+	}
+
+	timeout := envDuration("OUTBOX_TIMEOUT", 10*time.Second)
+	var bus *outbox.Bus
+	var sinks []outbox.Sink
+	for _, name := range strings.Split(os.Getenv("OUTBOX_SINKS"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case outbox.SinkBus:
+			bus = outbox.NewBus()
+			sinks = append(sinks, bus)
+		case outbox.SinkWebhook:
+			sinks = append(sinks, outbox.NewWebhookSink(os.Getenv("OUTBOX_WEBHOOK_URL"), os.Getenv("OUTBOX_WEBHOOK_SECRET"), timeout))
+		case outbox.SinkFile:
+			sinks = append(sinks, &outbox.FileSink{Path: os.Getenv("OUTBOX_FILE")})
+		case outbox.SinkNATS:
+			sinks = append(sinks, outbox.NewNATSSink(os.Getenv("OUTBOX_NATS_URL"), timeout))
+		default:
+			log.Printf("unknown outbox sink %q", name)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	// the claim is renewed between publishes, one that times out must still end within half of the lease
+	lease := envDuration("OUTBOX_LEASE", outbox.DefaultConfig.Lease)
+	if lease <= 2*timeout {
+		lease = 2*timeout + time.Second
+		log.Printf("OUTBOX_LEASE has to be more than twice OUTBOX_TIMEOUT, using %s", lease)
+	}
+
+	return outbox.NewRelay(store, broker, outbox.Config{
+		PollInterval:   envDuration("OUTBOX_POLL_INTERVAL", outbox.DefaultConfig.PollInterval),
+		InitialBackoff: envDuration("OUTBOX_INITIAL_BACKOFF", outbox.DefaultConfig.InitialBackoff),
+		MaxBackoff:     envDuration("OUTBOX_MAX_BACKOFF", outbox.DefaultConfig.MaxBackoff),
+		Lease:          lease,
+	}, sinks...), bus
+}
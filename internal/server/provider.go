@@ -0,0 +1,70 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/provider"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+)
+
+// newScheduler - daily rate fetcher for the provider PROVIDER picks, nil when it is not set. Fetched rates go
+// through reconciler when there is one
+func newScheduler(db database.DatabaseRepo, reconciler *reconcile.Reconciler) *provider.Scheduler {
+	var p provider.RateProvider
+	switch name := os.Getenv("PROVIDER"); name {
+	case "":
+		return nil
+	case provider.ProviderHTTP:
+		p = provider.NewHTTPProvider(os.Getenv("PROVIDER_URL"), os.Getenv("PROVIDER_API_KEY"), envDuration("PROVIDER_TIMEOUT", 30*time.Second))
+	case provider.ProviderStub:
+		rates, err := provider.ParseStubRates(os.Getenv("PROVIDER_STUB_RATES"))
+		if err != nil {
+			log.Printf("invalid PROVIDER_STUB_RATES: %s", err)
+			return nil
+		}
+		p = provider.NewStub(rates)
+	default:
+		log.Printf("unknown provider %q", name)
+		return nil
+	}
+
+	config := provider.DefaultConfig
+	config.At = envTimeOfDay("PROVIDER_FETCH_AT", config.At)
+	config.RetryInterval = envPositiveDuration("PROVIDER_RETRY_INTERVAL", config.RetryInterval)
+	config.Lease = envPositiveDuration("PROVIDER_LEASE", config.Lease)
+	for _, currency := range strings.Split(os.Getenv("PROVIDER_CURRENCIES"), ",") {
+		if currency = strings.TrimSpace(currency); currency != "" {
+			config.Currencies = append(config.Currencies, strings.ToTitle(currency))
+		}
+	}
+
+	// rates are stored through the cache so it drops what they change
+	scheduler := provider.NewScheduler(p, db, config)
+	scheduler.Reconciler = reconciler
+	// replicas share the daily fetch, only the one that claims a day fetches it
+	if runs, ok := unwrapCache(db).(database.ProviderRunStore); ok {
+		scheduler.Runs = runs
+	}
+
+	return scheduler
+}
+
+// envTimeOfDay - parses a time of day like 16:30 from the env var, falls back to def when unset or invalid
+func envTimeOfDay(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		log.Printf("invalid %s: %s", key, err)
+		return def
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
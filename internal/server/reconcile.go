@@ -0,0 +1,113 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/shopspring/decimal"
+)
+
+// newReconciler - reconciler of the source values kept by db, nil when the backend can't keep them. RECONCILE_POLICY,
+// RECONCILE_PRIORITY and RECONCILE_TOLERANCE configure it
+func newReconciler(db database.DatabaseRepo) *reconcile.Reconciler {
+	sources, ok := unwrapCache(db).(database.SourceStore)
+	if !ok {
+		return nil
+	}
+
+	config := reconcile.DefaultConfig
+	switch policy := os.Getenv("RECONCILE_POLICY"); policy {
+	case "":
+	case reconcile.PolicyPriority, reconcile.PolicyMedian, reconcile.PolicyReject:
+		config.Policy = policy
+	default:
+		log.Printf("invalid RECONCILE_POLICY: %q", policy)
+	}
+	if priority := os.Getenv("RECONCILE_PRIORITY"); priority != "" {
+		config.Priority = nil
+		for _, source := range strings.Split(priority, ",") {
+			config.Priority = append(config.Priority, strings.TrimSpace(source))
+		}
+	}
+	if tolerance := os.Getenv("RECONCILE_TOLERANCE"); tolerance != "" {
+		if d, err := decimal.NewFromString(tolerance); err == nil && !d.IsNegative() {
+			config.Tolerance = d
+		} else {
+			log.Printf("invalid RECONCILE_TOLERANCE: %q", tolerance)
+		}
+	}
+
+	// rates are published through the cache so it drops what they change
+	return reconcile.NewReconciler(sources, db, config)
+}
+
+// reconciles - whether a rate written through the api is submitted as the value of the api source instead of being
+// stored as it is, sources are reconciled into the published mid rate only
+func (h *Handler) reconciles(rate models.CurrencyRate) bool {
+	return h.Reconciler != nil && models.RateType(rate.Type) == models.RateMid
+}
+
+// ReconciliationReport - currencies and dates between from and to whose sources disagree or whose published rate
+// isn't the one the policy gives
+func (h *Handler) ReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	if h.Reconciler == nil {
+		response(w, r, http.StatusNotFound, "Reconciliation is not supported by this database", nil, nil)
+		return
+	}
+
+	query := r.URL.Query()
+	v := validator.Reconciliation(query.Get("currencies"), query.Get("from"), query.Get("to"))
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	fromDate, _ := time.Parse("2006-01-02", v.Get("from"))
+	toDate, _ := time.Parse("2006-01-02", v.Get("to"))
+	disagreements, err := h.Reconciler.Report(r.Context(), parseCurrencies(v.Get("currencies")), fromDate, toDate)
+	if err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+
+	data := make(objects.DisagreementResponses, len(disagreements))
+	for i, disagreement := range disagreements {
+		data[i] = disagreementResponse(disagreement)
+	}
+	response(w, r, http.StatusOK, "Reconciliation report, policy "+h.Reconciler.Config.Policy, data, nil)
+}
+
+func disagreementResponse(disagreement reconcile.Disagreement) objects.DisagreementResponse {
+	data := objects.DisagreementResponse{
+		Date:          disagreement.Date.Format("2006-01-02"),
+		BaseCurrency:  database.BaseCurrency,
+		QuoteCurrency: disagreement.QuoteCurrency,
+		Spread:        disagreement.Decision.Spread.String(),
+		Rejected:      disagreement.Decision.Rejected,
+		Sources:       make([]objects.SourceRateResponse, len(disagreement.Values)),
+	}
+	if disagreement.Published != nil {
+		data.Published = disagreement.Published.String()
+	}
+	if !disagreement.Decision.Rejected {
+		data.Reconciled = disagreement.Decision.Rate.String()
+		data.Source = disagreement.Decision.Source
+	}
+	for i, value := range disagreement.Values {
+		data.Sources[i] = objects.SourceRateResponse{
+			Source:    value.Source,
+			Rate:      value.Rate.String(),
+			UpdatedAt: value.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/retention"
+)
+
+// newRetention - job deleting the events and outbox messages every reader is done with, nil when the backend
+// keeps none
+func newRetention(db database.DatabaseRepo) *retention.Job {
+	store, ok := unwrapCache(db).(database.Pruner)
+	if !ok {
+		return nil
+	}
+
+	return retention.NewJob(
+		store,
+		envPositiveDuration("RETENTION_AGE", retention.DefaultAge),
+		envPositiveDuration("RETENTION_INTERVAL", retention.DefaultInterval),
+	)
+}
@@ -1,11 +1,38 @@
 package server
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/Shambou/golang-challenge/internal/gql"
+)
 
 // MapRoutes - maps the routes to the handlers
 func (h *Handler) MapRoutes() {
 	h.Router.HandleFunc("/ready", h.ReadyCheck).Methods(http.MethodGet)
-	apiRouter := h.Router.Methods(http.MethodPost, http.MethodGet).PathPrefix("/api/v1/rates").Subrouter()
+	h.Router.Handle("/graphql", gql.NewHandler(h.DB)).Methods(http.MethodPost)
+	h.Router.Handle("/cache/stats", NegotiateMiddleware(http.HandlerFunc(h.CacheStats))).Methods(http.MethodGet)
+	// export and stream have their own content types, their errors stay json
+	h.Router.HandleFunc("/api/v1/rates/export", h.ExportRates).Methods(http.MethodGet)
+	h.Router.HandleFunc("/api/v1/rates/stream", h.StreamRates).Methods(http.MethodGet)
+	h.Router.HandleFunc("/api/v1/rates/ws", h.RatesWebSocket).Methods(http.MethodGet)
+	webhookRouter := h.Router.PathPrefix("/api/v1/webhooks").Subrouter()
+	webhookRouter.HandleFunc("", h.CreateWebhook).Methods(http.MethodPost)
+	webhookRouter.HandleFunc("", h.ListWebhooks).Methods(http.MethodGet)
+	webhookRouter.HandleFunc("/{id}", h.GetWebhook).Methods(http.MethodGet)
+	webhookRouter.HandleFunc("/{id}", h.DeleteWebhook).Methods(http.MethodDelete)
+	webhookRouter.HandleFunc("/{id}/deliveries", h.ListDeliveries).Methods(http.MethodGet)
+	webhookRouter.HandleFunc("/{id}/deliveries/{delivery}/redeliver", h.RedeliverDelivery).Methods(http.MethodPost)
+	webhookRouter.Use(NegotiateMiddleware)
+
+	alertRouter := h.Router.PathPrefix("/api/v1/alerts").Subrouter()
+	alertRouter.HandleFunc("", h.CreateAlertRule).Methods(http.MethodPost)
+	alertRouter.HandleFunc("", h.ListAlertRules).Methods(http.MethodGet)
+	alertRouter.HandleFunc("/{id}", h.GetAlertRule).Methods(http.MethodGet)
+	alertRouter.HandleFunc("/{id}", h.DeleteAlertRule).Methods(http.MethodDelete)
+	alertRouter.Use(NegotiateMiddleware)
+	h.Router.Handle("/api/v1/reconciliation", NegotiateMiddleware(http.HandlerFunc(h.ReconciliationReport))).Methods(http.MethodGet)
+
+	apiRouter := h.Router.Methods(http.MethodPost, http.MethodGet, http.MethodPut, http.MethodDelete).PathPrefix("/api/v1/rates").Subrouter()
 	apiRouter.HandleFunc("/latest", h.GetLatestRate).Queries("quote_currency", "{quote_currency}").Methods(http.MethodGet)
 	apiRouter.HandleFunc("/timeseries", h.GetTimeseriesData).Queries("date", "{date}").Methods(http.MethodGet)
 	apiRouter.HandleFunc("/range", h.GetRatesInRange).
@@ -15,10 +42,19 @@ func (h *Handler) MapRoutes() {
 			"to", "{to}",
 		).
 		Methods(http.MethodGet)
+	apiRouter.HandleFunc("/spread", h.GetSpreads).
+		Queries(
+			"quote_currency", "{quote_currency}",
+			"from", "{from}",
+			"to", "{to}",
+		).
+		Methods(http.MethodGet)
 
 	apiRouter.HandleFunc("/{currency}", h.StoreRate).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/{currency}", h.UpdateRate).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/{currency}/{date}", h.DeleteRate).Methods(http.MethodDelete)
 
 	apiRouter.HandleFunc("/file/latest", h.GetLatestFileRate).Queries("quote_currency", "{quote_currency}").Methods(http.MethodGet)
 
-	apiRouter.Use(JSONMiddleware)
+	apiRouter.Use(NegotiateMiddleware)
 }
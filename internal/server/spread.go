@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// GetSpreads - bid-ask spread of a currency on every date between two dates that has both a bid and an ask
+func (h *Handler) GetSpreads(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	v := validator.RatesInRange(vars["quote_currency"], vars["from"], vars["to"])
+
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	fromDate, _ := time.Parse("2006-01-02", v.Get("from"))
+	toDate, _ := time.Parse("2006-01-02", v.Get("to"))
+	quoteCurrency := strings.ToTitle(v.Get("quote_currency"))
+
+	bids, err := database.GetRatesInRangeOfType(r.Context(), h.DB, quoteCurrency, fromDate, toDate, models.RateBid)
+	if err != nil {
+		response(w, r, readStatus(err), err.Error(), nil, nil)
+		return
+	}
+	asks, err := database.GetRatesInRangeOfType(r.Context(), h.DB, quoteCurrency, fromDate, toDate, models.RateAsk)
+	if err != nil {
+		response(w, r, readStatus(err), err.Error(), nil, nil)
+		return
+	}
+
+	data := spreads(bids, asks)
+	data.BaseCurrency = database.BaseCurrency
+	data.QuoteCurrency = quoteCurrency
+
+	message := fmt.Sprintf(
+		"Spreads %s%s in range %s:%s",
+		data.QuoteCurrency,
+		data.BaseCurrency,
+		fromDate.Format("2006-01-02"),
+		toDate.Format("2006-01-02"),
+	)
+
+	response(w, r, http.StatusOK, message, data, nil)
+}
+
+// spreads - pairs bids and asks sorted by date, dates missing either side are skipped. The percentage is of the
+// mid between bid and ask, not of a stored mid rate, so it doesn't depend on when the mid was fixed
+func spreads(bids []models.CurrencyRate, asks []models.CurrencyRate) objects.SpreadResponse {
+	data := objects.SpreadResponse{Spreads: []objects.JsonSpreadResponse{}}
+	total := decimal.Zero
+
+	for i, j := 0, 0; i < len(bids) && j < len(asks); {
+		bid, ask := bids[i], asks[j]
+		if bid.Date.Before(ask.Date) {
+			i++
+			continue
+		}
+		if ask.Date.Before(bid.Date) {
+			j++
+			continue
+		}
+		i++
+		j++
+
+		spread := ask.Rate.Sub(bid.Rate)
+		percent := spread.Div(bid.Rate.Add(ask.Rate).Div(decimal.NewFromInt(2))).Mul(hundred).Round(4)
+		total = total.Add(percent)
+
+		data.Spreads = append(data.Spreads, objects.JsonSpreadResponse{
+			Date:          bid.Date.Format("2006-01-02"),
+			Bid:           bid.Rate.String(),
+			Ask:           ask.Rate.String(),
+			Spread:        spread.String(),
+			SpreadPercent: percent.StringFixed(4),
+		})
+	}
+
+	if len(data.Spreads) > 0 {
+		data.Average = total.Div(decimal.NewFromInt(int64(len(data.Spreads)))).StringFixed(4)
+	}
+
+	return data
+}
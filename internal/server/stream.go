@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/validator"
+)
+
+// HeartbeatInterval - how often an idle stream sends a comment so proxies don't close it
+const HeartbeatInterval = 15 * time.Second
+
+// StreamRates - pushes every newly stored rate as a server-sent event, a client that reconnects with
+// Last-Event-ID first gets the events it missed
+func (h *Handler) StreamRates(w http.ResponseWriter, r *http.Request) {
+	if h.Events == nil {
+		response(w, r, http.StatusNotFound, "Rate events are not supported by this database", nil, nil)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	v := validator.New(map[string]string{"currencies": r.URL.Query().Get("currencies"), "last_event_id": lastEventID})
+	v.Currencies("currencies")
+	lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+	if lastEventID != "" && (err != nil || lastID < 0) {
+		v.Errors.Add("last_event_id", fmt.Sprintf("%s is not a valid event id", lastEventID))
+	}
+
+	if !v.Valid() {
+		fmt.Println(v.Errors)
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		response(w, r, http.StatusInternalServerError, "Streaming is not supported", nil, nil)
+		return
+	}
+
+	currencies := parseCurrencies(v.Get("currencies"))
+	// subscribe before reading the missed events so nothing stored in between is lost
+	sub := h.Events.Subscribe(currencies)
+	if sub == nil {
+		response(w, r, http.StatusServiceUnavailable, "Server is shutting down", nil, nil)
+		return
+	}
+	defer sub.Close()
+
+	clearWriteDeadline(r)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if lastEventID == "" {
+		lastID = sub.Start
+	} else if lastID, err = h.replayEvents(w, r, lastID, currencies); err != nil {
+		log.Println("could not replay rate events: ", err)
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// dropped for falling behind or shutting down, the client reconnects with its last event id
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// replayEvents - writes the events after lastID from the store, returns the id of the last one written
+func (h *Handler) replayEvents(w http.ResponseWriter, r *http.Request, lastID int64, currencies []string) (int64, error) {
+	for {
+		missed, err := h.Events.Store.EventsSince(r.Context(), lastID, currencies, events.BatchSize)
+		if err != nil {
+			return lastID, err
+		}
+		for _, event := range missed {
+			if err := writeEvent(w, event); err != nil {
+				return lastID, err
+			}
+			lastID = event.ID
+		}
+		if len(missed) < events.BatchSize {
+			return lastID, nil
+		}
+	}
+}
+
+// writeEvent - writes event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event models.RateEvent) error {
+	data, err := json.Marshal(objects.NewRateEventResponse(event))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+
+	return err
+}
+
+// parseCurrencies - upper cased codes of a comma separated list, nil for an empty list
+func parseCurrencies(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	var currencies []string
+	for _, currency := range strings.Split(list, ",") {
+		currencies = append(currencies, strings.ToTitle(strings.TrimSpace(currency)))
+	}
+
+	return currencies
+}
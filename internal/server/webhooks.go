@@ -0,0 +1,262 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/validator"
+	"github.com/Shambou/golang-challenge/internal/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// DeliveriesLimit - newest deliveries listed per webhook
+const DeliveriesLimit = 100
+
+// newDispatcher - webhook dispatcher over db, nil when the backend can't keep webhooks
+func newDispatcher(db database.DatabaseRepo, broker *events.Broker) *webhooks.Dispatcher {
+	store, ok := unwrapCache(db).(database.WebhookStore)
+	if !ok {
+		return nil
+	}
+
+	return webhooks.NewDispatcher(store, broker, webhooks.Config{
+		PollInterval:   envDuration("WEBHOOK_POLL_INTERVAL", webhooks.DefaultConfig.PollInterval),
+		Timeout:        envDuration("WEBHOOK_TIMEOUT", webhooks.DefaultConfig.Timeout),
+		InitialBackoff: envDuration("WEBHOOK_INITIAL_BACKOFF", webhooks.DefaultConfig.InitialBackoff),
+		MaxBackoff:     envDuration("WEBHOOK_MAX_BACKOFF", webhooks.DefaultConfig.MaxBackoff),
+		MaxAttempts:    envInt("WEBHOOK_MAX_ATTEMPTS", webhooks.DefaultConfig.MaxAttempts),
+		Workers:        envInt("WEBHOOK_WORKERS", webhooks.DefaultConfig.Workers),
+	})
+}
+
+// CreateWebhook - registers an endpoint for the rate events of some currencies, the response has the signing
+// secret, it isn't shown again
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.Webhooks == nil {
+		response(w, r, http.StatusNotFound, "Webhooks are not supported by this database", nil, nil)
+		return
+	}
+
+	var req objects.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response(w, r, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+
+	v := validator.Webhook(req.URL, strings.Join(req.Currencies, ","))
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	webhook := models.Webhook{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		Currencies: parseCurrencies(v.Get("currencies")),
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			response(w, r, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	if err := h.Webhooks.Store.CreateWebhook(r.Context(), &webhook); err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+
+	data := webhookResponse(webhook)
+	data.Secret = webhook.Secret
+	response(w, r, http.StatusCreated, "Registered webhook", data, nil)
+}
+
+// ListWebhooks - every registered webhook
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if h.Webhooks == nil {
+		response(w, r, http.StatusNotFound, "Webhooks are not supported by this database", nil, nil)
+		return
+	}
+
+	list, err := h.Webhooks.Store.Webhooks(r.Context())
+	if err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+
+	data := make([]objects.WebhookResponse, len(list))
+	for i, webhook := range list {
+		data[i] = webhookResponse(webhook)
+	}
+	response(w, r, http.StatusOK, "Webhooks", data, nil)
+}
+
+// GetWebhook - a registered webhook
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	response(w, r, http.StatusOK, "Webhook", webhookResponse(webhook), nil)
+}
+
+// DeleteWebhook - removes a webhook and its queued deliveries
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Webhooks.Store.DeleteWebhook(r.Context(), webhook.ID); err != nil {
+		response(w, r, webhookErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+
+	response(w, r, http.StatusOK, "Deleted webhook", nil, nil)
+}
+
+// ListDeliveries - newest deliveries of a webhook, status=dead lists its dead letters
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New(map[string]string{"status": r.URL.Query().Get("status")})
+	v.In("status", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead)
+	if !v.Valid() {
+		response(w, r, http.StatusBadRequest, "Invalid request", nil, v.Errors)
+		return
+	}
+
+	deliveries, err := h.Webhooks.Store.Deliveries(r.Context(), webhook.ID, v.Get("status"), DeliveriesLimit)
+	if err != nil {
+		response(w, r, errorStatus(err, http.StatusInternalServerError), err.Error(), nil, nil)
+		return
+	}
+
+	data := make([]objects.WebhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		data[i] = deliveryResponse(delivery)
+	}
+	response(w, r, http.StatusOK, "Webhook deliveries", data, nil)
+}
+
+// RedeliverDelivery - queues a delivery again with fresh attempts, usually one from the dead letters
+func (h *Handler) RedeliverDelivery(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["delivery"], 10, 64)
+	if err != nil {
+		response(w, r, http.StatusNotFound, database.ErrDeliveryNotFound.Error(), nil, nil)
+		return
+	}
+	delivery, err := h.Webhooks.Store.GetDelivery(r.Context(), id)
+	if err == nil && delivery.WebhookID != webhook.ID {
+		err = database.ErrDeliveryNotFound
+	}
+	if err != nil {
+		response(w, r, webhookErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+
+	// a pending delivery that isn't due is being sent or waits for its next attempt, resetting it would be
+	// overwritten by the outcome of that attempt
+	now := time.Now()
+	requeued, err := h.Webhooks.Store.RequeueDelivery(r.Context(), id, now)
+	if err != nil {
+		response(w, r, webhookErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	if !requeued {
+		response(w, r, http.StatusConflict, "Delivery is pending, it can be queued again once its attempt is over", deliveryResponse(delivery), nil)
+		return
+	}
+	h.Webhooks.Notify()
+
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.LastError = ""
+	delivery.DeliveredAt = nil
+
+	response(w, r, http.StatusAccepted, "Queued delivery again", deliveryResponse(delivery), nil)
+}
+
+// webhook - the webhook of the id route variable, answers the request itself when there is none
+func (h *Handler) webhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	if h.Webhooks == nil {
+		response(w, r, http.StatusNotFound, "Webhooks are not supported by this database", nil, nil)
+		return models.Webhook{}, false
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		response(w, r, http.StatusNotFound, database.ErrWebhookNotFound.Error(), nil, nil)
+		return models.Webhook{}, false
+	}
+
+	webhook, err := h.Webhooks.Store.GetWebhook(r.Context(), id)
+	if err != nil {
+		response(w, r, webhookErrorStatus(err), err.Error(), nil, nil)
+		return models.Webhook{}, false
+	}
+
+	return webhook, true
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, database.ErrWebhookNotFound) || errors.Is(err, database.ErrDeliveryNotFound) {
+		return http.StatusNotFound
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
+
+func webhookResponse(webhook models.Webhook) objects.WebhookResponse {
+	currencies := webhook.Currencies
+	if currencies == nil {
+		currencies = []string{}
+	}
+
+	return objects.WebhookResponse{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		Currencies: currencies,
+		CreatedAt:  webhook.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func deliveryResponse(delivery models.WebhookDelivery) objects.WebhookDeliveryResponse {
+	data := objects.WebhookDeliveryResponse{
+		ID:            delivery.ID,
+		WebhookID:     delivery.WebhookID,
+		Event:         objects.NewRateEventResponse(delivery.Event),
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt.UTC().Format(time.RFC3339),
+		LastError:     delivery.LastError,
+		CreatedAt:     delivery.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if delivery.DeliveredAt != nil {
+		data.DeliveredAt = delivery.DeliveredAt.UTC().Format(time.RFC3339)
+	}
+
+	return data
+}
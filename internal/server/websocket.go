@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketConfig - limits of a rates websocket connection
+type WebSocketConfig struct {
+	// MaxSubscriptions - currency pairs a connection can be subscribed to at once
+	MaxSubscriptions int
+	// PingInterval - how often the server pings, a connection that doesn't answer within two intervals is closed
+	PingInterval time.Duration
+	// WriteTimeout - how long a single frame may take to send
+	WriteTimeout time.Duration
+}
+
+// DefaultWebSocketConfig - used when WS_MAX_SUBSCRIPTIONS, WS_PING_INTERVAL and WS_WRITE_TIMEOUT are not set
+var DefaultWebSocketConfig = WebSocketConfig{
+	MaxSubscriptions: 50,
+	PingInterval:     30 * time.Second,
+	WriteTimeout:     10 * time.Second,
+}
+
+// wsMaxMessageSize - requests are small json objects, anything bigger closes the connection
+const wsMaxMessageSize = 4096
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsRequest - a frame sent by the client
+//
+//	{"action": "subscribe", "pairs": ["CHFUSD", "JPY"]}
+type wsRequest struct {
+	Action string   `json:"action"`
+	Pairs  []string `json:"pairs"`
+}
+
+// wsMessage - a frame sent by the server, type is subscribed, unsubscribed, rate or error
+type wsMessage struct {
+	Type    string      `json:"type"`
+	Pairs   []string    `json:"pairs,omitempty"`
+	Rate    interface{} `json:"rate,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// webSocketConfig - limits from the WS_ env vars, durations that aren't positive keep their defaults
+func webSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		MaxSubscriptions: envInt("WS_MAX_SUBSCRIPTIONS", DefaultWebSocketConfig.MaxSubscriptions),
+		PingInterval:     envPositiveDuration("WS_PING_INTERVAL", DefaultWebSocketConfig.PingInterval),
+		WriteTimeout:     envPositiveDuration("WS_WRITE_TIMEOUT", DefaultWebSocketConfig.WriteTimeout),
+	}
+}
+
+// RatesWebSocket - lets a client subscribe to and unsubscribe from currency pairs and pushes their newly stored
+// rates, connections that can't keep up with the rates are closed
+func (h *Handler) RatesWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.Events == nil {
+		response(w, r, http.StatusNotFound, "Rate events are not supported by this database", nil, nil)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has answered already
+		log.Println("websocket upgrade failed: ", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := h.Events.Subscribe(nil)
+	if sub == nil {
+		closeWebSocket(conn, h.WebSocket, websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	defer sub.Close()
+	// only the subscribed pairs count towards the broker's buffer, so rates the client didn't ask for can't make it slow
+	sub.SetCurrencies(nil)
+
+	requests := make(chan wsRequest)
+	done := make(chan struct{})
+	defer close(done)
+	go readWebSocket(conn, h.WebSocket, requests, done)
+
+	ping := time.NewTicker(h.WebSocket.PingInterval)
+	defer ping.Stop()
+
+	subscribed := make(map[string]bool)
+	for {
+		var err error
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			err = writeWebSocket(conn, h.WebSocket, handleWebSocketRequest(req, subscribed, h.WebSocket.MaxSubscriptions))
+			sub.SetCurrencies(subscribedCurrencies(subscribed))
+		case event, ok := <-sub.Events():
+			if !ok && sub.Slow() {
+				closeWebSocket(conn, h.WebSocket, websocket.ClosePolicyViolation, "too slow to keep up with rates")
+				return
+			}
+			if !ok {
+				closeWebSocket(conn, h.WebSocket, websocket.CloseGoingAway, "server is shutting down")
+				return
+			}
+			if subscribed[event.QuoteCurrency] {
+				err = writeWebSocket(conn, h.WebSocket, wsMessage{Type: "rate", Rate: objects.NewRateEventResponse(event)})
+			}
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.WebSocket.WriteTimeout))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readWebSocket - passes the client's requests on until the connection fails or done is closed, then closes requests
+func readWebSocket(conn *websocket.Conn, config WebSocketConfig, requests chan<- wsRequest, done <-chan struct{}) {
+	defer close(requests)
+
+	pongWait := 2 * config.PingInterval
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			req = wsRequest{Action: "invalid"}
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleWebSocketRequest - applies a subscribe or unsubscribe request to subscribed and returns the reply
+func handleWebSocketRequest(req wsRequest, subscribed map[string]bool, maxSubscriptions int) wsMessage {
+	if req.Action != "subscribe" && req.Action != "unsubscribe" {
+		return wsMessage{Type: "error", Message: "action must be subscribe or unsubscribe"}
+	}
+
+	currencies := make([]string, 0, len(req.Pairs))
+	for _, pair := range req.Pairs {
+		currency, ok := pairCurrency(pair)
+		if !ok {
+			return wsMessage{Type: "error", Message: fmt.Sprintf("%s is not a valid currency pair", pair)}
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if req.Action == "unsubscribe" {
+		for _, currency := range currencies {
+			delete(subscribed, currency)
+		}
+		return wsMessage{Type: "unsubscribed", Pairs: pairs(subscribed)}
+	}
+
+	added := 0
+	for _, currency := range currencies {
+		if !subscribed[currency] {
+			added++
+		}
+	}
+	if len(subscribed)+added > maxSubscriptions {
+		return wsMessage{Type: "error", Message: fmt.Sprintf("a connection can subscribe to at most %d pairs", maxSubscriptions)}
+	}
+	for _, currency := range currencies {
+		subscribed[currency] = true
+	}
+
+	return wsMessage{Type: "subscribed", Pairs: pairs(subscribed)}
+}
+
+// pairCurrency - quote currency of "CHFUSD" or "CHF", pairs have to be against the base currency
+func pairCurrency(pair string) (string, bool) {
+	pair = strings.ToTitle(strings.TrimSpace(pair))
+	if len(pair) == 6 && strings.HasSuffix(pair, database.BaseCurrency) {
+		pair = pair[:3]
+	}
+
+	return pair, len(pair) == 3 && pair != database.BaseCurrency
+}
+
+// subscribedCurrencies - subscribed quote currencies
+func subscribedCurrencies(subscribed map[string]bool) []string {
+	list := make([]string, 0, len(subscribed))
+	for currency := range subscribed {
+		list = append(list, currency)
+	}
+
+	return list
+}
+
+// pairs - subscribed pairs in alphabetical order
+func pairs(subscribed map[string]bool) []string {
+	list := make([]string, 0, len(subscribed))
+	for currency := range subscribed {
+		list = append(list, currency+database.BaseCurrency)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func writeWebSocket(conn *websocket.Conn, config WebSocketConfig, message wsMessage) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+
+	return conn.WriteJSON(message)
+}
+
+func closeWebSocket(conn *websocket.Conn, config WebSocketConfig, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(config.WriteTimeout))
+}
@@ -1,5 +1,10 @@
 package validator
 
+import (
+	"encoding/xml"
+	"sort"
+)
+
 type errors map[string][]string
 
 // Add adds an error message for a given field
@@ -15,3 +20,47 @@ func (e errors) Get(field string) string {
 	}
 	return es[0]
 }
+
+// fields returns the fields with errors in alphabetical order
+func (e errors) fields() []string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// Table returns a csv row per error message
+func (e errors) Table() ([]string, [][]string) {
+	var rows [][]string
+	for _, field := range e.fields() {
+		for _, message := range e[field] {
+			rows = append(rows, []string{field, message})
+		}
+	}
+
+	return []string{"field", "error"}, rows
+}
+
+// MarshalXML writes an error element per message, xml has no maps
+func (e errors) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, field := range e.fields() {
+		for _, message := range e[field] {
+			element := xml.StartElement{
+				Name: xml.Name{Local: "error"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "field"}, Value: field}},
+			}
+			if err := enc.EncodeElement(message, element); err != nil {
+				return err
+			}
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
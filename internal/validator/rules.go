@@ -0,0 +1,122 @@
+package validator
+
+import (
+	"github.com/Shambou/golang-challenge/internal/alerts"
+	"github.com/Shambou/golang-challenge/internal/models"
+)
+
+// The rules of each rates operation, shared by the REST and gRPC APIs so both reject the same requests
+
+// LatestRate - validates a latest rate lookup
+func LatestRate(quoteCurrency string) *Validator {
+	v := New(map[string]string{"quote_currency": quoteCurrency})
+	v.Length("quote_currency", 3)
+
+	return v
+}
+
+// RatesInRange - validates a range lookup
+func RatesInRange(quoteCurrency string, from string, to string) *Validator {
+	v := New(map[string]string{"quote_currency": quoteCurrency, "from": from, "to": to})
+	v.Length("quote_currency", 3)
+	v.Date("from", "to")
+
+	return v
+}
+
+// Timeseries - validates a lookup of every rate on a date
+func Timeseries(date string) *Validator {
+	v := New(map[string]string{"date": date})
+	v.Date("date")
+
+	return v
+}
+
+// StoreRate - validates a new rate, rates can't be stored for baseCurrency itself
+func StoreRate(currency string, date string, rate string, baseCurrency string) *Validator {
+	v := New(map[string]string{"currency": currency, "date": date, "rate": rate})
+	v.Date("date")
+	v.DateInFuture("date")
+	v.NotEqual("currency", baseCurrency)
+	v.ValidRate("rate")
+
+	return v
+}
+
+// DeleteRate - validates removing the rate of a currency on a date
+func DeleteRate(currency string, date string) *Validator {
+	v := New(map[string]string{"currency": currency, "date": date})
+	v.Length("currency", 3)
+	v.Date("date")
+
+	return v
+}
+
+// RateType - also validates the rate type an operation reads or writes, empty means a mid rate
+func (v *Validator) RateType(rateType string) *Validator {
+	v.Data["type"] = rateType
+	v.In("type", models.RateTypes...)
+
+	return v
+}
+
+// Webhook - validates a webhook registration, currencies is a comma separated list
+func Webhook(url string, currencies string) *Validator {
+	v := New(map[string]string{"url": url, "currencies": currencies})
+	v.URL("url")
+	v.Currencies("currencies")
+
+	return v
+}
+
+// AlertRule - validates a new alert rule, notifiers are the names of the notifiers that are set up
+func AlertRule(ruleType string, currency string, condition string, value string, notifier string, target string, notifiers []string, baseCurrency string) *Validator {
+	v := New(map[string]string{
+		"type":      ruleType,
+		"currency":  currency,
+		"condition": condition,
+		"value":     value,
+		"notifier":  notifier,
+		"target":    target,
+	})
+	v.Required("type", "notifier")
+	v.In("type", models.AlertThreshold, models.AlertMove, models.AlertStale)
+	v.Length("currency", 3)
+	v.NotEqual("currency", baseCurrency)
+	v.In("notifier", notifiers...)
+
+	switch ruleType {
+	case models.AlertThreshold:
+		v.Required("condition")
+		v.In("condition", models.AlertAbove, models.AlertBelow)
+		v.ValidRate("value")
+	case models.AlertMove:
+		v.ValidRate("value")
+	case models.AlertStale:
+		v.Integer("value", 1)
+	}
+	if notifier == alerts.NotifierWebhook {
+		v.URL("target")
+	}
+
+	return v
+}
+
+// Conversion - validates converting an amount between two currencies
+func Conversion(amount string, from string, to string) *Validator {
+	v := New(map[string]string{"amount": amount, "from": from, "to": to})
+	v.ValidRate("amount")
+	v.Length("from", 3)
+	v.Length("to", 3)
+
+	return v
+}
+
+// Reconciliation - validates a reconciliation report lookup, currencies is a comma separated list
+func Reconciliation(currencies string, from string, to string) *Validator {
+	v := New(map[string]string{"currencies": currencies, "from": from, "to": to})
+	v.Currencies("currencies")
+	v.Date("from", "to")
+
+	return v
+}
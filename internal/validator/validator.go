@@ -2,6 +2,8 @@ package validator
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,21 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
+// Err - nil when valid, otherwise an error listing every failed rule for APIs that report errors as text
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+
+	_, rows := v.Errors.Table()
+	messages := make([]string, len(rows))
+	for i, row := range rows {
+		messages[i] = fmt.Sprintf("%s: %s", row[0], row[1])
+	}
+
+	return fmt.Errorf("invalid request: %s", strings.Join(messages, "; "))
+}
+
 // New - initializes a validator struct
 func New(data map[string]string) *Validator {
 	return &Validator{
@@ -59,11 +76,7 @@ func (v *Validator) DateInFuture(fields ...string) {
 // ValidRate - checks if field value is valid decimal first then checks if it's less than or equal to zero
 func (v *Validator) ValidRate(field string) {
 	value, err := decimal.NewFromString(v.Get(field))
-	if err != nil {
-		v.Errors.Add(field, "The %s is invalid")
-	}
-
-	if value.LessThanOrEqual(decimal.Zero) {
+	if err != nil || value.LessThanOrEqual(decimal.Zero) {
 		v.Errors.Add(field, fmt.Sprintf("The %s is invalid", field))
 	}
 }
@@ -77,6 +90,61 @@ func (v *Validator) NotEqual(field string, comparisonValue string) {
 	}
 }
 
+// In - checks if field value is one of values, empty values are allowed so a default can be applied
+func (v *Validator) In(field string, values ...string) {
+	value := v.Get(field)
+	if value == "" {
+		return
+	}
+
+	for _, allowed := range values {
+		if value == allowed {
+			return
+		}
+	}
+
+	v.Errors.Add(field, fmt.Sprintf("The %s must be one of %s", field, strings.Join(values, ", ")))
+}
+
+// Currencies - checks if field is a comma separated list of 3 character currency codes
+func (v *Validator) Currencies(field string) {
+	value := v.Get(field)
+	if value == "" {
+		return
+	}
+
+	for _, currency := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(currency)) != 3 {
+			v.Errors.Add(field, fmt.Sprintf("%s is not a valid currency", currency))
+		}
+	}
+}
+
+// Integer - checks if field is a whole number of at least min
+func (v *Validator) Integer(field string, min int) {
+	value, err := strconv.Atoi(v.Get(field))
+	if err != nil || value < min {
+		v.Errors.Add(field, fmt.Sprintf("The %s must be a whole number of at least %d", field, min))
+	}
+}
+
+// Required - checks if fields are not empty
+func (v *Validator) Required(fields ...string) {
+	for _, field := range fields {
+		if strings.TrimSpace(v.Get(field)) == "" {
+			v.Errors.Add(field, fmt.Sprintf("The %s is required", field))
+		}
+	}
+}
+
+// URL - checks if field is an absolute http or https url
+func (v *Validator) URL(field string) {
+	value, err := url.Parse(v.Get(field))
+	if err != nil || (value.Scheme != "http" && value.Scheme != "https") || value.Host == "" {
+		v.Errors.Add(field, fmt.Sprintf("The %s must be an http or https url", field))
+	}
+}
+
 func (v *Validator) Get(key string) string {
 	vs := v.Data[key]
 	if len(vs) == 0 {
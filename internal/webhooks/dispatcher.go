@@ -0,0 +1,304 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Rates-Event"
+	HeaderDelivery  = "X-Rates-Delivery"
+	HeaderTimestamp = "X-Rates-Timestamp"
+	HeaderSignature = "X-Rates-Signature"
+)
+
+// Config - how deliveries are sent and retried
+type Config struct {
+	// PollInterval - how often due retries are looked for when no new events come in
+	PollInterval time.Duration
+	// Timeout - how long an endpoint has to answer
+	Timeout time.Duration
+	// InitialBackoff - wait after the first failed attempt, doubled after each one
+	InitialBackoff time.Duration
+	// MaxBackoff - upper bound of the wait between attempts
+	MaxBackoff time.Duration
+	// MaxAttempts - attempts before a delivery is moved to the dead letters
+	MaxAttempts int
+	// Workers - deliveries sent at the same time
+	Workers int
+}
+
+// DefaultConfig - used when the WEBHOOK_* env vars are not set
+var DefaultConfig = Config{
+	PollInterval:   5 * time.Second,
+	Timeout:        10 * time.Second,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     time.Hour,
+	MaxAttempts:    10,
+	Workers:        4,
+}
+
+// BatchSize - events turned into deliveries, and deliveries claimed, at once
+const BatchSize = 500
+
+// Dispatcher - turns rate events into deliveries of the webhooks that want them and sends them. Deliveries are
+// kept in the store, so they survive restarts and every process of the API can send them
+type Dispatcher struct {
+	Store  database.WebhookStore
+	Events *events.Broker
+	Client *http.Client
+	Config Config
+
+	wake chan struct{}
+}
+
+// NewDispatcher - returns a dispatcher over store, broker wakes it up on new events and may be nil
+func NewDispatcher(store database.WebhookStore, broker *events.Broker, config Config) *Dispatcher {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+
+	return &Dispatcher{
+		Store:  store,
+		Events: broker,
+		Client: &http.Client{Timeout: config.Timeout},
+		Config: config,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Run - enqueues and sends deliveries until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+
+	sub := d.subscribe()
+	for {
+		if err := d.enqueue(ctx); err != nil && ctx.Err() == nil {
+			log.Println("could not enqueue webhook deliveries: ", err)
+		}
+		if err := d.deliver(ctx); err != nil && ctx.Err() == nil {
+			log.Println("could not send webhook deliveries: ", err)
+		}
+
+		var events <-chan models.RateEvent
+		if sub != nil {
+			events = sub.Events()
+		}
+		select {
+		case <-ctx.Done():
+			if sub != nil {
+				sub.Close()
+			}
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		case _, ok := <-events:
+			// events are only a wake up call, they are read from the store again so none get lost
+			if !ok {
+				sub = d.subscribe()
+			}
+		}
+	}
+}
+
+// Notify - tells the dispatcher there may be deliveries to send, safe to call on a nil dispatcher
+func (d *Dispatcher) Notify() {
+	if d == nil {
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) subscribe() *events.Subscription {
+	if d.Events == nil {
+		return nil
+	}
+
+	return d.Events.Subscribe(nil)
+}
+
+// enqueue - creates the deliveries of events after the cursor
+func (d *Dispatcher) enqueue(ctx context.Context) error {
+	for {
+		cursor, ok, err := d.Store.WebhookCursor(ctx)
+		if err != nil || !ok {
+			return err
+		}
+		events, err := d.Store.EventsSince(ctx, cursor, nil, BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		webhooks, err := d.Store.Webhooks(ctx)
+		if err != nil {
+			return err
+		}
+
+		var deliveries []models.WebhookDelivery
+		for _, event := range events {
+			for _, webhook := range webhooks {
+				if event.ID > webhook.AfterEventID && webhook.Wants(event.QuoteCurrency) {
+					deliveries = append(deliveries, models.WebhookDelivery{WebhookID: webhook.ID, Event: event})
+				}
+			}
+		}
+
+		// another process moving the cursor first has queued the same deliveries
+		if _, err = d.Store.EnqueueDeliveries(ctx, cursor, events[len(events)-1].ID, deliveries); err != nil {
+			return err
+		}
+		if len(events) < BatchSize {
+			return nil
+		}
+	}
+}
+
+// deliver - sends the due deliveries
+func (d *Dispatcher) deliver(ctx context.Context) error {
+	for {
+		// a claim outlasts every attempt of the batch, so no other process picks them up while they are sent
+		lease := d.Config.Timeout*time.Duration(BatchSize/d.Config.Workers+1) + time.Minute
+		deliveries, err := d.Store.ClaimDeliveries(ctx, time.Now(), lease, BatchSize)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		webhooks, err := d.Store.Webhooks(ctx)
+		if err != nil {
+			return err
+		}
+		byID := make(map[int64]models.Webhook, len(webhooks))
+		for _, webhook := range webhooks {
+			byID[webhook.ID] = webhook
+		}
+
+		queue := make(chan models.WebhookDelivery)
+		var wg sync.WaitGroup
+		for i := 0; i < d.Config.Workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for delivery := range queue {
+					webhook, ok := byID[delivery.WebhookID]
+					if !ok {
+						// deleted while it was being claimed
+						continue
+					}
+					delivery = d.attempt(ctx, webhook, delivery)
+					if err := d.Store.UpdateDelivery(ctx, delivery); err != nil && ctx.Err() == nil {
+						log.Printf("could not store webhook delivery %d: %s", delivery.ID, err)
+					}
+				}
+			}()
+		}
+		for _, delivery := range deliveries {
+			queue <- delivery
+		}
+		close(queue)
+		wg.Wait()
+
+		if ctx.Err() != nil || len(deliveries) < BatchSize {
+			return ctx.Err()
+		}
+	}
+}
+
+// attempt - sends delivery once and returns it with the outcome
+func (d *Dispatcher) attempt(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) models.WebhookDelivery {
+	delivery.Attempts++
+
+	err := d.send(ctx, webhook, delivery)
+	if err == nil {
+		now := time.Now().UTC()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.Config.MaxAttempts {
+		delivery.Status = models.DeliveryDead
+		log.Printf("webhook delivery %d to %s failed %d times, moved to dead letters: %s", delivery.ID, webhook.URL, delivery.Attempts, err)
+		return delivery
+	}
+	delivery.NextAttemptAt = time.Now().Add(Backoff(d.Config, delivery.Attempts))
+
+	return delivery
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) error {
+	body, err := json.Marshal(objects.NewRateEventResponse(delivery.Event))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign - the X-Rates-Signature of a body sent at timestamp, "sha256=" and the hex HMAC-SHA256 of
+// "{timestamp}.{body}" keyed with the webhook secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff - wait before the next attempt after the given number of failed ones
+func Backoff(config Config, attempts int) time.Duration {
+	backoff := config.InitialBackoff
+	for i := 1; i < attempts && backoff < config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.MaxBackoff {
+		backoff = config.MaxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "base_currency_quote_currency_date_unique";
@@ -0,0 +1,7 @@
+DELETE FROM currency_rates a
+    USING currency_rates b
+WHERE a.base_currency = b.base_currency
+  AND a.quote_currency = b.quote_currency
+  AND a.date = b.date
+  AND a.id > b.id;
+CREATE UNIQUE INDEX IF NOT EXISTS "base_currency_quote_currency_date_unique" ON "public"."currency_rates" USING BTREE ("base_currency", "quote_currency", "date");
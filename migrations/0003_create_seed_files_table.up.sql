@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS seed_files
+(
+    path       varchar(255) constraint seed_files_pk primary key,
+    checksum   char(64)  not null,
+    lines      integer   not null,
+    updated_at timestamp not null default now()
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS currency_rates_record_created ON currency_rates;
+DROP FUNCTION IF EXISTS record_rate_created();
+DROP TABLE IF EXISTS rate_events;
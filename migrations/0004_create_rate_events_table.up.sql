@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS rate_events
+(
+    id             bigserial constraint rate_events_pk primary key,
+    type           varchar(32)    not null,
+    base_currency  char(3)        not null,
+    quote_currency char(3)        not null,
+    rate           decimal(12, 6) not null,
+    date           DATE           not null,
+    created_at     timestamptz    not null default now()
+);
+CREATE INDEX IF NOT EXISTS rate_events_quote_currency_id_index ON rate_events (quote_currency, id);
+
+-- every insert into currency_rates, whichever path it comes from, records an event in the same transaction.
+-- The advisory lock makes writers commit in id order, so a reader that has seen id n never misses an id below n
+-- that was still uncommitted
+CREATE OR REPLACE FUNCTION record_rate_created() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.created', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_rates_record_created ON currency_rates;
+CREATE TRIGGER currency_rates_record_created
+    AFTER INSERT
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_created();
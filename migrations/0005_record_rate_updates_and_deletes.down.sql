@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS currency_rates_record_changed ON currency_rates;
+DROP FUNCTION IF EXISTS record_rate_changed();
@@ -0,0 +1,23 @@
+-- updates record the new rate and deletes the removed one, in id order like inserts
+CREATE OR REPLACE FUNCTION record_rate_changed() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+        VALUES ('rate.deleted', OLD.base_currency, OLD.quote_currency, OLD.rate, OLD.date);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.updated', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_rates_record_changed ON currency_rates;
+CREATE TRIGGER currency_rates_record_changed
+    AFTER UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_changed();
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id             bigserial constraint webhooks_pk primary key,
+    url            text        not null,
+    secret         text        not null,
+    currencies     text[]      not null default '{}',
+    after_event_id bigint      not null,
+    created_at     timestamptz not null default now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              bigserial constraint webhook_deliveries_pk primary key,
+    webhook_id      bigint      not null references webhooks (id) on delete cascade,
+    event_id        bigint      not null references rate_events (id),
+    status          varchar(16) not null default 'pending',
+    attempts        integer     not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_error      text        not null default '',
+    created_at      timestamptz not null default now(),
+    delivered_at    timestamptz,
+    constraint webhook_deliveries_webhook_event_unique unique (webhook_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_index ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_status_index ON webhook_deliveries (webhook_id, status, id);
+
+-- a single row with the last event turned into deliveries, created with the first webhook
+CREATE TABLE IF NOT EXISTS webhook_cursor
+(
+    id            integer primary key constraint webhook_cursor_single_row check (id = 1),
+    last_event_id bigint not null
+);
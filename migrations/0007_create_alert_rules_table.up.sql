@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS alert_rules
+(
+    id             bigserial constraint alert_rules_pk primary key,
+    type           varchar(16)    not null,
+    quote_currency char(3)        not null,
+    condition      varchar(16)    not null default '',
+    value          decimal(12, 6) not null,
+    notifier       varchar(32)    not null,
+    target         text           not null default '',
+    active         boolean        not null default false,
+    triggered_at   timestamptz,
+    created_at     timestamptz    not null default now()
+);
+CREATE INDEX IF NOT EXISTS alert_rules_quote_currency_index ON alert_rules (quote_currency);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS currency_rates_notify_changed ON currency_rates;
+DROP FUNCTION IF EXISTS notify_rate_changed();
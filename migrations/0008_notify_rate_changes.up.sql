@@ -0,0 +1,28 @@
+-- tells every listening API process about a committed rate change, so it can drop cached results and push events
+-- without waiting for its next poll of rate_events
+CREATE OR REPLACE FUNCTION notify_rate_changed() RETURNS trigger AS
+$$
+DECLARE
+    rate currency_rates;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rate := OLD;
+    ELSE
+        rate := NEW;
+    END IF;
+
+    PERFORM pg_notify('rate_changes', json_build_object(
+        'type', 'rate.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+        'quote_currency', rate.quote_currency,
+        'date', to_char(rate.date, 'YYYY-MM-DD')
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_rates_notify_changed ON currency_rates;
+CREATE TRIGGER currency_rates_notify_changed
+    AFTER INSERT OR UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION notify_rate_changed();
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS currency_rates_record_outbox ON currency_rates;
+DROP FUNCTION IF EXISTS record_rate_outbox();
+DROP TABLE IF EXISTS outbox_offsets;
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         bigserial constraint outbox_pk primary key,
+    topic      varchar(32) not null,
+    type       varchar(32) not null,
+    payload    jsonb       not null,
+    created_at timestamptz not null default now()
+);
+
+-- how far each sink got, the owner holds the sink until locked_until so only one process publishes to it
+CREATE TABLE IF NOT EXISTS outbox_offsets
+(
+    sink         varchar(64) constraint outbox_offsets_pk primary key,
+    last_id      bigint      not null,
+    owner        text        not null default '',
+    locked_until timestamptz not null default now()
+);
+
+-- every change of currency_rates writes its message in the same transaction, in the id order of commits like
+-- rate_events
+CREATE OR REPLACE FUNCTION record_rate_outbox() RETURNS trigger AS
+$$
+DECLARE
+    rate currency_rates;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    IF TG_OP = 'DELETE' THEN
+        rate := OLD;
+    ELSE
+        rate := NEW;
+    END IF;
+
+    INSERT INTO outbox (topic, type, payload)
+    VALUES ('rates.' || rate.quote_currency,
+            'rate.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+            json_build_object(
+                'date', to_char(rate.date, 'YYYY-MM-DD'),
+                'base_currency', rate.base_currency,
+                'quote_currency', rate.quote_currency,
+                'rate', trim_scale(rate.rate)::text
+            ));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_rates_record_outbox ON currency_rates;
+CREATE TRIGGER currency_rates_record_outbox
+    AFTER INSERT OR UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_outbox();
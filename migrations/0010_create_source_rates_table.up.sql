@@ -0,0 +1,11 @@
+-- the value every source gave, currency_rates keeps the rate reconciled from them
+CREATE TABLE IF NOT EXISTS source_rates
+(
+    base_currency  char(3)        not null,
+    quote_currency char(3)        not null,
+    date           date           not null,
+    source         varchar(255)   not null,
+    rate           decimal(12, 6) not null,
+    updated_at     timestamptz    not null default now(),
+    constraint source_rates_pk primary key (quote_currency, date, base_currency, source)
+);
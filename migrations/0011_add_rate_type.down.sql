@@ -0,0 +1,26 @@
+DROP TRIGGER IF EXISTS currency_rates_record_outbox_changed ON currency_rates;
+DROP TRIGGER IF EXISTS currency_rates_record_outbox ON currency_rates;
+CREATE TRIGGER currency_rates_record_outbox
+    AFTER INSERT OR UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_outbox();
+
+DROP TRIGGER IF EXISTS currency_rates_record_changed ON currency_rates;
+CREATE TRIGGER currency_rates_record_changed
+    AFTER UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_changed();
+
+DROP TRIGGER IF EXISTS currency_rates_record_created ON currency_rates;
+CREATE TRIGGER currency_rates_record_created
+    AFTER INSERT
+    ON currency_rates
+    FOR EACH ROW
+EXECUTE FUNCTION record_rate_created();
+
+DELETE FROM currency_rates WHERE rate_type <> 'mid';
+DROP INDEX IF EXISTS "base_currency_quote_currency_date_rate_type_unique";
+CREATE UNIQUE INDEX IF NOT EXISTS "base_currency_quote_currency_date_unique" ON "public"."currency_rates" USING BTREE ("base_currency", "quote_currency", "date");
+ALTER TABLE currency_rates DROP COLUMN IF EXISTS rate_type;
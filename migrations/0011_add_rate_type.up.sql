@@ -0,0 +1,40 @@
+-- a quote can be a bid, an ask, a mid or an official fixing, the existing rates are mids
+ALTER TABLE currency_rates
+    ADD COLUMN IF NOT EXISTS rate_type varchar(8) not null default 'mid'
+        constraint currency_rates_rate_type_check check (rate_type in ('mid', 'bid', 'ask', 'fixing'));
+
+DROP INDEX IF EXISTS "base_currency_quote_currency_date_unique";
+CREATE UNIQUE INDEX IF NOT EXISTS "base_currency_quote_currency_date_rate_type_unique" ON "public"."currency_rates" USING BTREE ("base_currency", "quote_currency", "date", "rate_type");
+
+-- events and outbox messages stay about the published mid rate
+DROP TRIGGER IF EXISTS currency_rates_record_created ON currency_rates;
+CREATE TRIGGER currency_rates_record_created
+    AFTER INSERT
+    ON currency_rates
+    FOR EACH ROW
+    WHEN (NEW.rate_type = 'mid')
+EXECUTE FUNCTION record_rate_created();
+
+DROP TRIGGER IF EXISTS currency_rates_record_changed ON currency_rates;
+CREATE TRIGGER currency_rates_record_changed
+    AFTER UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+    WHEN (OLD.rate_type = 'mid')
+EXECUTE FUNCTION record_rate_changed();
+
+DROP TRIGGER IF EXISTS currency_rates_record_outbox ON currency_rates;
+CREATE TRIGGER currency_rates_record_outbox
+    AFTER INSERT
+    ON currency_rates
+    FOR EACH ROW
+    WHEN (NEW.rate_type = 'mid')
+EXECUTE FUNCTION record_rate_outbox();
+
+DROP TRIGGER IF EXISTS currency_rates_record_outbox_changed ON currency_rates;
+CREATE TRIGGER currency_rates_record_outbox_changed
+    AFTER UPDATE OR DELETE
+    ON currency_rates
+    FOR EACH ROW
+    WHEN (OLD.rate_type = 'mid')
+EXECUTE FUNCTION record_rate_outbox();
@@ -0,0 +1,65 @@
+-- one notification per statement and quote currency instead of one per row, so a seeded batch of thousands of
+-- rates doesn't flood every listening process. date and to are the first and last date the statement changed
+CREATE OR REPLACE FUNCTION notify_rates_changed() RETURNS trigger AS
+$$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        FOR changed IN
+            SELECT quote_currency, min(date) AS first_date, max(date) AS last_date
+            FROM (SELECT quote_currency, date FROM old_rows UNION ALL SELECT quote_currency, date FROM changed_rows) changes
+            GROUP BY quote_currency
+        LOOP
+            PERFORM pg_notify('rate_changes', json_build_object(
+                'type', 'rate.updated',
+                'quote_currency', changed.quote_currency,
+                'date', to_char(changed.first_date, 'YYYY-MM-DD'),
+                'to', to_char(changed.last_date, 'YYYY-MM-DD')
+            )::text);
+        END LOOP;
+        RETURN NULL;
+    END IF;
+
+    FOR changed IN
+        SELECT quote_currency, min(date) AS first_date, max(date) AS last_date
+        FROM changed_rows
+        GROUP BY quote_currency
+    LOOP
+        PERFORM pg_notify('rate_changes', json_build_object(
+            'type', 'rate.' || CASE TG_OP WHEN 'INSERT' THEN 'created' ELSE 'deleted' END,
+            'quote_currency', changed.quote_currency,
+            'date', to_char(changed.first_date, 'YYYY-MM-DD'),
+            'to', to_char(changed.last_date, 'YYYY-MM-DD')
+        )::text);
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_rates_notify_changed ON currency_rates;
+DROP FUNCTION IF EXISTS notify_rate_changed();
+
+DROP TRIGGER IF EXISTS currency_rates_notify_created ON currency_rates;
+CREATE TRIGGER currency_rates_notify_created
+    AFTER INSERT
+    ON currency_rates
+    REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_rates_changed();
+
+DROP TRIGGER IF EXISTS currency_rates_notify_updated ON currency_rates;
+CREATE TRIGGER currency_rates_notify_updated
+    AFTER UPDATE
+    ON currency_rates
+    REFERENCING OLD TABLE AS old_rows NEW TABLE AS changed_rows
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_rates_changed();
+
+DROP TRIGGER IF EXISTS currency_rates_notify_deleted ON currency_rates;
+CREATE TRIGGER currency_rates_notify_deleted
+    AFTER DELETE
+    ON currency_rates
+    REFERENCING OLD TABLE AS changed_rows
+    FOR EACH STATEMENT
+EXECUTE FUNCTION notify_rates_changed();
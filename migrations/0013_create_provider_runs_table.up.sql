@@ -0,0 +1,9 @@
+-- the daily fetch of each provider, the owner holds it until locked_until so only one process fetches a day
+CREATE TABLE IF NOT EXISTS provider_runs
+(
+    provider     varchar(32) constraint provider_runs_pk primary key,
+    day          date        not null,
+    owner        text        not null,
+    locked_until timestamptz not null,
+    done         boolean     not null default false
+);
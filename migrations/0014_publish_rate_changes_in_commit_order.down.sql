@@ -0,0 +1,56 @@
+CREATE OR REPLACE FUNCTION record_rate_created() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.created', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_rate_changed() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+        VALUES ('rate.deleted', OLD.base_currency, OLD.quote_currency, OLD.rate, OLD.date);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.updated', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_rate_outbox() RETURNS trigger AS
+$$
+DECLARE
+    rate currency_rates;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+    IF TG_OP = 'DELETE' THEN
+        rate := OLD;
+    ELSE
+        rate := NEW;
+    END IF;
+
+    INSERT INTO outbox (topic, type, payload)
+    VALUES ('rates.' || rate.quote_currency,
+            'rate.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+            json_build_object(
+                'date', to_char(rate.date, 'YYYY-MM-DD'),
+                'base_currency', rate.base_currency,
+                'quote_currency', rate.quote_currency,
+                'rate', trim_scale(rate.rate)::text
+            ));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- rows still pending are kept, the ones of transactions still running are lost with the table
+SELECT publish_rate_changes();
+DROP FUNCTION IF EXISTS publish_rate_changes();
+DROP TABLE IF EXISTS outbox_pending;
+DROP TABLE IF EXISTS rate_events_pending;
@@ -0,0 +1,93 @@
+-- the triggers write to pending tables without taking a lock, so transactions writing rates run in parallel.
+-- publish_rate_changes moves the rows of every finished transaction to rate_events and outbox in commit order:
+-- a transaction below the xmin of the snapshot has committed or rolled back and can't add rows anymore, and the
+-- advisory lock makes publishers take ids one after another, so a reader that has seen id n never misses an id
+-- below n
+CREATE TABLE IF NOT EXISTS rate_events_pending
+(
+    seq            bigserial constraint rate_events_pending_pk primary key,
+    txid           xid8           not null default pg_current_xact_id(),
+    type           varchar(32)    not null,
+    base_currency  char(3)        not null,
+    quote_currency char(3)        not null,
+    rate           decimal(12, 6) not null,
+    date           DATE           not null,
+    created_at     timestamptz    not null default now()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_pending
+(
+    seq        bigserial constraint outbox_pending_pk primary key,
+    txid       xid8        not null default pg_current_xact_id(),
+    topic      varchar(32) not null,
+    type       varchar(32) not null,
+    payload    jsonb       not null,
+    created_at timestamptz not null default now()
+);
+
+CREATE OR REPLACE FUNCTION record_rate_created() RETURNS trigger AS
+$$
+BEGIN
+    INSERT INTO rate_events_pending (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.created', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_rate_changed() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO rate_events_pending (type, base_currency, quote_currency, rate, date)
+        VALUES ('rate.deleted', OLD.base_currency, OLD.quote_currency, OLD.rate, OLD.date);
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO rate_events_pending (type, base_currency, quote_currency, rate, date)
+    VALUES ('rate.updated', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_rate_outbox() RETURNS trigger AS
+$$
+DECLARE
+    rate currency_rates;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rate := OLD;
+    ELSE
+        rate := NEW;
+    END IF;
+
+    INSERT INTO outbox_pending (topic, type, payload)
+    VALUES ('rates.' || rate.quote_currency,
+            'rate.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+            json_build_object(
+                'date', to_char(rate.date, 'YYYY-MM-DD'),
+                'base_currency', rate.base_currency,
+                'quote_currency', rate.quote_currency,
+                'rate', trim_scale(rate.rate)::text
+            ));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION publish_rate_changes() RETURNS void AS
+$$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('rate_events'));
+
+    WITH published AS (
+        DELETE FROM rate_events_pending WHERE txid < pg_snapshot_xmin(pg_current_snapshot()) RETURNING *
+    )
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    SELECT type, base_currency, quote_currency, rate, date, created_at FROM published ORDER BY txid, seq;
+
+    WITH published AS (
+        DELETE FROM outbox_pending WHERE txid < pg_snapshot_xmin(pg_current_snapshot()) RETURNING *
+    )
+    INSERT INTO outbox (topic, type, payload, created_at)
+    SELECT topic, type, payload, created_at FROM published ORDER BY txid, seq;
+END;
+$$ LANGUAGE plpgsql;
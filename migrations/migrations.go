@@ -0,0 +1,14 @@
+// Package migrations embeds the sql migrations so the binary doesn't depend on the working directory
+package migrations
+
+import "embed"
+
+// Postgres - migrations of the postgres backend
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+// SQLite - migrations of the sqlite backend, kept under the sqlite directory
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
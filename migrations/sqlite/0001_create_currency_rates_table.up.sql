@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS currency_rates
+(
+    id             integer primary key autoincrement,
+    base_currency  char(3) not null,
+    quote_currency char(3) not null,
+    rate           text    not null,
+    date           text
+);
+CREATE INDEX IF NOT EXISTS base_currency_quote_currency_index ON currency_rates (base_currency, quote_currency);
@@ -0,0 +1,3 @@
+DELETE FROM currency_rates
+WHERE id NOT IN (SELECT min(id) FROM currency_rates GROUP BY base_currency, quote_currency, date);
+CREATE UNIQUE INDEX IF NOT EXISTS base_currency_quote_currency_date_unique ON currency_rates (base_currency, quote_currency, date);
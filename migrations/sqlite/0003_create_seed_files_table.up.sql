@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS seed_files
+(
+    path       text primary key,
+    checksum   text    not null,
+    lines      integer not null,
+    updated_at text    not null
+);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS currency_rates_record_created;
+DROP TABLE IF EXISTS rate_events;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS rate_events
+(
+    id             integer primary key autoincrement,
+    type           text not null,
+    base_currency  char(3) not null,
+    quote_currency char(3) not null,
+    rate           text not null,
+    date           text not null,
+    created_at     text not null
+);
+CREATE INDEX IF NOT EXISTS rate_events_quote_currency_id_index ON rate_events (quote_currency, id);
+
+-- every insert into currency_rates, whichever path it comes from, records an event in the same transaction
+CREATE TRIGGER IF NOT EXISTS currency_rates_record_created
+    AFTER INSERT
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.created', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS currency_rates_record_deleted;
+DROP TRIGGER IF EXISTS currency_rates_record_updated;
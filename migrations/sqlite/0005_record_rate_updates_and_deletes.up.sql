@@ -0,0 +1,16 @@
+-- updates record the new rate and deletes the removed one
+CREATE TRIGGER IF NOT EXISTS currency_rates_record_updated
+    AFTER UPDATE
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.updated', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS currency_rates_record_deleted
+    AFTER DELETE
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.deleted', OLD.base_currency, OLD.quote_currency, OLD.rate, OLD.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id             integer primary key autoincrement,
+    url            text    not null,
+    secret         text    not null,
+    -- comma separated, empty for every currency
+    currencies     text    not null default '',
+    after_event_id integer not null,
+    created_at     text    not null
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              integer primary key autoincrement,
+    webhook_id      integer not null,
+    event_id        integer not null,
+    status          text    not null default 'pending',
+    attempts        integer not null default 0,
+    next_attempt_at text    not null,
+    last_error      text    not null default '',
+    created_at      text    not null,
+    delivered_at    text,
+    unique (webhook_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status_next_attempt_at_index ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_status_index ON webhook_deliveries (webhook_id, status, id);
+
+-- a single row with the last event turned into deliveries, created with the first webhook
+CREATE TABLE IF NOT EXISTS webhook_cursor
+(
+    id            integer primary key check (id = 1),
+    last_event_id integer not null
+);
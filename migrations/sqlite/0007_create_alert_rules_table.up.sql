@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS alert_rules
+(
+    id             integer primary key autoincrement,
+    type           text    not null,
+    quote_currency char(3) not null,
+    condition      text    not null default '',
+    value          text    not null,
+    notifier       text    not null,
+    target         text    not null default '',
+    active         integer not null default 0,
+    triggered_at   text,
+    created_at     text    not null
+);
+CREATE INDEX IF NOT EXISTS alert_rules_quote_currency_index ON alert_rules (quote_currency);
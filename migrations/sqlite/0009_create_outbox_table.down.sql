@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS currency_rates_outbox_deleted;
+DROP TRIGGER IF EXISTS currency_rates_outbox_updated;
+DROP TRIGGER IF EXISTS currency_rates_outbox_created;
+DROP TABLE IF EXISTS outbox_offsets;
+DROP TABLE IF EXISTS outbox;
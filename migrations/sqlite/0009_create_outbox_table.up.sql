@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         integer primary key autoincrement,
+    topic      text not null,
+    type       text not null,
+    payload    text not null,
+    created_at text not null
+);
+
+-- how far each sink got, the owner holds the sink until locked_until so only one process publishes to it
+CREATE TABLE IF NOT EXISTS outbox_offsets
+(
+    sink         text primary key,
+    last_id      integer not null,
+    owner        text    not null default '',
+    locked_until text    not null
+);
+
+-- every change of currency_rates writes its message in the same transaction
+CREATE TRIGGER IF NOT EXISTS currency_rates_outbox_created
+    AFTER INSERT
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || NEW.quote_currency, 'rate.created',
+            json_object('date', NEW.date, 'base_currency', NEW.base_currency, 'quote_currency', NEW.quote_currency, 'rate', NEW.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS currency_rates_outbox_updated
+    AFTER UPDATE
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || NEW.quote_currency, 'rate.updated',
+            json_object('date', NEW.date, 'base_currency', NEW.base_currency, 'quote_currency', NEW.quote_currency, 'rate', NEW.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS currency_rates_outbox_deleted
+    AFTER DELETE
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || OLD.quote_currency, 'rate.deleted',
+            json_object('date', OLD.date, 'base_currency', OLD.base_currency, 'quote_currency', OLD.quote_currency, 'rate', OLD.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
@@ -0,0 +1,11 @@
+-- the value every source gave, currency_rates keeps the rate reconciled from them
+CREATE TABLE IF NOT EXISTS source_rates
+(
+    base_currency  char(3) not null,
+    quote_currency char(3) not null,
+    date           text    not null,
+    source         text    not null,
+    rate           text    not null,
+    updated_at     text    not null,
+    primary key (quote_currency, date, base_currency, source)
+);
@@ -0,0 +1,64 @@
+DROP TRIGGER IF EXISTS currency_rates_record_created;
+CREATE TRIGGER currency_rates_record_created
+    AFTER INSERT
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.created', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DROP TRIGGER IF EXISTS currency_rates_record_updated;
+CREATE TRIGGER currency_rates_record_updated
+    AFTER UPDATE
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.updated', NEW.base_currency, NEW.quote_currency, NEW.rate, NEW.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DROP TRIGGER IF EXISTS currency_rates_record_deleted;
+CREATE TRIGGER currency_rates_record_deleted
+    AFTER DELETE
+    ON currency_rates
+BEGIN
+    INSERT INTO rate_events (type, base_currency, quote_currency, rate, date, created_at)
+    VALUES ('rate.deleted', OLD.base_currency, OLD.quote_currency, OLD.rate, OLD.date, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DROP TRIGGER IF EXISTS currency_rates_outbox_created;
+CREATE TRIGGER currency_rates_outbox_created
+    AFTER INSERT
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || NEW.quote_currency, 'rate.created',
+            json_object('date', NEW.date, 'base_currency', NEW.base_currency, 'quote_currency', NEW.quote_currency, 'rate', NEW.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DROP TRIGGER IF EXISTS currency_rates_outbox_updated;
+CREATE TRIGGER currency_rates_outbox_updated
+    AFTER UPDATE
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || NEW.quote_currency, 'rate.updated',
+            json_object('date', NEW.date, 'base_currency', NEW.base_currency, 'quote_currency', NEW.quote_currency, 'rate', NEW.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DROP TRIGGER IF EXISTS currency_rates_outbox_deleted;
+CREATE TRIGGER currency_rates_outbox_deleted
+    AFTER DELETE
+    ON currency_rates
+BEGIN
+    INSERT INTO outbox (topic, type, payload, created_at)
+    VALUES ('rates.' || OLD.quote_currency, 'rate.deleted',
+            json_object('date', OLD.date, 'base_currency', OLD.base_currency, 'quote_currency', OLD.quote_currency, 'rate', OLD.rate),
+            strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+END;
+
+DELETE FROM currency_rates WHERE rate_type <> 'mid';
+DROP INDEX IF EXISTS base_currency_quote_currency_date_rate_type_unique;
+CREATE UNIQUE INDEX IF NOT EXISTS base_currency_quote_currency_date_unique ON currency_rates (base_currency, quote_currency, date);
+ALTER TABLE currency_rates DROP COLUMN rate_type;
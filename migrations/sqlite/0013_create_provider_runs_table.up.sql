@@ -0,0 +1,9 @@
+-- the daily fetch of each provider, the owner holds it until locked_until so only one process fetches a day
+CREATE TABLE IF NOT EXISTS provider_runs
+(
+    provider     text primary key,
+    day          text    not null,
+    owner        text    not null,
+    locked_until text    not null,
+    done         integer not null default 0
+);
@@ -0,0 +1,261 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/alerts"
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier - keeps the alerts it is sent
+type recordingNotifier struct {
+	alerts []models.Alert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert models.Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestAlerts(t *testing.T) {
+	alertsFile := filepath.Join(t.TempDir(), "alerts.ndjson")
+	t.Setenv("ALERTS_FILE", alertsFile)
+
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+	client := resty.New()
+
+	for _, body := range []string{
+		`{"type": "stale", "currency": "CHF", "value": "1.5", "notifier": "log"}`,
+		`{"type": "threshold", "currency": "CHF", "value": "1.1", "notifier": "log"}`,
+		`{"type": "move", "currency": "CHF", "value": "2", "notifier": "email"}`,
+		`{"type": "move", "currency": "CHF", "value": "2", "notifier": "webhook", "target": "file:///etc/passwd"}`,
+	} {
+		resp, err := client.R().SetBody(body).Post(ts.URL + "/api/v1/alerts")
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode(), body)
+	}
+
+	var created struct {
+		Data struct {
+			ID     int64 `json:"id"`
+			Active bool  `json:"active"`
+		} `json:"data"`
+	}
+	resp, err := client.R().
+		SetBody(`{"type": "threshold", "currency": "chf", "condition": "above", "value": "0.95", "notifier": "file"}`).
+		SetResult(&created).
+		Post(ts.URL + "/api/v1/alerts")
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode(), resp.String())
+	assert.False(t, created.Data.Active)
+
+	// the latest chf rate is 0.8905, a write above the threshold notifies once
+	for _, body := range []string{`{"date": "2021-02-06","rate": "0.96"}`, `{"date": "2021-02-07","rate": "0.97"}`} {
+		resp, err = client.R().SetBody(body).Post(ts.URL + "/api/v1/rates/chf")
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode())
+	}
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(alertsFile)
+		return err == nil && strings.Count(string(content), "\n") == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	content, err := os.ReadFile(alertsFile)
+	require.NoError(t, err)
+	var alert models.Alert
+	require.NoError(t, json.Unmarshal(content, &alert))
+	assert.Equal(t, created.Data.ID, alert.Rule.ID)
+	assert.Contains(t, alert.Message, "CHFUSD is 0.9")
+
+	require.Eventually(t, func() bool {
+		rule, err := db.GetAlertRule(context.Background(), created.Data.ID)
+		return err == nil && rule.Active && rule.TriggeredAt != nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// a rule that holds when it is created notifies right away
+	var failing int32
+	endpoint, requests := newReceiver(t, &failing)
+	resp, err = client.R().
+		SetBody(`{"type": "move", "currency": "CHF", "value": "1", "notifier": "webhook", "target": "` + endpoint + `"}`).
+		SetResult(&created).
+		Post(ts.URL + "/api/v1/alerts")
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode(), resp.String())
+	assert.True(t, created.Data.Active)
+	assert.Contains(t, string(receive(t, requests).Body), `CHFUSD moved 1.04% from 0.96 on 2021-02-06 to 0.97 on 2021-02-07`)
+
+	resp, err = client.R().Get(ts.URL + "/api/v1/alerts?currency=chf")
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, 2, strings.Count(resp.String(), `"quote_currency":"CHF"`))
+
+	resp, err = client.R().Delete(ts.URL + "/api/v1/alerts/1")
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode())
+	resp, err = client.R().Get(ts.URL + "/api/v1/alerts/1")
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode())
+}
+
+func TestAlerts_Stale(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	ctx := context.Background()
+
+	rule := models.AlertRule{Type: models.AlertStale, QuoteCurrency: "THB", Value: decimal.NewFromInt(3), Notifier: "test"}
+	require.NoError(t, db.CreateAlertRule(ctx, &rule))
+
+	notifier := &recordingNotifier{}
+	evaluator := alerts.NewEvaluator(db, db, nil, map[string]alerts.Notifier{"test": notifier}, time.Hour)
+
+	// the latest THB rate is from friday 2021-01-29
+	evaluator.Now = func() time.Time { return date("2021-02-02") }
+	require.NoError(t, evaluator.Evaluate(ctx, nil))
+	assert.Empty(t, notifier.alerts)
+
+	evaluator.Now = func() time.Time { return date("2021-02-03") }
+	require.NoError(t, evaluator.Evaluate(ctx, nil))
+	require.Len(t, notifier.alerts, 1)
+	assert.Equal(t, "no new THBUSD rate for 3 business days, the latest is from 2021-01-29", notifier.alerts[0].Message)
+
+	// it holds still, so there is no second alert
+	require.NoError(t, evaluator.Evaluate(ctx, nil))
+	assert.Len(t, notifier.alerts, 1)
+
+	assert.Equal(t, int64(0), alerts.BusinessDaysSince(date("2021-01-29"), date("2021-01-31")))
+	assert.Equal(t, int64(5), alerts.BusinessDaysSince(date("2021-01-29"), date("2021-02-07")))
+}
+
+func TestAlerts_OneReplicaNotifies(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	ctx := context.Background()
+
+	rule := models.AlertRule{Type: models.AlertStale, QuoteCurrency: "THB", Value: decimal.NewFromInt(3), Notifier: "test"}
+	require.NoError(t, db.CreateAlertRule(ctx, &rule))
+
+	// two evaluators over the same store, both see the rule inactive before either stores its state
+	notifier := &recordingNotifier{}
+	rules, err := db.AlertRules(ctx, nil)
+	require.NoError(t, err)
+	replicas := make([]*alerts.Evaluator, 2)
+	for i := range replicas {
+		replicas[i] = alerts.NewEvaluator(staleRules{db, rules}, db, nil, map[string]alerts.Notifier{"test": notifier}, time.Hour)
+		replicas[i].Now = func() time.Time { return date("2021-02-03") }
+	}
+	for _, evaluator := range replicas {
+		require.NoError(t, evaluator.Evaluate(ctx, nil))
+	}
+	assert.Len(t, notifier.alerts, 1)
+}
+
+// staleRules - an alert store that lists rules as they were when another replica read them
+type staleRules struct {
+	*memory.Memory
+	rules []models.AlertRule
+}
+
+func (s staleRules) AlertRules(ctx context.Context, quoteCurrencies []string) ([]models.AlertRule, error) {
+	return s.rules, nil
+}
+
+func TestSQLite_AlertRules(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	rule := models.AlertRule{Type: models.AlertThreshold, QuoteCurrency: "chf", Condition: models.AlertBelow, Value: decimal.RequireFromString("0.9"), Notifier: "log"}
+	require.NoError(t, db.CreateAlertRule(ctx, &rule))
+	other := models.AlertRule{Type: models.AlertMove, QuoteCurrency: "JPY", Value: decimal.RequireFromString("2"), Notifier: "log"}
+	require.NoError(t, db.CreateAlertRule(ctx, &other))
+
+	rules, err := db.AlertRules(ctx, []string{"CHF"})
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "CHF", rules[0].QuoteCurrency)
+	assert.Equal(t, "0.9", rules[0].Value.String())
+	assert.False(t, rules[0].Active)
+
+	at := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, db.SetAlertRuleState(ctx, rule.ID, true, &at))
+	stored, err := db.GetAlertRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Active)
+	assert.True(t, at.Equal(*stored.TriggeredAt))
+
+	// only an inactive rule can be claimed
+	claimed, err := db.ClaimAlertRule(ctx, rule.ID, at.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	require.NoError(t, db.SetAlertRuleState(ctx, rule.ID, false, &at))
+	claimed, err = db.ClaimAlertRule(ctx, rule.ID, at.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	stored, err = db.GetAlertRule(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Active)
+	assert.True(t, at.Add(time.Hour).Equal(*stored.TriggeredAt))
+
+	rules, err = db.AlertRules(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	require.NoError(t, db.DeleteAlertRule(ctx, rule.ID))
+	assert.ErrorIs(t, db.DeleteAlertRule(ctx, rule.ID), database.ErrAlertRuleNotFound)
+}
+
+// blockingNotifier - holds every alert until release is closed
+type blockingNotifier struct {
+	sent    chan models.Alert
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, alert models.Alert) error {
+	n.sent <- alert
+	<-n.release
+	return nil
+}
+
+func TestAlerts_SkipsFailingRules(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	ctx := context.Background()
+
+	rule := models.AlertRule{Type: models.AlertStale, QuoteCurrency: "THB", Value: decimal.NewFromInt(3), Notifier: "test"}
+	require.NoError(t, db.CreateAlertRule(ctx, &rule))
+
+	// a rule that can't be checked comes first, the rules after it are still evaluated
+	broken := models.AlertRule{ID: rule.ID + 1, Type: "unknown", QuoteCurrency: "THB", Notifier: "test"}
+	notifier := &blockingNotifier{sent: make(chan models.Alert, 1), release: make(chan struct{})}
+	evaluator := alerts.NewEvaluator(staleRules{db, []models.AlertRule{broken, rule}}, db, nil, map[string]alerts.Notifier{"test": notifier}, time.Hour)
+	evaluator.Now = func() time.Time { return date("2021-02-03") }
+
+	done := make(chan error, 1)
+	go func() { done <- evaluator.Evaluate(ctx, nil) }()
+	assert.Equal(t, rule.ID, receive(t, notifier.sent).Rule.ID)
+
+	// the notification is sent outside the lock, another evaluation doesn't wait for it
+	require.NoError(t, evaluator.Evaluate(ctx, []string{"CHF"}))
+
+	close(notifier.release)
+	require.NoError(t, receive(t, done))
+}
@@ -2,16 +2,37 @@ package test
 
 import (
 	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
 	"github.com/Shambou/golang-challenge/internal/server"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 )
 
-const (
-	BaseUrl = "http://localhost:8080/api/v1/rates"
-)
+var BaseUrl string
+
+// TestMain - serves the API from an in-memory store loaded with the fxdata files
+func TestMain(m *testing.M) {
+	db := memory.NewMemory(database.BaseCurrency)
+	if err := db.LoadDir("../fxdata", ".csv"); err != nil {
+		log.Fatal(err)
+	}
+
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	BaseUrl = ts.URL + "/api/v1/rates"
+
+	code := m.Run()
+	ts.Close()
+	os.Exit(code)
+}
 
 func TestGetLatestRate(t *testing.T) {
 	client := resty.New()
@@ -147,9 +168,22 @@ func TestStoreRate(t *testing.T) {
 		assert.Equal(t, 422, resp.StatusCode())
 	})
 
+	t.Run("test store rate:valid", func(t *testing.T) {
+		resp, err := client.R().
+			SetBody(`{"date": "2015-12-31","rate": "1.001500"}`).
+			SetResult(jsonResp).
+			Post(BaseUrl + "/chf")
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, 201, resp.StatusCode())
+		assert.Equal(t, "Stored new rate", jsonResp.Message)
+	})
+
 	t.Run("test store rate:invalid date", func(t *testing.T) {
+		futureDate := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
 		resp, err := client.R().
-			SetBody(`{"date": "2022-05-29","rate": "1.022600"}`).
+			SetBody(fmt.Sprintf(`{"date": "%s","rate": "1.022600"}`, futureDate)).
 			Post(BaseUrl + "/chf")
 
 		assert.NoError(t, err)
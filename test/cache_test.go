@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCachedMemory(t *testing.T, config cache.Config) (*cache.Cache, *memory.Memory) {
+	db := memory.NewMemory(database.BaseCurrency)
+	assert.NoError(t, db.LoadDir("../fxdata", ".csv"))
+
+	return cache.NewCache(db, config), db
+}
+
+func TestCache_HitsAndMisses(t *testing.T) {
+	c, _ := newCachedMemory(t, cache.DefaultConfig)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		rate, err := c.GetLastRate(ctx, "chf")
+		assert.NoError(t, err)
+		assert.Equal(t, "0.8905", rate.Rate.String())
+
+		rates, err := c.GetRatesInRange(ctx, "CHF", date("2016-01-30"), date("2016-02-03"))
+		assert.NoError(t, err)
+		assert.Len(t, rates, 3)
+
+		rates, err = c.GetAllRatesOnDate(ctx, date("2016-04-13"))
+		assert.NoError(t, err)
+		assert.Len(t, rates, 8)
+	}
+
+	// errors are not cached
+	_, err := c.GetLastRate(ctx, "asd")
+	assert.Error(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(6), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+	assert.Equal(t, 3, stats.Entries)
+}
+
+func TestCache_InvalidatesOnCreate(t *testing.T) {
+	c, _ := newCachedMemory(t, cache.DefaultConfig)
+	ctx := context.Background()
+
+	_, _ = c.GetLastRate(ctx, "CHF")
+	_, _ = c.GetLastRate(ctx, "JPY")
+	_, _ = c.GetRatesInRange(ctx, "CHF", date("2021-01-01"), date("2021-03-01"))
+	_, _ = c.GetRatesInRange(ctx, "CHF", date("2016-01-30"), date("2016-02-03"))
+	_, _ = c.GetAllRatesOnDate(ctx, date("2021-02-01"))
+	_, _ = c.GetAllRatesOnDate(ctx, date("2016-04-13"))
+	assert.Equal(t, 6, c.Stats().Entries)
+
+	rate := models.CurrencyRate{QuoteCurrency: "chf", Date: date("2021-02-01"), Rate: decimal.RequireFromString("0.9")}
+	assert.NoError(t, c.CreateRate(ctx, &rate))
+
+	// latest CHF, the 2021 CHF range and the 2021-02-01 timeseries are gone
+	assert.Equal(t, 3, c.Stats().Entries)
+
+	last, err := c.GetLastRate(ctx, "CHF")
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-02-01", last.Date.Format("2006-01-02"))
+
+	rates, err := c.GetRatesInRange(ctx, "CHF", date("2021-01-01"), date("2021-03-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.9", rates[len(rates)-1].Rate.String())
+
+	rates, err = c.GetAllRatesOnDate(ctx, date("2021-02-01"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 1)
+}
+
+func TestCache_EvictionAndExpiry(t *testing.T) {
+	c, _ := newCachedMemory(t, cache.Config{Size: 2, LatestTTL: 50 * time.Millisecond, HistoryTTL: time.Hour})
+	ctx := context.Background()
+
+	_, _ = c.GetLastRate(ctx, "CHF")
+	_, _ = c.GetLastRate(ctx, "JPY")
+	_, _ = c.GetLastRate(ctx, "CHF")
+	_, _ = c.GetLastRate(ctx, "KRW") // evicts JPY, the least recently used
+	assert.Equal(t, 2, c.Stats().Entries)
+
+	_, _ = c.GetLastRate(ctx, "CHF")
+	assert.Equal(t, uint64(2), c.Stats().Hits)
+	_, _ = c.GetLastRate(ctx, "JPY")
+	assert.Equal(t, uint64(2), c.Stats().Hits)
+
+	time.Sleep(60 * time.Millisecond)
+	_, _ = c.GetLastRate(ctx, "JPY")
+	assert.Equal(t, uint64(2), c.Stats().Hits)
+}
+
+// slowMemory - runs hook in the middle of a latest rate lookup, after the rate was read
+type slowMemory struct {
+	*memory.Memory
+	hook func()
+}
+
+func (s *slowMemory) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	rate, err := s.Memory.GetLastRateOfType(ctx, quoteCurrency, rateType)
+	if s.hook != nil {
+		s.hook()
+	}
+
+	return rate, err
+}
+
+func TestCache_DropsResultsReadBeforeInvalidation(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	assert.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	slow := &slowMemory{Memory: db}
+	c := cache.NewCache(slow, cache.DefaultConfig)
+	ctx := context.Background()
+
+	// a write lands while the read is on its way back, the stale rate must not be cached
+	slow.hook = func() {
+		slow.hook = nil
+		rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2022-06-03"), Rate: decimal.RequireFromString("0.95")}
+		assert.NoError(t, c.CreateRate(ctx, &rate))
+	}
+	rate, err := c.GetLastRate(ctx, "CHF")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.8905", rate.Rate.String())
+	assert.Equal(t, 0, c.Stats().Entries)
+
+	rate, err = c.GetLastRate(ctx, "CHF")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.95", rate.Rate.String())
+	assert.Equal(t, 1, c.Stats().Entries)
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	cache "github.com/Shambou/golang-challenge/internal/database/cache"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listeningMemory - a memory store whose changes are announced through a channel, like postgres notifications
+type listeningMemory struct {
+	*memory.Memory
+	changes chan *models.RateChange
+	ready   chan struct{}
+	once    sync.Once
+}
+
+func (l *listeningMemory) ListenForChanges(ctx context.Context, fn func(change *models.RateChange)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change := <-l.changes:
+			fn(change)
+		}
+	}
+}
+
+// LastEventID - the broker reads it once it starts, events after that are live
+func (l *listeningMemory) LastEventID(ctx context.Context) (int64, error) {
+	defer l.once.Do(func() { close(l.ready) })
+
+	return l.Memory.LastEventID(ctx)
+}
+
+func TestListenForChanges(t *testing.T) {
+	// only a change wakes the broker up within the test
+	t.Setenv("EVENTS_POLL_INTERVAL", "1h")
+
+	db := &listeningMemory{
+		Memory:  memory.NewMemory(database.BaseCurrency),
+		changes: make(chan *models.RateChange),
+		ready:   make(chan struct{}),
+	}
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(cache.NewCache(db, cache.DefaultConfig), file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+	client := resty.New()
+
+	select {
+	case <-db.ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker didn't start")
+	}
+	events := openStream(t, ts.URL+"/api/v1/rates/stream?currencies=CHF", "")
+
+	latest := func() string {
+		resp, err := client.R().Get(ts.URL + "/api/v1/rates/latest?quote_currency=CHF")
+		require.NoError(t, err)
+		return resp.String()
+	}
+	assert.Contains(t, latest(), `"rate":"0.8905"`)
+
+	// another replica stores a rate, this one serves the cached one until it hears about it
+	rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2021-02-01"), Rate: decimal.RequireFromString("0.95")}
+	require.NoError(t, db.Memory.CreateRate(context.Background(), &rate))
+	assert.Contains(t, latest(), `"rate":"0.8905"`)
+
+	db.changes <- &models.RateChange{Type: models.RateEventCreated, QuoteCurrency: "CHF", Date: rate.Date}
+	assert.Contains(t, receive(t, events).Data, `"rate":"0.95"`)
+	assert.Contains(t, latest(), `"rate":"0.9500"`)
+
+	// a statement that changed several rates sends one change with the range of their dates
+	resp, err := client.R().Get(ts.URL + "/api/v1/rates/range?quote_currency=CHF&from=2016-02-01&to=2016-02-03")
+	require.NoError(t, err)
+	assert.Contains(t, resp.String(), `"rate":"1.0070"`)
+	rate.Date, rate.Rate = date("2016-02-03"), decimal.RequireFromString("1.01")
+	require.NoError(t, db.Memory.UpdateRate(context.Background(), &rate))
+	db.changes <- &models.RateChange{Type: models.RateEventUpdated, QuoteCurrency: "CHF", Date: date("2016-01-01"), To: date("2016-12-31")}
+	assert.Equal(t, models.RateEventUpdated, receive(t, events).Event)
+	resp, err = client.R().Get(ts.URL + "/api/v1/rates/range?quote_currency=CHF&from=2016-02-01&to=2016-02-03")
+	require.NoError(t, err)
+	assert.Contains(t, resp.String(), `"rate":"1.0100"`)
+
+	// after a lost connection everything cached is dropped
+	rate.Date = date("2021-02-01")
+	rate.Rate = decimal.RequireFromString("0.96")
+	require.NoError(t, db.Memory.UpdateRate(context.Background(), &rate))
+	db.changes <- nil
+	assert.Equal(t, models.RateEventUpdated, receive(t, events).Event)
+	assert.Contains(t, latest(), `"rate":"0.9600"`)
+}
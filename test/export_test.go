@@ -0,0 +1,186 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/export"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/seeds"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// exportedParquetRate - a row of a parquet export as a reader sees it
+type exportedParquetRate struct {
+	Date          int32  `parquet:"name=date, type=INT32, convertedtype=DATE"`
+	BaseCurrency  string `parquet:"name=base_currency, type=BYTE_ARRAY, convertedtype=UTF8"`
+	QuoteCurrency string `parquet:"name=quote_currency, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Rate          int64  `parquet:"name=rate, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+}
+
+func TestExportRates(t *testing.T) {
+	client := resty.New()
+
+	t.Run("export:single currency csv matches fxdata", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(map[string]string{"currencies": "chf", "from": "2016-01-01", "to": "2030-01-01"}).
+			Get(BaseUrl + "/export")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "text/csv", resp.Header().Get("Content-Type"))
+		assert.Contains(t, resp.Header().Get("Content-Disposition"), `filename="CHFUSD.csv"`)
+
+		// the export is the fxdata file byte for byte, including the days without a rate
+		content, err := os.ReadFile("../fxdata/CHFUSD.csv")
+		require.NoError(t, err)
+		assert.Equal(t, string(content), string(resp.Body()))
+	})
+
+	t.Run("export:several currencies csv are zipped", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(map[string]string{"currencies": "sek,chf", "from": "2016-02-01", "to": "2016-02-03"}).
+			Get(BaseUrl + "/export")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+
+		archive, err := zip.NewReader(bytes.NewReader(resp.Body()), int64(len(resp.Body())))
+		require.NoError(t, err)
+		require.Len(t, archive.File, 2)
+		assert.Equal(t, "CHFUSD.csv", archive.File[0].Name)
+		assert.Equal(t, "SEKUSD.csv", archive.File[1].Name)
+
+		f, err := archive.File[0].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "DATE,CHFUSD\n2016-02-01,1.0202\n2016-02-02,1.0181\n2016-02-03,1.0070\n", string(content))
+	})
+
+	t.Run("export:ndjson can be seeded again", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(map[string]string{"from": "2016-02-01", "to": "2016-02-01", "format": "ndjson"}).
+			Get(BaseUrl + "/export")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(resp.String()), "\n")
+		assert.Len(t, lines, 8)
+		assert.Equal(t, `{"date":"2016-02-01","base_currency":"USD","quote_currency":"CHF","rate":"1.0202"}`, lines[0])
+
+		importer := &seeds.NDJSON{BaseCurrency: "USD"}
+		rates := 0
+		err = importer.Import(bytes.NewReader(resp.Body()), func(record seeds.Record) error {
+			rates += len(record.Rates)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 8, rates)
+	})
+
+	t.Run("export:parquet has typed columns", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(map[string]string{"currencies": "chf,jpy", "from": "2016-02-01", "to": "2016-02-02", "format": "parquet"}).
+			Get(BaseUrl + "/export")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+
+		pf, err := buffer.NewBufferFile(resp.Body())
+		require.NoError(t, err)
+		pr, err := reader.NewParquetReader(pf, new(exportedParquetRate), 1)
+		require.NoError(t, err)
+		defer pr.ReadStop()
+
+		rows := make([]exportedParquetRate, pr.GetNumRows())
+		require.NoError(t, pr.Read(&rows))
+		require.Len(t, rows, 4)
+
+		// 2016-02-01 is 16832 days after the unix epoch
+		assert.Equal(t, exportedParquetRate{Date: 16832, BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: 102020000}, rows[0])
+		assert.Equal(t, "JPY", rows[3].QuoteCurrency)
+	})
+
+	t.Run("export:invalid request", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(map[string]string{"currencies": "chf,euro", "from": "2016-02-01", "format": "xlsx"}).
+			Get(BaseUrl + "/export")
+
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode())
+		assert.Contains(t, resp.String(), "euro is not a valid currency")
+		assert.Contains(t, resp.String(), `"to"`)
+		assert.Contains(t, resp.String(), "The format must be one of csv, ndjson, parquet")
+	})
+}
+
+func TestExportCSV_PaddedRates(t *testing.T) {
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	// rates as postgres scans them from decimal(12,6)
+	for _, rate := range []models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2016-02-01"), Rate: decimal.RequireFromString("1.022600")},
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2016-02-02"), Rate: decimal.RequireFromString("1.007000")},
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2016-02-03"), Rate: decimal.RequireFromString("1.012345")},
+	} {
+		require.NoError(t, w.Write(rate))
+	}
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "DATE,CHFUSD\n2016-02-01,1.0226\n2016-02-02,1.0070\n2016-02-03,1.012345\n", buf.String())
+}
+
+// sqlite stores rates as numbers, so it drops the trailing zeros fxdata has on some of them, the export has the
+// same lines and values
+func TestSQLite_ExportMatchesFxdata(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	seeder := seeds.New(db)
+	seeder.Dir = "../fxdata"
+	require.Empty(t, seeder.Execute().Failed())
+
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	defer h.Close()
+	ts := httptest.NewServer(h.Router)
+	defer ts.Close()
+
+	resp, err := resty.New().R().
+		SetQueryParams(map[string]string{"currencies": "chf", "from": "2016-01-01", "to": "2030-01-01"}).
+		Get(ts.URL + "/api/v1/rates/export")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+
+	content, err := os.ReadFile("../fxdata/CHFUSD.csv")
+	require.NoError(t, err)
+	want := strings.Split(string(content), "\n")
+	got := strings.Split(string(resp.Body()), "\n")
+	require.Len(t, got, len(want))
+	for i := range want {
+		if want[i] == got[i] {
+			continue
+		}
+		wantDate, wantRate, _ := strings.Cut(want[i], ",")
+		gotDate, gotRate, _ := strings.Cut(got[i], ",")
+		assert.Equal(t, wantDate, gotDate)
+		assert.True(t, decimal.RequireFromString(wantRate).Equal(decimal.RequireFromString(gotRate)), "%s is %s, not %s", wantDate, gotRate, wantRate)
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile_Lookups(t *testing.T) {
+	f := file.NewFile(database.BaseCurrency, "../fxdata/", ".csv")
+
+	rate, err := f.GetLastRate(context.Background(), "chf")
+	assert.NoError(t, err)
+	assert.Equal(t, "CHF", rate.QuoteCurrency)
+	assert.Equal(t, "2021-01-29", rate.Date.Format("2006-01-02"))
+	assert.Equal(t, "0.8905", rate.Rate.String())
+
+	_, err = f.GetLastRate(context.Background(), "asd")
+	assert.Error(t, err)
+
+	rates, err := f.GetRatesInRange(context.Background(), "CHF", date("2016-01-30"), date("2016-02-03"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+
+	rates, err = f.GetAllRatesOnDate(context.Background(), date("2016-04-13"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 8)
+
+	assert.True(t, f.CheckRateQuoteOnDateExists(context.Background(), "chf", date("2016-01-29")))
+	assert.False(t, f.CheckRateQuoteOnDateExists(context.Background(), "chf", date("2016-02-15")))
+}
+
+func TestFile_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "EURUSD.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("DATE,EURUSD\n2020-01-02,1.1\n2020-01-01,1.0\n"), 0644))
+
+	f := file.NewFile(database.BaseCurrency, dir+"/", ".csv")
+	f.PollInterval = 0
+
+	rate, err := f.GetLastRate(context.Background(), "eur")
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-01-02", rate.Date.Format("2006-01-02"))
+
+	assert.NoError(t, os.WriteFile(path, []byte("DATE,EURUSD\n2020-01-02,1.1\n2020-01-01,1.0\n2020-01-03,1.2\n"), 0644))
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	rate, err = f.GetLastRate(context.Background(), "eur")
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-01-03", rate.Date.Format("2006-01-02"))
+	assert.Equal(t, "1.2", rate.Rate.String())
+}
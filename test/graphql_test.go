@@ -0,0 +1,132 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/gql"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingMemory - counts the batched calls that reach the store
+type countingMemory struct {
+	*memory.Memory
+	asOfCalls   int32
+	streamCalls int32
+}
+
+func (c *countingMemory) GetRatesAsOf(ctx context.Context, quoteCurrencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	atomic.AddInt32(&c.asOfCalls, 1)
+	return c.Memory.GetRatesAsOf(ctx, quoteCurrencies, date)
+}
+
+func (c *countingMemory) StreamRates(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, fn func(models.CurrencyRate) error) error {
+	atomic.AddInt32(&c.streamCalls, 1)
+	return c.Memory.StreamRates(ctx, quoteCurrencies, fromDate, toDate, fn)
+}
+
+func (c *countingMemory) StreamRatesOfType(ctx context.Context, quoteCurrencies []string, fromDate time.Time, toDate time.Time, rateType string, fn func(models.CurrencyRate) error) error {
+	atomic.AddInt32(&c.streamCalls, 1)
+	return c.Memory.StreamRatesOfType(ctx, quoteCurrencies, fromDate, toDate, rateType, fn)
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func graphqlQuery(t *testing.T, url string, query string) graphqlResponse {
+	var result graphqlResponse
+	resp, err := resty.New().R().
+		SetBody(map[string]string{"query": query}).
+		SetResult(&result).
+		Post(url)
+
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+
+	return result
+}
+
+func TestGraphQL(t *testing.T) {
+	mem := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, mem.LoadDir("../fxdata", ".csv"))
+	db := &countingMemory{Memory: mem}
+
+	ts := httptest.NewServer(gql.NewHandler(db))
+	defer ts.Close()
+
+	t.Run("graphql:latest and chart in one round trip", func(t *testing.T) {
+		atomic.StoreInt32(&db.asOfCalls, 0)
+		atomic.StoreInt32(&db.streamCalls, 0)
+
+		result := graphqlQuery(t, ts.URL, `{
+			latest(currencies: ["CHF", "JPY", "XXX"]) { quoteCurrency date rate }
+			currencies { code range(from: "2016-02-01", to: "2016-02-02") { rate } }
+		}`)
+		require.Empty(t, result.Errors)
+
+		var data struct {
+			Latest []*struct {
+				QuoteCurrency string `json:"quoteCurrency"`
+				Date          string `json:"date"`
+				Rate          string `json:"rate"`
+			} `json:"latest"`
+			Currencies []struct {
+				Code  string `json:"code"`
+				Range []struct {
+					Rate string `json:"rate"`
+				} `json:"range"`
+			} `json:"currencies"`
+		}
+		require.NoError(t, json.Unmarshal(result.Data, &data))
+
+		require.Len(t, data.Latest, 3)
+		assert.Equal(t, "CHF", data.Latest[0].QuoteCurrency)
+		assert.Equal(t, "2021-01-29", data.Latest[0].Date)
+		assert.Equal(t, "0.8905", data.Latest[0].Rate)
+		assert.Nil(t, data.Latest[2])
+
+		require.Len(t, data.Currencies, 8)
+		assert.Equal(t, "CHF", data.Currencies[0].Code)
+		assert.Len(t, data.Currencies[0].Range, 2)
+
+		// three currencies and eight ranges, but one call each
+		assert.Equal(t, int32(1), atomic.LoadInt32(&db.asOfCalls))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&db.streamCalls))
+	})
+
+	t.Run("graphql:as of a day without a rate", func(t *testing.T) {
+		result := graphqlQuery(t, ts.URL, `{ currency(code: "chf") { asOf(date: "2016-02-15") { date rate } } }`)
+		require.Empty(t, result.Errors)
+		assert.JSONEq(t, `{"currency": {"asOf": {"date": "2016-02-12", "rate": "0.9768"}}}`, string(result.Data))
+	})
+
+	t.Run("graphql:convert", func(t *testing.T) {
+		result := graphqlQuery(t, ts.URL, `{ convert(amount: "100", from: "CHF", to: "JPY", date: "2016-02-01") { rate result } }`)
+		require.Empty(t, result.Errors)
+		assert.JSONEq(t, `{"convert": {"rate": "118.66300725", "result": "11866.30072535"}}`, string(result.Data))
+
+		result = graphqlQuery(t, ts.URL, `{ convert(amount: "100", from: "USD", to: "CHF", date: "2016-02-01") { result } }`)
+		require.Empty(t, result.Errors)
+		assert.JSONEq(t, `{"convert": {"result": "102.02"}}`, string(result.Data))
+	})
+
+	t.Run("graphql:validation", func(t *testing.T) {
+		result := graphqlQuery(t, ts.URL, `{ range(currency: "CHF", from: "2016-02-31", to: "2016-03-01") { rate } }`)
+		require.Len(t, result.Errors, 1)
+		assert.True(t, strings.HasPrefix(result.Errors[0].Message, "invalid request: from:"))
+	})
+}
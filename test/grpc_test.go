@@ -0,0 +1,132 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/rpc"
+	"github.com/Shambou/golang-challenge/internal/rpc/ratespb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newRatesClient - serves the rates service over an in-memory connection on a store loaded with the fxdata files
+func newRatesClient(t *testing.T) ratespb.RatesClient {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+
+	return ratesClientOf(t, db)
+}
+
+// ratesClientOf - serves the rates service of db over an in-memory connection
+func ratesClientOf(t *testing.T, db database.DatabaseRepo) ratespb.RatesClient {
+	return serveRates(t, rpc.NewServer(db, nil, nil))
+}
+
+// serveRates - serves s over an in-memory connection
+func serveRates(t *testing.T, s *grpc.Server) ratespb.RatesClient {
+	lis := bufconn.Listen(1024 * 1024)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return ratespb.NewRatesClient(conn)
+}
+
+func TestGRPC_Lookups(t *testing.T) {
+	client := newRatesClient(t)
+	ctx := context.Background()
+
+	rate, err := client.GetLatestRate(ctx, &ratespb.GetLatestRateRequest{QuoteCurrency: "chf"})
+	require.NoError(t, err)
+	assert.Equal(t, &ratespb.Rate{Date: "2021-01-29", BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: "0.8905", Type: models.RateMid}, proto(rate))
+
+	_, err = client.GetLatestRate(ctx, &ratespb.GetLatestRateRequest{QuoteCurrency: "eur"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	rangeResp, err := client.GetRatesInRange(ctx, &ratespb.GetRatesInRangeRequest{QuoteCurrency: "chf", From: "2016-02-01", To: "2016-02-03"})
+	require.NoError(t, err)
+	require.Len(t, rangeResp.Rates, 3)
+	assert.Equal(t, "1.007", rangeResp.Rates[2].Rate)
+
+	stream, err := client.StreamRatesInRange(ctx, &ratespb.GetRatesInRangeRequest{QuoteCurrency: "chf", From: "2016-02-01", To: "2016-02-03"})
+	require.NoError(t, err)
+	var streamed []string
+	for {
+		rate, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		streamed = append(streamed, rate.Date)
+	}
+	assert.Equal(t, []string{"2016-02-01", "2016-02-02", "2016-02-03"}, streamed)
+
+	timeseries, err := client.GetTimeseries(ctx, &ratespb.GetTimeseriesRequest{Date: "2016-02-01"})
+	require.NoError(t, err)
+	assert.Len(t, timeseries.Rates, 8)
+}
+
+func TestGRPC_StoreRate(t *testing.T) {
+	client := newRatesClient(t)
+	ctx := context.Background()
+
+	rate, err := client.StoreRate(ctx, &ratespb.StoreRateRequest{QuoteCurrency: "chf", Date: "2015-12-31", Rate: "1.00150012"})
+	require.NoError(t, err)
+	assert.Equal(t, "1.00150012", rate.Rate)
+
+	_, err = client.StoreRate(ctx, &ratespb.StoreRateRequest{QuoteCurrency: "chf", Date: "2015-12-31", Rate: "1.0015"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// same rules as the REST API
+	_, err = client.StoreRate(ctx, &ratespb.StoreRateRequest{QuoteCurrency: "usd", Date: "2015-12-31", Rate: "-1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "currency: The currency can't be USD")
+	assert.Contains(t, err.Error(), "rate: The rate is invalid")
+
+	_, err = client.GetRatesInRange(ctx, &ratespb.GetRatesInRangeRequest{QuoteCurrency: "chf", From: "2016-02-31", To: "2016-02-03"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// proto - drops the internal state of a message so it can be compared with assert.Equal
+func proto(rate *ratespb.Rate) *ratespb.Rate {
+	return &ratespb.Rate{Date: rate.Date, BaseCurrency: rate.BaseCurrency, QuoteCurrency: rate.QuoteCurrency, Rate: rate.Rate, Type: rate.Type}
+}
+
+// brokenMemory - a store whose latest rate lookups fail like a lost connection
+type brokenMemory struct {
+	*memory.Memory
+}
+
+func (b brokenMemory) GetLastRate(ctx context.Context, quoteCurrency string) (models.CurrencyRate, error) {
+	return models.CurrencyRate{}, errors.New("connection refused")
+}
+
+func (b brokenMemory) GetLastRateOfType(ctx context.Context, quoteCurrency string, rateType string) (models.CurrencyRate, error) {
+	return b.GetLastRate(ctx, quoteCurrency)
+}
+
+func TestGRPC_FailedLookupIsInternal(t *testing.T) {
+	client := ratesClientOf(t, brokenMemory{memory.NewMemory(database.BaseCurrency)})
+
+	_, err := client.GetLatestRate(context.Background(), &ratespb.GetLatestRateRequest{QuoteCurrency: "chf"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/seeds"
+	"github.com/stretchr/testify/assert"
+)
+
+const ecbHistory = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2020-01-03">
+			<Cube currency="USD" rate="1.1147"/>
+			<Cube currency="JPY" rate="120.5"/>
+		</Cube>
+		<Cube time="2020-01-02">
+			<Cube currency="USD" rate="1.1193"/>
+			<Cube currency="JPY" rate="121.75"/>
+			<Cube currency="CHF" rate="1.0865"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestImporter_Formats(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	files := map[string]string{
+		"eurofxref-hist.xml": ecbHistory,
+		"wide/majors.csv":    "DATE,CHF,NOK\n2020-01-06,0.9700,8.8500\n2020-01-07,,8.8700\n",
+		"rates.ndjson":       `{"date": "2020-01-08", "quote_currency": "sek", "rate": "9.4100"}` + "\n\n" + `{"date": "2020-01-08", "quote_currency": "THB", "rate": -1}` + "\n",
+		seeds.ManifestFile:   `{"files": [{"path": "wide/majors.csv", "format": "wide-csv"}]}`,
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+
+	summary := seeder.Execute()
+	assert.Empty(t, summary.Failed())
+	assert.Len(t, summary.Files, 3)
+
+	reports := seedReports(summary)
+	assert.Equal(t, seeds.FormatECB, reports["eurofxref-hist.xml"].Format)
+	assert.Equal(t, map[string]int{"JPY": 2, "EUR": 2, "CHF": 1}, reports["eurofxref-hist.xml"].Rows)
+	assert.Equal(t, seeds.FormatWideCSV, reports["majors.csv"].Format)
+	assert.Equal(t, map[string]int{"CHF": 1, "NOK": 2}, reports["majors.csv"].Rows)
+	assert.Equal(t, 1, reports["majors.csv"].Skipped)
+	assert.Equal(t, map[string]int{"SEK": 1}, reports["rates.ndjson"].Rows)
+	assert.Equal(t, 1, reports["rates.ndjson"].Skipped)
+
+	// ECB rates are converted from EUR to USD based
+	rates, err := db.GetAllRatesOnDate(context.Background(), date("2020-01-02"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+	assert.Equal(t, "CHF", rates[0].QuoteCurrency)
+	assert.Equal(t, "0.970696", rates[0].Rate.String())
+	assert.Equal(t, "EUR", rates[1].QuoteCurrency)
+	assert.Equal(t, "0.893416", rates[1].Rate.String())
+	assert.Equal(t, "JPY", rates[2].QuoteCurrency)
+	assert.Equal(t, "108.77334", rates[2].Rate.String())
+
+	rate, err := db.GetLastRate(context.Background(), "sek")
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", rate.BaseCurrency)
+	assert.Equal(t, "9.41", rate.Rate.String())
+
+	// a new day at the top of the ECB file is appended, not a conflict
+	withNewDay := strings.Replace(ecbHistory, "<Cube>\n", "<Cube>\n<Cube time=\"2020-01-06\"><Cube currency=\"USD\" rate=\"1.1194\"/><Cube currency=\"JPY\" rate=\"121.0\"/></Cube>\n", 1)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "eurofxref-hist.xml"), []byte(withNewDay), 0644))
+
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileAppended, reports["eurofxref-hist.xml"].Status)
+	assert.Equal(t, map[string]int{"JPY": 1, "EUR": 1}, reports["eurofxref-hist.xml"].Rows)
+	assert.Equal(t, seeds.FileUnchanged, reports["majors.csv"].Status)
+}
+
+func TestImporter_RejectsForeignBase(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	files := map[string]string{
+		"eur.csv":          "DATE,CHF\n2020-01-06,1.07\n",
+		"CHFEUR.csv":       "DATE,CHFEUR\n2020-01-06,1.07\n",
+		"pairs.csv":        "DATE,CHFUSD,JPYEUR\n2020-01-06,0.97,121.0\n",
+		"rates.ndjson":     `{"date": "2020-01-06", "base_currency": "EUR", "quote_currency": "CHF", "rate": "1.07"}` + "\n" + `{"date": "2020-01-06", "base_currency": "usd", "quote_currency": "CHF", "rate": "0.97"}` + "\n",
+		seeds.ManifestFile: `{"files": [{"path": "eur.csv", "format": "wide-csv", "base_currency": "EUR"}, {"path": "pairs.csv", "format": "wide-csv"}]}`,
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+
+	summary := seeder.Execute()
+	reports := seedReports(summary)
+	assert.Len(t, summary.Failed(), 3)
+	for _, name := range []string{"eur.csv", "CHFEUR.csv", "pairs.csv"} {
+		assert.Equal(t, seeds.FileFailed, reports[name].Status, name)
+		assert.ErrorIs(t, reports[name].Err, seeds.ErrForeignBaseCurrency, name)
+	}
+	assert.Equal(t, map[string]int{"CHF": 1}, reports["rates.ndjson"].Rows)
+	assert.Equal(t, 1, reports["rates.ndjson"].Skipped)
+
+	rate, err := db.GetLastRate(context.Background(), "CHF")
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", rate.BaseCurrency)
+	assert.Equal(t, "0.97", rate.Rate.String())
+}
+
+func TestImporter_ECBDailyFeed(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	day := func(date string, usd string) string {
+		return `<gesmes:Envelope><Cube><Cube time="` + date + `"><Cube currency="USD" rate="` + usd + `"/><Cube currency="JPY" rate="120.5"/></Cube></Cube></gesmes:Envelope>`
+	}
+	path := filepath.Join(dir, "eurofxref-daily.xml")
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+
+	assert.NoError(t, os.WriteFile(path, []byte(day("2020-01-02", "1.1193")), 0644))
+	reports := seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileNew, reports["eurofxref-daily.xml"].Status)
+
+	// the next day replaces the previous one, it is loaded instead of being a conflict
+	assert.NoError(t, os.WriteFile(path, []byte(day("2020-01-03", "1.1147")), 0644))
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileAppended, reports["eurofxref-daily.xml"].Status)
+	assert.NoError(t, reports["eurofxref-daily.xml"].Err)
+
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileUnchanged, reports["eurofxref-daily.xml"].Status)
+
+	rates, err := db.GetRatesInRange(context.Background(), "JPY", date("2020-01-01"), date("2020-01-31"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+
+	// the full history keeps its days, a changed one is still a conflict
+	history := filepath.Join(dir, "eurofxref-hist.xml")
+	assert.NoError(t, os.WriteFile(history, []byte(day("2020-01-02", "1.1193")), 0644))
+	seeder.Execute()
+	assert.NoError(t, os.WriteFile(history, []byte(day("2020-01-03", "1.1147")), 0644))
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileConflict, reports["eurofxref-hist.xml"].Status)
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+func TestMemory_LoadDir(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	assert.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	assert.True(t, db.TableSeeded(context.Background()))
+
+	rate, err := db.GetLastRate(context.Background(), "chf")
+	assert.NoError(t, err)
+	assert.Equal(t, "CHF", rate.QuoteCurrency)
+	assert.Equal(t, "USD", rate.BaseCurrency)
+	assert.Equal(t, "2021-01-29", rate.Date.Format("2006-01-02"))
+	assert.Equal(t, "0.8905", rate.Rate.String())
+
+	rates, err := db.GetRatesInRange(context.Background(), "CHF", date("2016-01-30"), date("2016-02-03"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+	assert.Equal(t, "2016-02-01", rates[0].Date.Format("2006-01-02"))
+
+	rates, err = db.GetAllRatesOnDate(context.Background(), date("2016-04-13"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 8)
+	assert.Equal(t, "CHF", rates[0].QuoteCurrency)
+	assert.Equal(t, "TWD", rates[7].QuoteCurrency)
+}
+
+func TestMemory_CreateRate(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+
+	_, err := db.GetLastRate(context.Background(), "eur")
+	assert.EqualError(t, err, "could not get rate for EUR")
+
+	for _, d := range []string{"2020-01-03", "2020-01-01", "2020-01-02"} {
+		rate := models.CurrencyRate{QuoteCurrency: "eur", Date: date(d), Rate: decimal.RequireFromString("1.1")}
+		assert.NoError(t, db.CreateRate(context.Background(), &rate))
+		assert.NotZero(t, rate.ID)
+	}
+
+	rate := models.CurrencyRate{QuoteCurrency: "EUR", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.2")}
+	assert.ErrorIs(t, db.CreateRate(context.Background(), &rate), database.ErrRateExists)
+	assert.True(t, db.CheckRateQuoteOnDateExists(context.Background(), "eur", date("2020-01-02")))
+	assert.False(t, db.CheckRateQuoteOnDateExists(context.Background(), "eur", date("2020-01-04")))
+
+	rates, err := db.GetRatesInRange(context.Background(), "EUR", date("2019-12-31"), date("2020-01-31"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+	assert.Equal(t, "2020-01-01", rates[0].Date.Format("2006-01-02"))
+	assert.Equal(t, "2020-01-03", rates[2].Date.Format("2006-01-02"))
+}
+
+func TestMemory_Concurrency(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	start := date("2020-01-01")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			rate := models.CurrencyRate{QuoteCurrency: "EUR", Date: start.AddDate(0, 0, i), Rate: decimal.NewFromInt(1)}
+			assert.NoError(t, db.CreateRate(context.Background(), &rate))
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = db.GetRatesInRange(context.Background(), "EUR", start, start.AddDate(0, 2, 0))
+		}()
+	}
+	wg.Wait()
+
+	rates, err := db.GetRatesInRange(context.Background(), "EUR", start, start.AddDate(0, 2, 0))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 50)
+	for i := 1; i < len(rates); i++ {
+		assert.True(t, rates[i-1].Date.Before(rates[i].Date))
+	}
+}
+
+func TestMemory_StreamRatesWithoutLock(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	for _, d := range []string{"2020-01-01", "2020-01-02"} {
+		rate := models.CurrencyRate{QuoteCurrency: "EUR", Date: date(d), Rate: decimal.RequireFromString("1.1")}
+		assert.NoError(t, db.CreateRate(context.Background(), &rate))
+	}
+
+	// a consumer writing while it reads would deadlock if the stream held the lock
+	var streamed []string
+	err := db.StreamRates(context.Background(), []string{"eur"}, date("2020-01-01"), date("2020-01-31"), func(rate models.CurrencyRate) error {
+		streamed = append(streamed, rate.Date.Format("2006-01-02"))
+		next := models.CurrencyRate{QuoteCurrency: "EUR", Date: rate.Date.AddDate(0, 0, 10), Rate: rate.Rate}
+		return db.CreateRate(context.Background(), &next)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020-01-01", "2020-01-02"}, streamed)
+}
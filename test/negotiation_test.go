@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/Shambou/golang-challenge/internal/render"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		format   string
+		expected render.Renderer
+		err      error
+	}{
+		{"", "", render.JSON{}, nil},
+		{"*/*", "", render.JSON{}, nil},
+		{"text/xml", "", render.XML{}, nil},
+		{"text/csv;q=0.5, application/xml", "", render.XML{}, nil},
+		{"application/json;q=0, application/x-msgpack", "", render.MsgPack{}, nil},
+		{"application/xml", "csv", render.CSV{}, nil},
+		{"image/png", "", nil, render.ErrNotAcceptable},
+		{"", "yaml", nil, render.ErrNotAcceptable},
+	}
+
+	for _, test := range tests {
+		renderer, err := render.Negotiate(test.accept, test.format)
+		assert.Equal(t, test.err, err, "accept %q format %q", test.accept, test.format)
+		assert.Equal(t, test.expected, renderer, "accept %q format %q", test.accept, test.format)
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	client := resty.New()
+	query := map[string]string{"quote_currency": "chf", "from": "2016-02-01", "to": "2016-02-02"}
+
+	t.Run("negotiation:xml", func(t *testing.T) {
+		resp, err := client.R().
+			SetHeader("Accept", "application/xml").
+			SetQueryParams(query).
+			Get(BaseUrl + "/range")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "application/xml; charset=UTF-8", resp.Header().Get("Content-Type"))
+
+		var body struct {
+			Message string `xml:"message"`
+			Rates   []struct {
+				Date string `xml:"date"`
+				Rate string `xml:"rate"`
+			} `xml:"data>rates>rate"`
+		}
+		require.NoError(t, xml.Unmarshal(resp.Body(), &body))
+		assert.Equal(t, "Rates CHFUSD in range 2016-02-01:2016-02-02", body.Message)
+		require.Len(t, body.Rates, 2)
+		assert.Equal(t, "1.0202", body.Rates[0].Rate)
+	})
+
+	t.Run("negotiation:csv from format", func(t *testing.T) {
+		resp, err := client.R().
+			SetQueryParams(query).
+			SetQueryParam("format", "csv").
+			Get(BaseUrl + "/range")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "text/csv; charset=UTF-8", resp.Header().Get("Content-Type"))
+		assert.Equal(t, "date,base_currency,quote_currency,rate\n2016-02-01,USD,CHF,1.0202\n2016-02-02,USD,CHF,1.0181\n", string(resp.Body()))
+	})
+
+	t.Run("negotiation:msgpack", func(t *testing.T) {
+		resp, err := client.R().
+			SetHeader("Accept", "application/msgpack").
+			SetQueryParam("quote_currency", "chf").
+			Get(BaseUrl + "/latest")
+
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode())
+
+		var body map[string]interface{}
+		require.NoError(t, msgpack.Unmarshal(resp.Body(), &body))
+		assert.Equal(t, "Last rate for stored for CHFUSD", body["message"])
+		assert.Equal(t, "CHF", body["data"].(map[string]interface{})["quote_currency"])
+	})
+
+	t.Run("negotiation:validation errors as csv", func(t *testing.T) {
+		resp, err := client.R().
+			SetHeader("Accept", "text/csv").
+			SetQueryParams(map[string]string{"quote_currency": "chf", "from": "2016-02-31", "to": "2016-02-02"}).
+			Get(BaseUrl + "/range")
+
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode())
+		assert.Equal(t, "field,error\nfrom,2016-02-31 date is invalid\n", string(resp.Body()))
+	})
+
+	t.Run("negotiation:not acceptable", func(t *testing.T) {
+		resp, err := client.R().
+			SetHeader("Accept", "image/png").
+			SetQueryParam("quote_currency", "chf").
+			Get(BaseUrl + "/latest")
+
+		require.NoError(t, err)
+		assert.Equal(t, 406, resp.StatusCode())
+		assert.Equal(t, "application/json; charset=UTF-8", resp.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,353 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/outbox"
+	"github.com/Shambou/golang-challenge/internal/retention"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// natsMessage - a PUB read by the fake nats server
+type natsMessage struct {
+	Subject string
+	Body    []byte
+}
+
+// newNATSServer - speaks just enough of the nats protocol to take publishes, returns its url
+func newNATSServer(t *testing.T) (string, <-chan natsMessage) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	messages := make(chan natsMessage, 16)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 0:
+					case fields[0] == "PING":
+						_, _ = conn.Write([]byte("PONG\r\n"))
+					case fields[0] == "PUB" && len(fields) == 3:
+						size, _ := strconv.Atoi(fields[2])
+						body := make([]byte, size+2)
+						if _, err = io.ReadFull(reader, body); err != nil {
+							return
+						}
+						messages <- natsMessage{Subject: fields[1], Body: body[:size]}
+					}
+				}
+			}()
+		}
+	}()
+
+	return "nats://" + lis.Addr().String(), messages
+}
+
+func TestOutbox(t *testing.T) {
+	natsURL, published := newNATSServer(t)
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+	t.Setenv("OUTBOX_SINKS", "bus,file,nats")
+	t.Setenv("OUTBOX_FILE", path)
+	t.Setenv("OUTBOX_NATS_URL", natsURL)
+	t.Setenv("OUTBOX_POLL_INTERVAL", "50ms")
+	t.Setenv("OUTBOX_INITIAL_BACKOFF", "10ms")
+
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	require.NotNil(t, h.Outbox)
+	require.NotNil(t, h.Bus)
+
+	// the first try of every chf message fails, it is published again before anything after it
+	var failed int64
+	received := make(chan models.OutboxMessage, 16)
+	h.Bus.Subscribe("rates.CHF", func(ctx context.Context, message models.OutboxMessage) error {
+		if atomic.LoadInt64(&failed) < message.ID {
+			atomic.StoreInt64(&failed, message.ID)
+			return errors.New("not now")
+		}
+		received <- message
+		return nil
+	})
+
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+	client := resty.New()
+	for _, req := range []struct{ method, url, body string }{
+		{"POST", "/api/v1/rates/chf", `{"date": "2015-12-31", "rate": "1.0015"}`},
+		{"POST", "/api/v1/rates/jpy", `{"date": "2015-12-31", "rate": "120.5"}`},
+		{"PUT", "/api/v1/rates/chf", `{"date": "2015-12-31", "rate": "1.002"}`},
+		{"DELETE", "/api/v1/rates/chf/2015-12-31", ""},
+	} {
+		resp, err := client.R().SetBody(req.body).Execute(req.method, ts.URL+req.url)
+		require.NoError(t, err)
+		require.Less(t, resp.StatusCode(), 300, req.method+" "+req.url)
+	}
+
+	for _, want := range []string{models.RateEventCreated, models.RateEventUpdated, models.RateEventDeleted} {
+		message := receive(t, received)
+		assert.Equal(t, want, message.Type)
+		assert.Equal(t, "rates.CHF", message.Topic)
+	}
+
+	var subjects []string
+	for i := 0; i < 4; i++ {
+		subjects = append(subjects, receive(t, published).Subject)
+	}
+	assert.Equal(t, []string{"rates.CHF", "rates.JPY", "rates.CHF", "rates.CHF"}, subjects)
+
+	// the file is written before the offset moves, so it has everything once nats has it too
+	require.Eventually(t, func() bool {
+		content, _ := os.ReadFile(path)
+		return strings.Count(string(content), "\n") == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var first models.OutboxMessage
+	require.NoError(t, json.Unmarshal([]byte(strings.SplitN(string(content), "\n", 2)[0]), &first))
+	assert.Equal(t, models.RateEventCreated, first.Type)
+	assert.JSONEq(t, `{"date": "2015-12-31", "base_currency": "USD", "quote_currency": "CHF", "rate": "1.0015"}`, string(first.Payload))
+}
+
+// slowSink - takes delay for every publish
+type slowSink struct {
+	delay     time.Duration
+	published chan int64
+}
+
+func (s *slowSink) Name() string {
+	return "slow"
+}
+
+func (s *slowSink) Publish(ctx context.Context, message models.OutboxMessage) error {
+	time.Sleep(s.delay)
+	s.published <- message.ID
+	return nil
+}
+
+func TestOutbox_RenewsLeaseDuringBatch(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a batch of five publishes takes twice the lease
+	sink := &slowSink{delay: 40 * time.Millisecond, published: make(chan int64, 16)}
+	config := outbox.DefaultConfig
+	config.Lease = 100 * time.Millisecond
+	relay := outbox.NewRelay(db, nil, config, sink)
+	_, ok, err := db.ClaimOutboxSink(ctx, sink.Name(), relay.Owner, config.Lease)
+	require.NoError(t, err)
+	require.True(t, ok)
+	for _, d := range []string{"2020-01-01", "2020-01-02", "2020-01-03", "2020-01-06", "2020-01-07"} {
+		rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date(d), Rate: decimal.RequireFromString("1.01")}
+		require.NoError(t, db.CreateRate(ctx, &rate))
+	}
+	go relay.Run(ctx)
+
+	// no other process can take the sink over while the relay is still publishing
+	for i := int64(1); i <= 5; i++ {
+		for published := false; !published; {
+			select {
+			case id := <-sink.published:
+				assert.Equal(t, i, id)
+				published = true
+			case <-time.After(10 * time.Millisecond):
+				_, ok, err := db.ClaimOutboxSink(ctx, sink.Name(), "other", config.Lease)
+				require.NoError(t, err)
+				require.False(t, ok, "claimed by another process before message %d", i)
+			}
+		}
+	}
+}
+
+func TestOutbox_BusOffsetPerProcess(t *testing.T) {
+	// the handlers of a bus live in one process, two processes must not share its offset
+	first, second := outbox.NewBus(), outbox.NewBus()
+	assert.True(t, strings.HasPrefix(first.Name(), outbox.SinkBus+":"))
+	assert.NotEqual(t, first.Name(), second.Name())
+}
+
+func TestOutbox_ReleasesBusOffset(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bus := outbox.NewBus()
+	relay := outbox.NewRelay(db, nil, outbox.DefaultConfig, bus)
+	_, ok, err := db.ClaimOutboxSink(ctx, bus.Name(), relay.Owner, time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	done := make(chan struct{}, 1)
+	go func() {
+		relay.Run(ctx)
+		done <- struct{}{}
+	}()
+	cancel()
+	receive(t, done)
+
+	// no process publishes to the bus again, its offset is gone instead of being left behind
+	_, ok, err = db.ClaimOutboxSink(context.Background(), bus.Name(), "other", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRetention(t *testing.T) {
+	sqliteDB := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, sqliteDB.MigrateDB())
+
+	for name, db := range map[string]interface {
+		database.DatabaseRepo
+		database.EventStore
+		database.WebhookStore
+		database.OutboxStore
+		database.Pruner
+	}{
+		"memory": memory.NewMemory(database.BaseCurrency),
+		"sqlite": sqliteDB,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			create := func(d string) {
+				rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date(d), Rate: decimal.RequireFromString("1.01")}
+				require.NoError(t, db.CreateRate(ctx, &rate))
+			}
+			for _, d := range []string{"2020-01-01", "2020-01-02", "2020-01-03"} {
+				create(d)
+			}
+
+			// the file sink published the first message, the stale one belonged to a process that is gone
+			_, ok, err := db.ClaimOutboxSink(ctx, "file", "a", 2*time.Hour)
+			require.NoError(t, err)
+			require.True(t, ok)
+			ok, err = db.SetOutboxOffset(ctx, "file", "a", 1)
+			require.NoError(t, err)
+			require.True(t, ok)
+			_, ok, err = db.ClaimOutboxSink(ctx, "stale", "b", time.Minute)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			// the webhook cursor starts after the third event
+			webhook := models.Webhook{URL: "http://localhost/hook", Secret: "s3cret", Currencies: []string{"CHF"}}
+			require.NoError(t, db.CreateWebhook(ctx, &webhook))
+			create("2020-01-06")
+
+			// nothing is old enough yet
+			job := retention.NewJob(db, 30*time.Minute, time.Hour)
+			require.NoError(t, job.Prune(ctx))
+			events, err := db.EventsSince(ctx, 0, nil, 10)
+			require.NoError(t, err)
+			assert.Len(t, events, 4)
+
+			job.Now = func() time.Time { return time.Now().Add(time.Hour) }
+			require.NoError(t, job.Prune(ctx))
+			events, err = db.EventsSince(ctx, 0, nil, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, int64(4), events[0].ID)
+			messages, err := db.OutboxSince(ctx, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, messages, 3)
+			assert.Equal(t, int64(2), messages[0].ID)
+
+			// the offset of the stale sink is gone, claimed again it starts after the newest message
+			offset, ok, err := db.ClaimOutboxSink(ctx, "stale", "c", time.Minute)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, int64(4), offset)
+
+			// ids aren't handed out again
+			create("2020-01-07")
+			events, err = db.EventsSince(ctx, 4, nil, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, int64(5), events[0].ID)
+			messages, err = db.OutboxSince(ctx, 4, 10)
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+			assert.Equal(t, int64(5), messages[0].ID)
+		})
+	}
+}
+
+func TestSQLite_Outbox(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	require.NoError(t, db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")},
+	}))
+
+	// a new sink skips what is already there
+	offset, ok, err := db.ClaimOutboxSink(ctx, "file", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), offset)
+
+	rate := models.CurrencyRate{QuoteCurrency: "chf", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.0202")}
+	require.NoError(t, db.CreateRate(ctx, &rate))
+	rate.Rate = decimal.RequireFromString("1.03")
+	require.NoError(t, db.UpdateRate(ctx, &rate))
+	require.NoError(t, db.DeleteRate(ctx, "CHF", date("2020-01-02")))
+
+	messages, err := db.OutboxSince(ctx, offset, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	for i, want := range []string{models.RateEventCreated, models.RateEventUpdated, models.RateEventDeleted} {
+		assert.Equal(t, want, messages[i].Type)
+		assert.Equal(t, "rates.CHF", messages[i].Topic)
+	}
+	assert.JSONEq(t, `{"date": "2020-01-02", "base_currency": "USD", "quote_currency": "CHF", "rate": "1.03"}`, string(messages[1].Payload))
+
+	// the sink stays with its owner while the lease runs
+	_, ok, err = db.ClaimOutboxSink(ctx, "file", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = db.SetOutboxOffset(ctx, "file", "b", messages[2].ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = db.SetOutboxOffset(ctx, "file", "a", messages[2].ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	offset, ok, err = db.ClaimOutboxSink(ctx, "file", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, messages[2].ID, offset)
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	postgres "github.com/Shambou/golang-challenge/internal/database/postgres"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachablePostgres - points the postgres client at a port nothing listens on
+func unreachablePostgres(t *testing.T) *postgres.Database {
+	t.Setenv("DB_HOST", "127.0.0.1")
+	t.Setenv("DB_PORT", "1")
+	t.Setenv("SSL_MODE", "disable")
+
+	return postgres.NewDatabase()
+}
+
+func TestPostgres_ConnectGivesUpAtDeadline(t *testing.T) {
+	db := unreachablePostgres(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := db.Connect(ctx, postgres.RetryConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestPostgres_NotReadyWhileUnreachable(t *testing.T) {
+	h := server.NewHandler(unreachablePostgres(t), file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	// stops the listener retrying the connection
+	defer h.Close()
+	ts := httptest.NewServer(h.Router)
+	defer ts.Close()
+
+	resp, err := resty.New().R().Get(ts.URL + "/ready")
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode())
+}
+
+func TestPostgres_ConnectWithoutBackoff(t *testing.T) {
+	db := unreachablePostgres(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// the default backoff is used instead, so there are a couple of attempts instead of thousands
+	err := db.Connect(ctx, postgres.RetryConfig{})
+	assert.ErrorContains(t, err, "after 1 attempts")
+}
+
+func TestReadyAfterSetup(t *testing.T) {
+	h := server.NewHandler(memory.NewMemory(database.BaseCurrency), file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	defer h.Close()
+	setup := make(chan struct{})
+	h.Setup = setup
+	ts := httptest.NewServer(h.Router)
+	defer ts.Close()
+
+	resp, err := resty.New().R().Get(ts.URL + "/ready")
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode())
+
+	close(setup)
+	resp, err = resty.New().R().Get(ts.URL + "/ready")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode())
+}
+
+// newPostgres - the migrated database of the DB_ environment without rates, events and outbox messages, the test
+// is skipped when DB_HOST is unset
+func newPostgres(t *testing.T) *postgres.Database {
+	if os.Getenv("DB_HOST") == "" {
+		t.Skip("DB_HOST is not set")
+	}
+	db := postgres.NewDatabase()
+	t.Cleanup(func() { db.Client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, db.Connect(ctx, postgres.RetryConfig{}))
+	if err := db.MigrateDB(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		require.NoError(t, err)
+	}
+	_, err := db.Client.Exec(`truncate currency_rates, rate_events, rate_events_pending, outbox, outbox_pending,
+		outbox_offsets restart identity cascade`)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestPostgres_RateTriggers(t *testing.T) {
+	db := newPostgres(t)
+	ctx := context.Background()
+
+	rate := &models.CurrencyRate{QuoteCurrency: "CHF", Rate: decimal.RequireFromString("0.99"), Date: date("2016-01-01")}
+	require.NoError(t, db.CreateRate(ctx, rate))
+	rate.Rate = decimal.RequireFromString("0.98")
+	require.NoError(t, db.UpdateRate(ctx, rate))
+	require.NoError(t, db.DeleteRate(ctx, "CHF", date("2016-01-01")))
+	// only mid rates are recorded
+	require.NoError(t, db.CreateRate(ctx, &models.CurrencyRate{QuoteCurrency: "CHF", Rate: decimal.RequireFromString("0.97"), Date: date("2016-01-01"), Type: models.RateBid}))
+
+	events, err := db.EventsSince(ctx, 0, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	for i, want := range []struct{ typ, rate string }{{"rate.created", "0.99"}, {"rate.updated", "0.98"}, {"rate.deleted", "0.98"}} {
+		assert.Equal(t, int64(i+1), events[i].ID)
+		assert.Equal(t, want.typ, events[i].Type)
+		assert.Equal(t, "CHF", events[i].QuoteCurrency)
+		assert.Equal(t, want.rate, events[i].Rate.String())
+	}
+	lastID, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), lastID)
+
+	messages, err := db.OutboxSince(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "rates.CHF", messages[0].Topic)
+	assert.Equal(t, "rate.created", messages[0].Type)
+	assert.JSONEq(t, `{"date": "2016-01-01", "base_currency": "USD", "quote_currency": "CHF", "rate": "0.99"}`, string(messages[0].Payload))
+	assert.Equal(t, "rate.deleted", messages[2].Type)
+}
+
+func TestPostgres_RateChangeNotifications(t *testing.T) {
+	db := newPostgres(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan *models.RateChange, 16)
+	probes := make(chan struct{}, 1)
+	go db.ListenForChanges(ctx, func(change *models.RateChange) {
+		switch {
+		case change == nil:
+		case change.Type == "probe":
+			select {
+			case probes <- struct{}{}:
+			default:
+			}
+		default:
+			changes <- change
+		}
+	})
+
+	// the listener connects in the background, notifications sent before it listens are lost
+	for listening := false; !listening; {
+		_, err := db.Client.Exec(`select pg_notify('rate_changes', '{"type": "probe", "quote_currency": "XXX", "date": "2016-01-01"}')`)
+		require.NoError(t, err)
+		select {
+		case <-probes:
+			listening = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// one notification per statement and currency
+	require.NoError(t, db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: decimal.RequireFromString("0.99"), Date: date("2016-01-01")},
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: decimal.RequireFromString("0.98"), Date: date("2016-01-04")},
+		{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: decimal.RequireFromString("120"), Date: date("2016-01-04")},
+	}))
+	assert.ElementsMatch(t, []models.RateChange{
+		{Type: "rate.created", QuoteCurrency: "CHF", Date: date("2016-01-01"), To: date("2016-01-04")},
+		{Type: "rate.created", QuoteCurrency: "JPY", Date: date("2016-01-04"), To: date("2016-01-04")},
+	}, []models.RateChange{*receive(t, changes), *receive(t, changes)})
+
+	require.NoError(t, db.DeleteRate(ctx, "JPY", date("2016-01-04")))
+	assert.Equal(t, models.RateChange{Type: "rate.deleted", QuoteCurrency: "JPY", Date: date("2016-01-04"), To: date("2016-01-04")}, *receive(t, changes))
+}
+
+func TestPostgres_EventsInCommitOrder(t *testing.T) {
+	db := newPostgres(t)
+	ctx := context.Background()
+
+	tx, err := db.Client.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("insert into currency_rates (base_currency, quote_currency, rate, date) values ('USD', 'JPY', 120, '2016-01-04')")
+	require.NoError(t, err)
+
+	// writers don't wait for each other
+	writeCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	require.NoError(t, db.CreateRate(writeCtx, &models.CurrencyRate{QuoteCurrency: "CHF", Rate: decimal.RequireFromString("0.99"), Date: date("2016-01-04")}))
+
+	// the CHF event waits for the transaction that started before it
+	events, err := db.EventsSince(ctx, 0, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	messages, err := db.OutboxSince(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	require.NoError(t, tx.Commit())
+	events, err = db.EventsSince(ctx, 0, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "JPY", events[0].QuoteCurrency)
+	assert.Equal(t, "CHF", events[1].QuoteCurrency)
+	assert.Less(t, events[0].ID, events[1].ID)
+	messages, err = db.OutboxSince(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/provider"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/2022-06-04", r.URL.Path)
+		assert.Equal(t, "USD", r.URL.Query().Get("base"))
+		assert.Equal(t, "CHF,JPY", r.URL.Query().Get("symbols"))
+
+		// a saturday gets the rates of friday
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"base": "USD", "date": "2022-06-03", "rates": {"CHF": 0.95910, "JPY": 130.84, "EUR": 0.93}}`))
+	}))
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	rates, err := provider.NewHTTPProvider(ts.URL, "secret", time.Second).FetchRates(ctx, "USD", []string{"chf", "JPY"}, date("2022-06-04"))
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, "CHF", rates[0].QuoteCurrency)
+	assert.Equal(t, "USD", rates[0].BaseCurrency)
+	assert.Equal(t, "0.9591", rates[0].Rate.String())
+	assert.Equal(t, "2022-06-03", rates[0].Date.Format("2006-01-02"))
+	assert.Equal(t, "130.84", rates[1].Rate.String())
+
+	_, err = provider.NewHTTPProvider(ts.URL, "", time.Second).FetchRates(ctx, "USD", []string{"CHF"}, date("2022-06-04"))
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestScheduler_Fetch(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	ctx := context.Background()
+
+	stub := provider.NewStub(map[string]decimal.Decimal{
+		"CHF": decimal.RequireFromString("0.9591"),
+		"JPY": decimal.RequireFromString("-1"),
+		"EUR": decimal.RequireFromString("0.93"),
+	})
+	scheduler := provider.NewScheduler(stub, db, provider.Config{Currencies: []string{"CHF", "JPY", "KRW"}})
+
+	// the negative rate is rejected, KRW has none and EUR wasn't asked for
+	result, err := scheduler.Fetch(ctx, date("2022-06-03"))
+	require.NoError(t, err)
+	assert.Equal(t, provider.Result{Stored: 1, Invalid: 1}, result)
+
+	result, err = scheduler.Fetch(ctx, date("2022-06-03"))
+	require.NoError(t, err)
+	assert.Equal(t, provider.Result{Existing: 1, Invalid: 1}, result)
+
+	rate, err := db.GetLastRate(ctx, "CHF")
+	require.NoError(t, err)
+	assert.Equal(t, "2022-06-03", rate.Date.Format("2006-01-02"))
+	assert.Equal(t, "0.9591", rate.Rate.String())
+
+	// without configured currencies the ones in the store are fetched
+	scheduler.Config.Currencies = nil
+	result, err = scheduler.Fetch(ctx, date("2022-06-06"))
+	require.NoError(t, err)
+	assert.Equal(t, provider.Result{Stored: 1, Invalid: 1}, result)
+
+	// future dates are rejected like POSTed ones
+	result, err = scheduler.Fetch(ctx, time.Now().AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Stored)
+}
+
+func TestScheduler_Next(t *testing.T) {
+	scheduler := provider.NewScheduler(provider.NewStub(nil), nil, provider.DefaultConfig)
+
+	morning := time.Date(2022, 6, 3, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2022, 6, 3, 16, 30, 0, 0, time.UTC), scheduler.Next(morning))
+	assert.Equal(t, time.Date(2022, 6, 4, 16, 30, 0, 0, time.UTC), scheduler.Next(morning.Add(7*time.Hour+30*time.Minute)))
+}
+
+// countingProvider - a stub that counts its fetches and fails the first ones
+type countingProvider struct {
+	*provider.Stub
+	fetches  int32
+	failures int32
+}
+
+func (p *countingProvider) FetchRates(ctx context.Context, base string, currencies []string, date time.Time) ([]models.CurrencyRate, error) {
+	if atomic.AddInt32(&p.fetches, 1) <= p.failures {
+		return nil, errors.New("upstream is down")
+	}
+
+	return p.Stub.FetchRates(ctx, base, currencies, date)
+}
+
+func TestScheduler_OneReplicaFetches(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first fetch fails, the replica holding the day tries again and the other one leaves it alone
+	p := &countingProvider{Stub: provider.NewStub(map[string]decimal.Decimal{"CHF": decimal.RequireFromString("0.9591")}), failures: 1}
+	config := provider.Config{Currencies: []string{"CHF"}, At: provider.DefaultConfig.At, RetryInterval: 10 * time.Millisecond, Lease: time.Minute}
+	for i := 0; i < 2; i++ {
+		scheduler := provider.NewScheduler(p, db, config)
+		scheduler.Runs = db
+		scheduler.Now = func() time.Time { return time.Date(2022, 6, 3, 9, 0, 0, 0, time.UTC) }
+		go scheduler.Run(ctx)
+	}
+
+	require.Eventually(t, func() bool {
+		return db.CheckRateQuoteOnDateExists(context.Background(), "CHF", date("2022-06-03"))
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&p.fetches))
+}
+
+func TestProviderRuns(t *testing.T) {
+	sqliteDB := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, sqliteDB.MigrateDB())
+
+	for name, runs := range map[string]database.ProviderRunStore{
+		"memory": memory.NewMemory(database.BaseCurrency),
+		"sqlite": sqliteDB,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			day := date("2022-06-03")
+
+			ok, done, err := runs.ClaimProviderRun(ctx, "stub", day, "a", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, done)
+
+			// a holds the day, b has to wait, a can claim it again to retry
+			ok, done, err = runs.ClaimProviderRun(ctx, "stub", day, "b", time.Minute)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.False(t, done)
+			ok, _, err = runs.ClaimProviderRun(ctx, "stub", day, "a", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			// once a finished the day nobody fetches it again, not even a day before
+			require.NoError(t, runs.FinishProviderRun(ctx, "stub", day, "a"))
+			for _, claim := range []struct {
+				owner string
+				day   time.Time
+			}{{"a", day}, {"b", day}, {"b", day.AddDate(0, 0, -1)}} {
+				ok, done, err = runs.ClaimProviderRun(ctx, "stub", claim.day, claim.owner, time.Minute)
+				require.NoError(t, err)
+				assert.False(t, ok)
+				assert.True(t, done)
+			}
+
+			// the next day is claimed anew, when the lease of its owner ran out another one takes over
+			ok, _, err = runs.ClaimProviderRun(ctx, "stub", day.AddDate(0, 0, 1), "b", -time.Second)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, _, err = runs.ClaimProviderRun(ctx, "stub", day.AddDate(0, 0, 1), "a", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			require.NoError(t, runs.FinishProviderRun(ctx, "stub", day.AddDate(0, 0, 1), "b"))
+			_, done, err = runs.ClaimProviderRun(ctx, "stub", day.AddDate(0, 0, 1), "b", time.Minute)
+			require.NoError(t, err)
+			assert.False(t, done, "only the owner finishes a day")
+
+			// other providers are claimed on their own
+			ok, _, err = runs.ClaimProviderRun(ctx, "http", day, "b", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/objects"
+	"github.com/Shambou/golang-challenge/internal/rpc/ratespb"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateTypes(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	srv := httptest.NewServer(h.Router)
+	t.Cleanup(srv.Close)
+	ts := srv.URL + "/api/v1/rates"
+	client := resty.New()
+	ctx := context.Background()
+
+	lastEventID, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+
+	for _, body := range []string{
+		`{"date": "2015-12-29", "rate": "0.99", "type": "bid"}`,
+		`{"date": "2015-12-29", "rate": "1.01", "type": "ask"}`,
+		`{"date": "2015-12-30", "rate": "0.98", "type": "bid"}`,
+		`{"date": "2015-12-30", "rate": "0.99", "type": "ask"}`,
+		`{"date": "2015-12-31", "rate": "0.97", "type": "bid"}`,
+	} {
+		resp, err := client.R().SetBody(body).Post(ts + "/chf")
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode(), resp.String())
+	}
+
+	// every type has its own rate per date, unknown types are rejected
+	resp, err := client.R().SetBody(`{"date": "2015-12-31", "rate": "0.96", "type": "bid"}`).Post(ts + "/chf")
+	require.NoError(t, err)
+	assert.Equal(t, 422, resp.StatusCode())
+	resp, err = client.R().SetBody(`{"date": "2015-12-31", "rate": "0.96", "type": "spot"}`).Post(ts + "/chf")
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode())
+
+	// only mid rates are published as events
+	id, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, lastEventID, id)
+
+	var latest struct {
+		Data objects.BaseRateResponse `json:"data"`
+	}
+	resp, err = client.R().SetResult(&latest).Get(ts + "/latest?quote_currency=chf&type=bid")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, objects.BaseRateResponse{Date: "2015-12-31", BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: "0.9700", Type: models.RateBid}, latest.Data)
+
+	// csv gets a type column only for the types that aren't mid
+	resp, err = client.R().SetHeader("Accept", "text/csv").Get(ts + "/latest?quote_currency=chf&type=bid")
+	require.NoError(t, err)
+	assert.Equal(t, "date,base_currency,quote_currency,rate,type\n2015-12-31,USD,CHF,0.9700,bid\n", string(resp.Body()))
+
+	resp, err = client.R().SetResult(&latest).Get(ts + "/latest?quote_currency=chf")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, models.RateMid, latest.Data.Type)
+	assert.NotEqual(t, "2015-12-31", latest.Data.Date)
+
+	resp, err = client.R().Get(ts + "/latest?quote_currency=chf&type=spot")
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode())
+
+	var history struct {
+		Data objects.RangeRatesResponse `json:"data"`
+	}
+	resp, err = client.R().SetResult(&history).Get(ts + "/range?quote_currency=chf&from=2015-12-01&to=2015-12-31&type=ask")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, models.RateAsk, history.Data.Type)
+	assert.Equal(t, objects.JsonDateRateResponses{{Date: "2015-12-29", Rate: "1.0100"}, {Date: "2015-12-30", Rate: "0.9900"}}, history.Data.Rates)
+
+	var onDate struct {
+		Data objects.QuoteRatesResponse `json:"data"`
+	}
+	resp, err = client.R().SetResult(&onDate).Get(ts + "/timeseries?date=2015-12-31&type=bid")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, objects.JsonQuoteRateResponses{{QuoteCurrency: "CHF", Rate: "0.9700"}}, onDate.Data.Rates)
+
+	// the last date has no ask so it has no spread
+	var spreads struct {
+		Data objects.SpreadResponse `json:"data"`
+	}
+	resp, err = client.R().SetResult(&spreads).Get(ts + "/spread?quote_currency=chf&from=2015-12-01&to=2015-12-31")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, objects.SpreadResponse{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "CHF",
+		Spreads: []objects.JsonSpreadResponse{
+			{Date: "2015-12-29", Bid: "0.99", Ask: "1.01", Spread: "0.02", SpreadPercent: "2.0000"},
+			{Date: "2015-12-30", Bid: "0.98", Ask: "0.99", Spread: "0.01", SpreadPercent: "1.0152"},
+		},
+		Average: "1.5076",
+	}, spreads.Data)
+
+	resp, err = client.R().SetBody(`{"date": "2015-12-30", "rate": "0.985", "type": "bid"}`).Put(ts + "/chf")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode(), resp.String())
+	resp, err = client.R().Delete(ts + "/chf/2015-12-30?type=ask")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	resp, err = client.R().Delete(ts + "/chf/2015-12-30?type=ask")
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode())
+
+	resp, err = client.R().SetResult(&spreads).Get(ts + "/spread?quote_currency=chf&from=2015-12-01&to=2015-12-31")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Len(t, spreads.Data.Spreads, 1)
+
+	// the fxdata files only have mid rates
+	resp, err = client.R().Get(ts + "/file/latest?quote_currency=chf&type=bid")
+	require.NoError(t, err)
+	assert.Equal(t, 501, resp.StatusCode())
+
+	// gRPC and GraphQL reads take the same types
+	rates := ratesClientOf(t, db)
+	rate, err := rates.GetLatestRate(ctx, &ratespb.GetLatestRateRequest{QuoteCurrency: "chf", Type: models.RateBid})
+	require.NoError(t, err)
+	assert.Equal(t, &ratespb.Rate{Date: "2015-12-31", BaseCurrency: "USD", QuoteCurrency: "CHF", Rate: "0.97", Type: models.RateBid}, proto(rate))
+	rangeResp, err := rates.GetRatesInRange(ctx, &ratespb.GetRatesInRangeRequest{QuoteCurrency: "chf", From: "2015-12-01", To: "2015-12-31", Type: models.RateAsk})
+	require.NoError(t, err)
+	require.Len(t, rangeResp.Rates, 1)
+	assert.Equal(t, "1.01", rangeResp.Rates[0].Rate)
+	_, err = rates.GetTimeseries(ctx, &ratespb.GetTimeseriesRequest{Date: "2015-12-31", Type: "spot"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	result := graphqlQuery(t, srv.URL+"/graphql", `{
+		latest(currencies: ["CHF"], type: "bid") { date rate type }
+		currency(code: "chf") { asOf(date: "2015-12-30", type: "ask") { rate type } range(from: "2015-12-29", to: "2015-12-31", type: "bid") { rate } }
+	}`)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{
+		"latest": [{"date": "2015-12-31", "rate": "0.97", "type": "bid"}],
+		"currency": {"asOf": {"rate": "1.01", "type": "ask"}, "range": [{"rate": "0.99"}, {"rate": "0.985"}, {"rate": "0.97"}]}
+	}`, string(result.Data))
+	result = graphqlQuery(t, srv.URL+"/graphql", `{ latest(currencies: ["CHF"], type: "spot") { rate } }`)
+	assert.NotEmpty(t, result.Errors)
+}
+
+func TestSQLite_RateTypes(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	require.NoError(t, db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")},
+	}))
+	lastEventID, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+
+	for _, rate := range []models.CurrencyRate{
+		{QuoteCurrency: "chf", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.02"), Type: models.RateBid},
+		{QuoteCurrency: "chf", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.03"), Type: models.RateAsk},
+		{QuoteCurrency: "chf", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.025"), Type: models.RateFixing},
+	} {
+		require.NoError(t, db.CreateRate(ctx, &rate))
+	}
+	bid := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.01"), Type: models.RateBid}
+	assert.ErrorIs(t, db.CreateRate(ctx, &bid), database.ErrRateExists)
+	require.NoError(t, db.UpdateRate(ctx, &bid))
+
+	// the mid rate and its events are left alone
+	rate, err := db.GetLastRate(ctx, "CHF")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0226", rate.Rate.String())
+	assert.Equal(t, models.RateMid, rate.Type)
+	id, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, lastEventID, id)
+	messages, err := db.OutboxSince(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	rate, err = db.GetLastRateOfType(ctx, "chf", models.RateFixing)
+	require.NoError(t, err)
+	assert.Equal(t, "2020-01-02", rate.Date.Format("2006-01-02"))
+	rates, err := db.GetRatesInRangeOfType(ctx, "CHF", date("2020-01-01"), date("2020-01-31"), models.RateBid)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	assert.Equal(t, "1.01", rates[0].Rate.String())
+	rates, err = db.GetAllRatesOnDateOfType(ctx, date("2020-01-01"), models.RateAsk)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	assert.Equal(t, "1.03", rates[0].Rate.String())
+
+	var streamed []string
+	require.NoError(t, db.StreamRatesOfType(ctx, nil, date("2020-01-01"), date("2020-01-31"), models.RateBid, func(rate models.CurrencyRate) error {
+		streamed = append(streamed, rate.Type+":"+rate.Rate.String())
+		return nil
+	}))
+	assert.Equal(t, []string{"bid:1.01"}, streamed)
+
+	require.NoError(t, db.DeleteRateOfType(ctx, "CHF", date("2020-01-01"), models.RateAsk))
+	assert.ErrorIs(t, db.DeleteRateOfType(ctx, "CHF", date("2020-01-01"), models.RateAsk), database.ErrRateNotFound)
+	assert.True(t, db.CheckRateQuoteOnDateExists(ctx, "CHF", date("2020-01-01")))
+	assert.False(t, db.CheckRateQuoteOnDateExists(ctx, "CHF", date("2020-01-02")))
+}
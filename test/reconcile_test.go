@@ -0,0 +1,293 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/provider"
+	"github.com/Shambou/golang-challenge/internal/reconcile"
+	"github.com/Shambou/golang-challenge/internal/rpc/ratespb"
+	"github.com/Shambou/golang-challenge/internal/seeds"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func sourceValues(values ...string) []models.SourceRate {
+	rates := make([]models.SourceRate, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		rates = append(rates, models.SourceRate{Source: values[i], Rate: decimal.RequireFromString(values[i+1])})
+	}
+
+	return rates
+}
+
+func TestResolve(t *testing.T) {
+	tolerance := decimal.RequireFromString("0.01")
+	values := sourceValues("ecb", "1.02", "api", "1.00", "fed", "1.01", "boe", "1.03")
+
+	decision := reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyPriority, Priority: []string{"fed", "ecb"}, Tolerance: tolerance}, values)
+	assert.Equal(t, "1.01", decision.Rate.String())
+	assert.Equal(t, "fed", decision.Source)
+	assert.Equal(t, "0.03", decision.Spread.String())
+	assert.True(t, decision.Disagree)
+
+	// unlisted sources come in alphabetical order
+	decision = reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyPriority, Tolerance: tolerance}, values)
+	assert.Equal(t, "api", decision.Source)
+
+	decision = reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyMedian, Tolerance: tolerance}, values)
+	assert.Equal(t, "1.015", decision.Rate.String())
+	assert.Equal(t, reconcile.SourceMedian, decision.Source)
+
+	decision = reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyReject, Tolerance: tolerance}, values)
+	assert.True(t, decision.Rejected)
+
+	decision = reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyReject, Tolerance: tolerance}, sourceValues("ecb", "1.02", "fed", "1.025", "boe", "1.021"))
+	assert.False(t, decision.Rejected)
+	assert.False(t, decision.Disagree)
+	assert.Equal(t, "1.021", decision.Rate.String())
+
+	// the median of two values is rounded like the stored rate
+	decision = reconcile.Resolve(reconcile.Config{Policy: reconcile.PolicyMedian, Tolerance: tolerance}, sourceValues("ecb", "1.000001", "fed", "1.000002"))
+	assert.Equal(t, "1.000002", decision.Rate.String())
+}
+
+func TestReconciliation(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	require.NotNil(t, h.Reconciler)
+	srv := httptest.NewServer(h.Router)
+	t.Cleanup(srv.Close)
+	ts := srv.URL
+	client := resty.New()
+	ctx := context.Background()
+
+	resp, err := client.R().SetBody(`{"date": "2022-06-03", "rate": "1.0"}`).Post(ts + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode())
+
+	fetch := func(source string, rates map[string]string) provider.Result {
+		stub := provider.NewStub(map[string]decimal.Decimal{})
+		for currency, rate := range rates {
+			stub.Rates[currency] = decimal.RequireFromString(rate)
+		}
+		scheduler := provider.NewScheduler(namedProvider{stub, source}, h.DB, provider.Config{Currencies: []string{"CHF", "JPY"}})
+		scheduler.Reconciler = h.Reconciler
+		result, err := scheduler.Fetch(ctx, date("2022-06-03"))
+		require.NoError(t, err)
+		return result
+	}
+
+	// the api value has priority over the providers
+	assert.Equal(t, provider.Result{Stored: 1, Existing: 1}, fetch("ecb", map[string]string{"CHF": "0.95", "JPY": "130.8"}))
+	assert.Equal(t, provider.Result{Existing: 2}, fetch("fed", map[string]string{"CHF": "1.0", "JPY": "130.9"}))
+
+	// with the median the published rates follow the sources
+	h.Reconciler.Config.Policy = reconcile.PolicyMedian
+	assert.Equal(t, provider.Result{Stored: 1, Existing: 1}, fetch("fed", map[string]string{"CHF": "1.0", "JPY": "130.9"}))
+	rate, err := h.DB.GetLastRate(ctx, "CHF")
+	require.NoError(t, err)
+	assert.Equal(t, "1", rate.Rate.String())
+	rate, err = h.DB.GetLastRate(ctx, "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "130.85", rate.Rate.String())
+
+	// the report lists the currencies whose sources disagree by more than 1%
+	var report struct {
+		Data []struct {
+			QuoteCurrency string `json:"quote_currency"`
+			Published     string `json:"published"`
+			Reconciled    string `json:"reconciled"`
+			Spread        string `json:"spread"`
+			Sources       []struct {
+				Source string `json:"source"`
+				Rate   string `json:"rate"`
+			} `json:"sources"`
+		} `json:"data"`
+	}
+	resp, err = client.R().SetResult(&report).Get(ts + "/api/v1/reconciliation?currencies=chf,jpy&from=2022-06-01&to=2022-06-30")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	require.Len(t, report.Data, 1)
+	assert.Equal(t, "CHF", report.Data[0].QuoteCurrency)
+	assert.Equal(t, "1", report.Data[0].Published)
+	assert.Equal(t, "0.05263158", report.Data[0].Spread)
+	require.Len(t, report.Data[0].Sources, 3)
+	assert.Equal(t, "api", report.Data[0].Sources[0].Source)
+	assert.Equal(t, "0.95", report.Data[0].Sources[1].Rate)
+
+	// rejected sources leave the published rate alone
+	h.Reconciler.Config.Policy = reconcile.PolicyReject
+	assert.Equal(t, provider.Result{Rejected: 1, Existing: 1}, fetch("fed", map[string]string{"CHF": "1.0", "JPY": "130.9"}))
+
+	resp, err = client.R().Get(ts + "/api/v1/reconciliation?from=2022-06-01")
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode())
+}
+
+func TestReconciliation_APIWrites(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	defer h.Close()
+	srv := httptest.NewServer(h.Router)
+	t.Cleanup(srv.Close)
+	client := resty.New()
+	grpcClient := serveRates(t, h.GRPC)
+	ctx := context.Background()
+
+	stored, err := grpcClient.StoreRate(ctx, &ratespb.StoreRateRequest{QuoteCurrency: "chf", Date: "2022-06-03", Rate: "1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", stored.Rate)
+	_, err = grpcClient.StoreRate(ctx, &ratespb.StoreRateRequest{QuoteCurrency: "CHF", Date: "2022-06-03", Rate: "1.1"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// the value stored over gRPC is the one of the api source, which has priority over the provider
+	stub := provider.NewStub(map[string]decimal.Decimal{"CHF": decimal.RequireFromString("0.95")})
+	scheduler := provider.NewScheduler(namedProvider{stub, "ecb"}, h.DB, provider.Config{Currencies: []string{"CHF"}})
+	scheduler.Reconciler = h.Reconciler
+	result, err := scheduler.Fetch(ctx, date("2022-06-03"))
+	require.NoError(t, err)
+	assert.Equal(t, provider.Result{Existing: 1}, result)
+	rate, err := h.DB.GetLastRate(ctx, "CHF")
+	require.NoError(t, err)
+	assert.Equal(t, "1", rate.Rate.String())
+
+	// a PUT is reconciled with the provider's value as well
+	h.Reconciler.Config.Policy = reconcile.PolicyMedian
+	var updated struct {
+		Data struct {
+			Rate string `json:"rate"`
+		} `json:"data"`
+	}
+	resp, err := client.R().SetBody(`{"date": "2022-06-03", "rate": "0.97"}`).SetResult(&updated).Put(srv.URL + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode(), resp.String())
+	assert.Equal(t, "0.9600", updated.Data.Rate)
+	resp, err = client.R().SetBody(`{"date": "2022-06-06", "rate": "0.97"}`).Put(srv.URL + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode())
+
+	// sources too far apart leave the published rate alone
+	h.Reconciler.Config.Policy = reconcile.PolicyReject
+	resp, err = client.R().SetBody(`{"date": "2022-06-03", "rate": "1.2"}`).Put(srv.URL + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode())
+	rates, err := h.DB.GetRatesInRange(ctx, "CHF", date("2022-06-03"), date("2022-06-03"))
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	assert.Equal(t, "0.96", rates[0].Rate.String())
+
+	values, err := db.SourceRates(ctx, []string{"CHF"}, date("2022-06-03"), date("2022-06-03"))
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	assert.Equal(t, models.SourceAPI, values[0].Source)
+	assert.Equal(t, "1.2", values[0].Rate.String())
+}
+
+// namedProvider - a provider under another source name
+type namedProvider struct {
+	provider.RateProvider
+	name string
+}
+
+func (n namedProvider) Name() string {
+	return n.name
+}
+
+func TestSQLite_SourceRates(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	// two imports of the same rates, the first one loaded is published
+	for name, content := range map[string]string{
+		"a/CHFUSD.csv": "DATE,CHFUSD\n2020-01-01,1.01\n2020-01-02,1.02\n",
+		"b/CHFUSD.csv": "DATE,CHFUSD\n2020-01-02,1.03\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+	seeder.Workers = 1
+	seeder.Execute()
+
+	require.NoError(t, db.SaveSourceRates(ctx, []models.SourceRate{
+		{Source: "ecb", QuoteCurrency: "chf", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.5")},
+		{Source: "ecb", QuoteCurrency: "CHF", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.025")},
+		{Source: "ecb", QuoteCurrency: "JPY", Date: date("2020-01-02"), Rate: decimal.RequireFromString("108.5")},
+	}))
+
+	values, err := db.SourceRates(ctx, []string{"chf"}, date("2020-01-02"), date("2020-01-31"))
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	assert.Equal(t, []string{"ecb", "import:a/CHFUSD.csv", "import:b/CHFUSD.csv"}, []string{values[0].Source, values[1].Source, values[2].Source})
+	assert.Equal(t, "1.025", values[0].Rate.String())
+	assert.Equal(t, "USD", values[0].BaseCurrency)
+	assert.Equal(t, "2020-01-02", values[0].Date.Format("2006-01-02"))
+
+	all, err := db.SourceRates(ctx, nil, date("2020-01-01"), date("2020-01-31"))
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	reconciler := reconcile.NewReconciler(db, db, reconcile.DefaultConfig)
+	disagreements, err := reconciler.Report(ctx, nil, date("2020-01-01"), date("2020-01-31"))
+	require.NoError(t, err)
+	// the published chf rate isn't the one of the highest priority source and jpy has none published
+	require.Len(t, disagreements, 2)
+	assert.Equal(t, "1.02", disagreements[0].Published.String())
+	assert.Equal(t, "ecb", disagreements[0].Decision.Source)
+	assert.False(t, disagreements[0].Decision.Disagree)
+	assert.Equal(t, "JPY", disagreements[1].QuoteCurrency)
+	assert.Nil(t, disagreements[1].Published)
+}
+
+func TestSeeder_SubmitsToReconciler(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	for name, content := range map[string]string{
+		"a/CHFUSD.csv": "DATE,CHFUSD\n2020-01-01,1.01\n2020-01-02,1.02\n",
+		"b/CHFUSD.csv": "DATE,CHFUSD\n2020-01-02,1.03\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	config := reconcile.Config{Policy: reconcile.PolicyPriority, Priority: []string{"import:b/CHFUSD.csv"}, Tolerance: decimal.RequireFromString("0.01")}
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+	seeder.Workers = 1
+	seeder.Reconciler = reconcile.NewReconciler(db, db, config)
+	summary := seeder.Execute()
+	require.Empty(t, summary.Failed())
+	assert.Equal(t, 3, summary.Rows["CHF"])
+
+	// the file loaded last is the one the policy prefers, so it is published instead of being skipped
+	rates, err := db.GetRatesInRange(ctx, "CHF", date("2020-01-01"), date("2020-01-02"))
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, "1.01", rates[0].Rate.String())
+	assert.Equal(t, "1.03", rates[1].Rate.String())
+
+	disagreements, err := seeder.Reconciler.Report(ctx, nil, date("2020-01-01"), date("2020-01-31"))
+	require.NoError(t, err)
+	assert.Empty(t, disagreements)
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/seeds"
+	"github.com/stretchr/testify/assert"
+)
+
+func seedReports(summary seeds.Summary) map[string]seeds.FileReport {
+	result := make(map[string]seeds.FileReport)
+	for _, report := range summary.Files {
+		result[filepath.Base(report.Path)] = report
+	}
+
+	return result
+}
+
+func TestSeeder_Incremental(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	writeFile := func(name string, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+
+	writeFile("CHFUSD.csv", "DATE,CHFUSD\n2020-01-01,1.01\n2020-01-02,.\n2020-01-03,1.03")
+	reports := seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileNew, reports["CHFUSD.csv"].Status)
+	assert.Equal(t, map[string]int{"CHF": 2}, reports["CHFUSD.csv"].Rows)
+
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileUnchanged, reports["CHFUSD.csv"].Status)
+
+	// the last line had no newline before, appending must not count as a change
+	writeFile("CHFUSD.csv", "DATE,CHFUSD\n2020-01-01,1.01\n2020-01-02,.\n2020-01-03,1.03\n2020-01-04,1.04\n")
+	writeFile("JPYUSD.csv", "DATE,JPYUSD\n2020-01-01,0.0091\n")
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileAppended, reports["CHFUSD.csv"].Status)
+	assert.Equal(t, map[string]int{"CHF": 1}, reports["CHFUSD.csv"].Rows)
+	assert.Equal(t, seeds.FileNew, reports["JPYUSD.csv"].Status)
+
+	rates, err := db.GetRatesInRange(context.Background(), "CHF", date("2020-01-01"), date("2020-01-31"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+
+	writeFile("CHFUSD.csv", "DATE,CHFUSD\n2020-01-01,1.11\n2020-01-02,.\n2020-01-03,1.03\n2020-01-04,1.04\n2020-01-05,1.05\n")
+	reports = seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileConflict, reports["CHFUSD.csv"].Status)
+	assert.ErrorIs(t, reports["CHFUSD.csv"].Err, seeds.ErrSeededLinesChanged)
+	assert.Equal(t, seeds.FileUnchanged, reports["JPYUSD.csv"].Status)
+
+	rate, err := db.GetLastRate(context.Background(), "CHF")
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-01-04", rate.Date.Format("2006-01-02"))
+}
+
+func TestSeeder_ParallelAndFailureTolerant(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	// the real fxdata files plus one broken file
+	for _, name := range []string{"CHFUSD.csv", "JPYUSD.csv", "KRWUSD.csv", "THBUSD.csv"} {
+		content, err := os.ReadFile(filepath.Join("../fxdata", name))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "NOKUSD.csv"), []byte("DATE,NOKUSD\n2020-01-01,0.11\n2020-01-02,0.12,extra\n"), 0644))
+
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+	seeder.Workers = 3
+
+	summary := seeder.Execute()
+	assert.Len(t, summary.Files, 5)
+	assert.Len(t, summary.Failed(), 1)
+
+	reports := seedReports(summary)
+	assert.Equal(t, seeds.FileFailed, reports["NOKUSD.csv"].Status)
+	assert.Error(t, reports["NOKUSD.csv"].Err)
+	assert.Equal(t, seeds.FileNew, reports["CHFUSD.csv"].Status)
+	assert.Equal(t, 58, reports["CHFUSD.csv"].Skipped)
+
+	// 1306 lines minus the 58 without a rate
+	assert.Equal(t, map[string]int{"CHF": 1248, "JPY": 1248, "KRW": 1248, "THB": 1248}, summary.Rows)
+
+	rates, err := db.GetAllRatesOnDate(context.Background(), date("2016-04-13"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 4)
+
+	_, err = db.GetLastRate(context.Background(), "NOK")
+	assert.Error(t, err)
+}
+
+func TestSeeder_KeepsCommittedBatches(t *testing.T) {
+	dir := t.TempDir()
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	// one full batch, then a broken line
+	var content strings.Builder
+	content.WriteString("DATE,CHFUSD\n")
+	start := date("1990-01-01")
+	for i := 0; i < seeds.BatchSize; i++ {
+		fmt.Fprintf(&content, "%s,1.01\n", start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	valid := content.String()
+	content.WriteString("2020-01-01,1.01,extra\n")
+	path := filepath.Join(dir, "CHFUSD.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(content.String()), 0644))
+
+	seeder := seeds.New(db)
+	seeder.Dir = dir
+
+	summary := seeder.Execute()
+	assert.Equal(t, seeds.FileFailed, seedReports(summary)["CHFUSD.csv"].Status)
+	assert.Equal(t, map[string]int{"CHF": seeds.BatchSize}, summary.Rows)
+
+	stored, err := db.GetSeedFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, seeds.BatchSize+1, stored.Lines)
+
+	// fixing the broken line appends to the committed batch
+	assert.NoError(t, os.WriteFile(path, []byte(valid+"2020-01-01,1.02\n"), 0644))
+	reports := seedReports(seeder.Execute())
+	assert.Equal(t, seeds.FileAppended, reports["CHFUSD.csv"].Status)
+	assert.Equal(t, map[string]int{"CHF": 1}, reports["CHFUSD.csv"].Rows)
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLite(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+	assert.NoError(t, db.Ping(context.Background()))
+	assert.False(t, db.TableSeeded(context.Background()))
+
+	err := db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")},
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.0202")},
+		{BaseCurrency: "USD", QuoteCurrency: "JPY", Date: date("2020-01-02"), Rate: decimal.RequireFromString("0.0083")},
+	})
+	assert.NoError(t, err)
+	assert.True(t, db.TableSeeded(context.Background()))
+
+	rate := models.CurrencyRate{QuoteCurrency: "chf", Date: date("2020-01-03"), Rate: decimal.RequireFromString("1.123456")}
+	assert.NoError(t, db.CreateRate(context.Background(), &rate))
+	assert.NotZero(t, rate.ID)
+
+	duplicate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2020-01-03"), Rate: decimal.RequireFromString("1.2")}
+	assert.ErrorIs(t, db.CreateRate(context.Background(), &duplicate), database.ErrRateExists)
+
+	// seeding the same rows again must not duplicate them
+	err = db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")},
+	})
+	assert.NoError(t, err)
+
+	last, err := db.GetLastRate(context.Background(), "chf")
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-01-03", last.Date.Format("2006-01-02"))
+	assert.Equal(t, "1.123456", last.Rate.String())
+
+	_, err = db.GetLastRate(context.Background(), "eur")
+	assert.EqualError(t, err, "could not get rate for EUR")
+
+	rates, err := db.GetRatesInRange(context.Background(), "CHF", date("2020-01-01"), date("2020-01-03"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 3)
+
+	rates, err = db.GetAllRatesOnDate(context.Background(), date("2020-01-02"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.Equal(t, "CHF", rates[0].QuoteCurrency)
+	assert.Equal(t, "JPY", rates[1].QuoteCurrency)
+
+	assert.True(t, db.CheckRateQuoteOnDateExists(context.Background(), "jpy", date("2020-01-02")))
+	assert.False(t, db.CheckRateQuoteOnDateExists(context.Background(), "jpy", date("2020-01-03")))
+
+	rates, err = db.GetRatesAsOf(context.Background(), []string{"chf", "JPY", "EUR"}, date("2020-01-05"))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.Equal(t, "2020-01-03", rates[0].Date.Format("2006-01-02"))
+	assert.Equal(t, "2020-01-02", rates[1].Date.Format("2006-01-02"))
+
+	currencies, err := db.Currencies(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CHF", "JPY"}, currencies)
+}
+
+func TestSQLite_Timeout(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	assert.NoError(t, db.MigrateDB())
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	_, err := db.GetRatesInRange(ctx, "CHF", date("2020-01-01"), date("2020-01-03"))
+	assert.ErrorIs(t, err, database.ErrTimeout)
+
+	_, err = db.GetLastRate(ctx, "CHF")
+	assert.ErrorIs(t, err, database.ErrTimeout)
+
+	rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2020-01-03"), Rate: decimal.RequireFromString("1.2")}
+	assert.ErrorIs(t, db.CreateRate(ctx, &rate), database.ErrTimeout)
+
+	// a timeout shorter than the request deadline applies too
+	db.Timeouts.Read = time.Nanosecond
+	_, err = db.GetAllRatesOnDate(context.Background(), date("2020-01-03"))
+	assert.ErrorIs(t, err, database.ErrTimeout)
+
+	// a client that went away isn't a timeout
+	db.Timeouts.Read = 0
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = db.GetLastRate(ctx, "CHF")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, database.ErrTimeout)
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/events"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent - the fields of one server-sent event
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openStream - connects to the rate stream, events are read in the background until the test ends
+func openStream(t *testing.T, url string, lastEventID string) <-chan sseEvent {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				event.ID = value
+			case "event":
+				event.Event = value
+			case "data":
+				event.Data = value
+			case "":
+				if event.ID != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			}
+		}
+	}()
+
+	return events
+}
+
+func TestStreamRates(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	lastLoaded, err := db.LastEventID(context.Background())
+	require.NoError(t, err)
+
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	// cleanups run last in first out, so the streams are closed before the server waits for them
+	t.Cleanup(ts.Close)
+	client := resty.New()
+
+	live := openStream(t, ts.URL+"/api/v1/rates/stream?currencies=chf", "")
+
+	for _, currency := range []string{"jpy", "chf"} {
+		resp, err := client.R().SetBody(`{"date": "2015-12-31","rate": "1.0015"}`).Post(ts.URL + "/api/v1/rates/" + currency)
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode())
+	}
+
+	// the jpy rate is filtered out
+	event := receive(t, live)
+	assert.Equal(t, "rate.created", event.Event)
+	assert.JSONEq(t, `{"id": `+event.ID+`, "type": "rate.created", "date": "2015-12-31", "base_currency": "USD", "quote_currency": "CHF", "rate": "1.0015"}`, event.Data)
+
+	// a client that saw everything up to the loaded rates gets both new ones first
+	resumed := openStream(t, ts.URL+"/api/v1/rates/stream", strconv.FormatInt(lastLoaded, 10))
+	assert.Contains(t, receive(t, resumed).Data, `"quote_currency":"JPY"`)
+	assert.Equal(t, event.ID, receive(t, resumed).ID)
+
+	resp, err := client.R().SetHeader("Last-Event-ID", "abc").Get(ts.URL + "/api/v1/rates/stream")
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode())
+}
+
+func TestSQLite_RateEvents(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	require.NoError(t, db.BulkInsert([]models.CurrencyRate{
+		{BaseCurrency: "USD", QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")},
+		{BaseCurrency: "USD", QuoteCurrency: "JPY", Date: date("2020-01-01"), Rate: decimal.RequireFromString("108.5")},
+	}))
+	rate := models.CurrencyRate{QuoteCurrency: "chf", Date: date("2020-01-02"), Rate: decimal.RequireFromString("1.0202")}
+	require.NoError(t, db.CreateRate(ctx, &rate))
+	duplicate := rate
+	assert.ErrorIs(t, db.CreateRate(ctx, &duplicate), database.ErrRateExists)
+
+	last, err := db.LastEventID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), last)
+
+	events, err := db.EventsSince(ctx, 1, []string{"CHF"}, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.RateEventCreated, events[0].Type)
+	assert.Equal(t, "2020-01-02", events[0].Date.Format("2006-01-02"))
+	assert.Equal(t, "1.0202", events[0].Rate.String())
+}
+
+func TestBroker_SetCurrencies(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	broker := events.NewBroker(db)
+	broker.PollInterval = 10 * time.Millisecond
+	broker.BufferSize = 1
+
+	// the broker is live once it has read the position of the store, which is 1 after this rate
+	first := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2019-12-31"), Rate: decimal.RequireFromString("0.9")}
+	require.NoError(t, db.CreateRate(context.Background(), &first))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.Run(ctx)
+	require.Eventually(t, func() bool {
+		probe := broker.Subscribe(nil)
+		defer probe.Close()
+		return probe.Start == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sub := broker.Subscribe(nil)
+	sub.SetCurrencies([]string{"chf"})
+	defer sub.Close()
+
+	// rates of other currencies don't fill the buffer of the subscription
+	for _, d := range []string{"2020-01-01", "2020-01-02", "2020-01-03"} {
+		rate := models.CurrencyRate{QuoteCurrency: "JPY", Date: date(d), Rate: decimal.RequireFromString("110")}
+		require.NoError(t, db.CreateRate(context.Background(), &rate))
+	}
+	rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("0.9")}
+	require.NoError(t, db.CreateRate(context.Background(), &rate))
+	broker.Notify()
+
+	event := receive(t, sub.Events())
+	assert.Equal(t, "CHF", event.QuoteCurrency)
+	assert.False(t, sub.Slow())
+}
+
+func TestBroker_InvalidEnv(t *testing.T) {
+	t.Setenv("EVENTS_POLL_INTERVAL", "0s")
+	t.Setenv("EVENTS_BUFFER_SIZE", "-1")
+
+	// a ticker of 0s would panic in the broker's goroutine
+	h := server.NewHandler(memory.NewMemory(database.BaseCurrency), file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	defer h.Close()
+	assert.Equal(t, events.DefaultPollInterval, h.Events.PollInterval)
+	assert.Equal(t, events.DefaultBufferSize, h.Events.BufferSize)
+}
@@ -0,0 +1,24 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// receive - next value of ch, fails the test when nothing arrives within 5s or ch is closed
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case value, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received within 5s")
+	}
+
+	var zero T
+	return zero
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	sqlite "github.com/Shambou/golang-challenge/internal/database/sqlite"
+	"github.com/Shambou/golang-challenge/internal/models"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/Shambou/golang-challenge/internal/webhooks"
+	"github.com/go-resty/resty/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received - a request sent to the test endpoint
+type received struct {
+	Header http.Header
+	Body   []byte
+}
+
+// newReceiver - an endpoint that answers 500 while failing is set
+func newReceiver(t *testing.T, failing *int32) (string, <-chan received) {
+	requests := make(chan received, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		requests <- received{Header: r.Header, Body: body}
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL, requests
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Setenv("WEBHOOK_POLL_INTERVAL", "20ms")
+	t.Setenv("WEBHOOK_INITIAL_BACKOFF", "10ms")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+	client := resty.New()
+
+	var failing int32
+	endpoint, requests := newReceiver(t, &failing)
+
+	resp, err := client.R().SetBody(`{"url": "ftp://example.com"}`).Post(ts.URL + "/api/v1/webhooks")
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode())
+
+	var created struct {
+		Data struct {
+			ID         int64    `json:"id"`
+			Secret     string   `json:"secret"`
+			Currencies []string `json:"currencies"`
+		} `json:"data"`
+	}
+	resp, err = client.R().
+		SetBody(map[string]interface{}{"url": endpoint, "currencies": []string{"chf"}, "secret": "s3cret"}).
+		SetResult(&created).
+		Post(ts.URL + "/api/v1/webhooks")
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode(), resp.String())
+	assert.Equal(t, "s3cret", created.Data.Secret)
+	assert.Equal(t, []string{"CHF"}, created.Data.Currencies)
+	webhookURL := ts.URL + "/api/v1/webhooks/" + strconv.FormatInt(created.Data.ID, 10)
+
+	resp, err = client.R().Get(ts.URL + "/api/v1/webhooks")
+	require.NoError(t, err)
+	assert.NotContains(t, resp.String(), "s3cret")
+
+	// the jpy rate is filtered out
+	for _, currency := range []string{"jpy", "chf"} {
+		resp, err = client.R().SetBody(`{"date": "2015-12-31","rate": "1.0015"}`).Post(ts.URL + "/api/v1/rates/" + currency)
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode())
+	}
+	delivery := receive(t, requests)
+	assert.Equal(t, models.RateEventCreated, delivery.Header.Get(webhooks.HeaderEvent))
+	timestamp, err := strconv.ParseInt(delivery.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, webhooks.Sign("s3cret", timestamp, delivery.Body), delivery.Header.Get(webhooks.HeaderSignature))
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(delivery.Body, &payload))
+	assert.Equal(t, "CHF", payload["quote_currency"])
+	assert.Equal(t, "1.0015", payload["rate"])
+
+	resp, err = client.R().SetBody(`{"date": "2015-12-31","rate": "1.1"}`).Put(ts.URL + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	delivery = receive(t, requests)
+	assert.Equal(t, models.RateEventUpdated, delivery.Header.Get(webhooks.HeaderEvent))
+	assert.Contains(t, string(delivery.Body), `"rate":"1.1"`)
+
+	resp, err = client.R().Delete(ts.URL + "/api/v1/rates/chf/2015-12-31")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, models.RateEventDeleted, receive(t, requests).Header.Get(webhooks.HeaderEvent))
+
+	resp, err = client.R().Delete(ts.URL + "/api/v1/rates/chf/2015-12-31")
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode())
+
+	// a delivery that keeps failing ends up in the dead letters and can be sent again
+	atomic.StoreInt32(&failing, 1)
+	resp, err = client.R().SetBody(`{"date": "2015-12-31","rate": "1.2"}`).Post(ts.URL + "/api/v1/rates/chf")
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode())
+
+	var dead struct {
+		Data []struct {
+			ID        int64  `json:"id"`
+			Attempts  int    `json:"attempts"`
+			LastError string `json:"last_error"`
+		} `json:"data"`
+	}
+	require.Eventually(t, func() bool {
+		_, err := client.R().SetResult(&dead).Get(webhookURL + "/deliveries?status=dead")
+		return err == nil && len(dead.Data) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 2, dead.Data[0].Attempts)
+	assert.Equal(t, "endpoint answered 500 Internal Server Error", dead.Data[0].LastError)
+
+	atomic.StoreInt32(&failing, 0)
+	resp, err = client.R().Post(webhookURL + "/deliveries/" + strconv.FormatInt(dead.Data[0].ID, 10) + "/redeliver")
+	require.NoError(t, err)
+	require.Equal(t, 202, resp.StatusCode())
+	assert.Contains(t, string(receive(t, requests).Body), `"rate":"1.2"`)
+
+	resp, err = client.R().Delete(webhookURL)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode())
+	resp, err = client.R().Get(webhookURL)
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode())
+}
+
+func TestSQLite_Webhooks(t *testing.T) {
+	db := sqlite.NewDatabase(filepath.Join(t.TempDir(), "rates.db"))
+	require.NoError(t, db.MigrateDB())
+	ctx := context.Background()
+
+	rate := models.CurrencyRate{QuoteCurrency: "CHF", Date: date("2020-01-01"), Rate: decimal.RequireFromString("1.0226")}
+	require.NoError(t, db.CreateRate(ctx, &rate))
+
+	_, ok, err := db.WebhookCursor(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	webhook := models.Webhook{URL: "http://localhost/hook", Secret: "s3cret", Currencies: []string{"CHF"}}
+	require.NoError(t, db.CreateWebhook(ctx, &webhook))
+	assert.Equal(t, int64(1), webhook.AfterEventID)
+	cursor, ok, err := db.WebhookCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), cursor)
+
+	rate.Rate = decimal.RequireFromString("1.1")
+	require.NoError(t, db.UpdateRate(ctx, &rate))
+	require.NoError(t, db.DeleteRate(ctx, "chf", date("2020-01-01")))
+	assert.ErrorIs(t, db.DeleteRate(ctx, "chf", date("2020-01-01")), database.ErrRateNotFound)
+	assert.ErrorIs(t, db.UpdateRate(ctx, &rate), database.ErrRateNotFound)
+
+	events, err := db.EventsSince(ctx, cursor, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.RateEventUpdated, events[0].Type)
+	assert.Equal(t, models.RateEventDeleted, events[1].Type)
+
+	deliveries := []models.WebhookDelivery{{WebhookID: webhook.ID, Event: events[0]}, {WebhookID: webhook.ID, Event: events[1]}}
+	moved, err := db.EnqueueDeliveries(ctx, cursor, events[1].ID, deliveries)
+	require.NoError(t, err)
+	assert.True(t, moved)
+	// a second process that read the same cursor doesn't queue them again
+	moved, err = db.EnqueueDeliveries(ctx, cursor, events[1].ID, deliveries)
+	require.NoError(t, err)
+	assert.False(t, moved)
+
+	now := time.Now()
+	claimed, err := db.ClaimDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, "1.1", claimed[0].Event.Rate.String())
+	claimedAgain, err := db.ClaimDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, claimedAgain)
+
+	claimed[0].Status = models.DeliveryDead
+	claimed[0].Attempts = 3
+	claimed[0].LastError = "endpoint answered 500 Internal Server Error"
+	require.NoError(t, db.UpdateDelivery(ctx, claimed[0]))
+
+	dead, err := db.Deliveries(ctx, webhook.ID, models.DeliveryDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	all, err := db.Deliveries(ctx, webhook.ID, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	// the claimed delivery is left to its attempt, the dead one is queued again
+	requeued, err := db.RequeueDelivery(ctx, claimed[1].ID, now)
+	require.NoError(t, err)
+	assert.False(t, requeued)
+	requeued, err = db.RequeueDelivery(ctx, claimed[0].ID, now)
+	require.NoError(t, err)
+	assert.True(t, requeued)
+	delivery, err := db.GetDelivery(ctx, claimed[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryPending, delivery.Status)
+	assert.Equal(t, 0, delivery.Attempts)
+	assert.Empty(t, delivery.LastError)
+	claimed, err = db.ClaimDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	require.NoError(t, db.DeleteWebhook(ctx, webhook.ID))
+	_, err = db.GetDelivery(ctx, claimed[0].ID)
+	assert.ErrorIs(t, err, database.ErrDeliveryNotFound)
+	_, err = db.GetWebhook(ctx, webhook.ID)
+	assert.ErrorIs(t, err, database.ErrWebhookNotFound)
+}
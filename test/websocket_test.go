@@ -0,0 +1,111 @@
+package test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shambou/golang-challenge/internal/database"
+	file "github.com/Shambou/golang-challenge/internal/database/file"
+	memory "github.com/Shambou/golang-challenge/internal/database/memory"
+	"github.com/Shambou/golang-challenge/internal/server"
+	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsFrame - any frame the rates websocket sends
+type wsFrame struct {
+	Type    string                 `json:"type"`
+	Pairs   []string               `json:"pairs"`
+	Rate    map[string]interface{} `json:"rate"`
+	Message string                 `json:"message"`
+}
+
+func wsSend(t *testing.T, conn *websocket.Conn, message string) wsFrame {
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+
+	return wsRead(t, conn)
+}
+
+func wsRead(t *testing.T, conn *websocket.Conn) wsFrame {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var frame wsFrame
+	require.NoError(t, conn.ReadJSON(&frame))
+
+	return frame
+}
+
+func TestRatesWebSocket(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	require.NoError(t, db.LoadDir("../fxdata", ".csv"))
+
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	h.WebSocket.MaxSubscriptions = 2
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+	client := resty.New()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/v1/rates/ws", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	frame := wsSend(t, conn, `{"action": "subscribe", "pairs": ["chfusd", "JPY"]}`)
+	assert.Equal(t, wsFrame{Type: "subscribed", Pairs: []string{"CHFUSD", "JPYUSD"}}, frame)
+
+	frame = wsSend(t, conn, `{"action": "subscribe", "pairs": ["EUR"]}`)
+	assert.Equal(t, "error", frame.Type)
+	assert.Equal(t, "a connection can subscribe to at most 2 pairs", frame.Message)
+
+	frame = wsSend(t, conn, `{"action": "subscribe", "pairs": ["CHFEUR"]}`)
+	assert.Equal(t, "CHFEUR is not a valid currency pair", frame.Message)
+
+	frame = wsSend(t, conn, `{"action": "unsubscribe", "pairs": ["JPYUSD"]}`)
+	assert.Equal(t, wsFrame{Type: "unsubscribed", Pairs: []string{"CHFUSD"}}, frame)
+
+	frame = wsSend(t, conn, `hello`)
+	assert.Equal(t, "action must be subscribe or unsubscribe", frame.Message)
+
+	for _, currency := range []string{"jpy", "chf"} {
+		resp, err := client.R().SetBody(`{"date": "2015-12-31","rate": "1.0015"}`).Post(ts.URL + "/api/v1/rates/" + currency)
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode())
+	}
+
+	// the jpy rate is filtered out
+	frame = wsRead(t, conn)
+	assert.Equal(t, "rate", frame.Type)
+	assert.Equal(t, "CHF", frame.Rate["quote_currency"])
+	assert.Equal(t, "2015-12-31", frame.Rate["date"])
+	assert.Equal(t, "1.0015", frame.Rate["rate"])
+}
+
+func TestRatesWebSocket_Shutdown(t *testing.T) {
+	db := memory.NewMemory(database.BaseCurrency)
+	h := server.NewHandler(db, file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	ts := httptest.NewServer(h.Router)
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/v1/rates/ws", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	wsSend(t, conn, `{"action": "subscribe", "pairs": ["CHF"]}`)
+
+	h.Events.Close()
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
+
+func TestRatesWebSocket_InvalidEnv(t *testing.T) {
+	t.Setenv("WS_PING_INTERVAL", "0s")
+	t.Setenv("WS_WRITE_TIMEOUT", "-1s")
+
+	// a ping ticker of 0s would panic once a client connects
+	h := server.NewHandler(memory.NewMemory(database.BaseCurrency), file.NewFile(database.BaseCurrency, "../fxdata/", ".csv"))
+	defer h.Close()
+	assert.Equal(t, server.DefaultWebSocketConfig, h.WebSocket)
+}